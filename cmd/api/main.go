@@ -9,10 +9,11 @@ import (
 	"syscall"
 	"time"
 
+	"test-news/internal/scheduler"
 	"test-news/internal/server"
 )
 
-func gracefulShutdown(apiServer *http.Server, done chan bool) {
+func gracefulShutdown(apiServer *http.Server, jobs *scheduler.Scheduler, done chan bool) {
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -31,6 +32,11 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 		log.Printf("Server forced to shutdown with error: %v", err)
 	}
 
+	// Stop the background jobs once no request can start new work
+	if err := jobs.Stop(ctx); err != nil {
+		log.Printf("Scheduler forced to stop with error: %v", err)
+	}
+
 	log.Println("Server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
@@ -39,13 +45,19 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 
 func main() {
 
-	server := server.NewServer()
+	db := server.OpenDatabase()
+
+	// Run the background jobs, such as scheduled publishing
+	jobs := scheduler.New(db)
+	jobs.Start()
+
+	server := server.NewServer(db)
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
 
 	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(server, done)
+	go gracefulShutdown(server, jobs, done)
 
 	err := server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"test-news/internal/database"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up      apply every pending migration
+  status  list migrations and when they were applied`
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	migrator, ok := database.New().(database.Migrator)
+	if !ok {
+		log.Fatal("the configured database does not support migrations")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := migrator.Migrate(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %3d  %s\n", m.Version, m.Description)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		if err := migrator.CheckIndexes(ctx); err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		states, err := migrator.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range states {
+			applied := "pending"
+			if !m.AppliedAt.IsZero() {
+				applied = m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%3d  %-25s  %s\n", m.Version, applied, m.Description)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"test-news/internal/database"
+	"test-news/internal/media"
+	"test-news/internal/policy"
+)
+
+// describeError maps an error of database.Service or of the policy onto a
+// status code and a message for the visitor. Anything else is logged and
+// reported as a generic failure, so driver messages never reach the page.
+func describeError(r *http.Request, err error) (int, string) {
+	var refusal *policy.Refusal
+	var verr *database.ValidationError
+
+	switch {
+	case errors.As(err, &refusal):
+		return http.StatusForbidden, refusal.Reason + "."
+	case errors.Is(err, database.ErrInvalidID):
+		return http.StatusBadRequest, "The ID is not a valid post ID."
+	case errors.Is(err, database.ErrRevisionNotFound):
+		return http.StatusNotFound, "The revision does not exist."
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound, "The post does not exist, or has been moved to the trash."
+	case errors.Is(err, database.ErrVersionMismatch):
+		return http.StatusConflict, "The post was changed by someone else. Review it and try again."
+	case errors.Is(err, database.ErrConflict):
+		return http.StatusConflict, "The request conflicts with the current state of the post."
+	case errors.As(err, &verr):
+		return http.StatusUnprocessableEntity, fmt.Sprintf("The %s %s.", verr.Field, verr.Message)
+	case errors.Is(err, media.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge, "The file is larger than the upload limit."
+	case errors.Is(err, media.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType, "Only JPEG, PNG, GIF and WebP images and MP4 and WebM videos can be uploaded."
+	default:
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		return http.StatusInternalServerError, "Something went wrong on our side. Please try again."
+	}
+}
+
+// errorMessage describes err for the error message of a form.
+func errorMessage(r *http.Request, err error) string {
+	_, message := describeError(r, err)
+	return message
+}
+
+// renderError renders err as an error page, or as a notice when htmx asked
+// for a fragment of a page.
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := describeError(r, err)
+
+	// htmx doesn't swap in error responses, so a fragment reports its error
+	// with a successful status instead.
+	if r.Header.Get("HX-Request") == "true" {
+		ErrorNotice(message).Render(r.Context(), w)
+		return
+	}
+
+	w.WriteHeader(status)
+	ErrorPage(status, message).Render(r.Context(), w)
+}
+
+func statusTitle(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "Not found"
+	case http.StatusForbidden:
+		return "Not allowed"
+	default:
+		return http.StatusText(status)
+	}
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"test-news/internal/database/models"
+)
+
+// CSRFField is the name of the hidden form field carrying the CSRF token of
+// the session, and CSRFHeader the header scripts send it in instead.
+const (
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Viewer is the member of the newsroom signed in to the web UI.
+type Viewer struct {
+	Name      string
+	Username  string
+	Role      models.Role
+	CSRFToken string
+}
+
+type viewerKey struct{}
+
+// WithViewer returns a copy of ctx carrying the signed-in viewer, which the
+// pages read to show who is signed in and to fill in CSRF tokens.
+func WithViewer(ctx context.Context, viewer *Viewer) context.Context {
+	return context.WithValue(ctx, viewerKey{}, viewer)
+}
+
+// ViewerFrom returns the viewer carried by ctx, or nil when nobody is signed
+// in.
+func ViewerFrom(ctx context.Context) *Viewer {
+	viewer, _ := ctx.Value(viewerKey{}).(*Viewer)
+	return viewer
+}
+
+// csrfToken returns the CSRF token of the viewer carried by ctx.
+func csrfToken(ctx context.Context) string {
+	if viewer := ViewerFrom(ctx); viewer != nil {
+		return viewer.CSRFToken
+	}
+	return ""
+}
+
+// csrfHeaders returns the hx-headers of the pages, which make htmx send the
+// CSRF token of the viewer in CSRFHeader with every request.
+func csrfHeaders(ctx context.Context) string {
+	headers, _ := json.Marshal(map[string]string{CSRFHeader: csrfToken(ctx)})
+	return string(headers)
+}
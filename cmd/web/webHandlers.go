@@ -1,178 +1,228 @@
 package web
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
+	"test-news/internal/database"
 	"test-news/internal/database/models"
+	"test-news/internal/markdown"
+	"test-news/internal/media"
+	"test-news/internal/policy"
+	"unicode/utf8"
 )
 
-type PostsResponse struct {
-	Count int           `json:"count"`
-	Data  []models.Post `json:"data"`
+// Handlers serves the pages of the web UI. They read and change posts
+// through the same database.Service as the API and apply the same policy,
+// to the principal the server found for the request.
+type Handlers struct {
+	db         database.Service
+	media      *media.Library
+	renderings *markdown.Cache
 }
 
-func PostsPageHandler(w http.ResponseWriter, r *http.Request) {
+// NewHandlers returns the web UI handlers on top of db, keeping uploaded
+// files in library and rendering content through renderings.
+func NewHandlers(db database.Service, library *media.Library, renderings *markdown.Cache) *Handlers {
+	return &Handlers{db: db, media: library, renderings: renderings}
+}
+
+func (h *Handlers) PostsPageHandler(w http.ResponseWriter, r *http.Request) {
 	PostsPage().Render(r.Context(), w)
 }
 
-func PostsListHandler(w http.ResponseWriter, r *http.Request) {
-	// Fetch posts from the API endpoint
-	resp, err := http.Get("http://localhost:8080/api/posts")
-	if err != nil {
-		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
+// visibleFilter limits a listing to the posts the viewer may see, see
+// policy.Visible.
+func visibleFilter(r *http.Request) database.PostFilter {
+	var filter database.PostFilter
+	policy.RestrictToVisible(policy.PrincipalFrom(r.Context()), &filter)
+	return filter
+}
+
+func (h *Handlers) PostsListHandler(w http.ResponseWriter, r *http.Request) {
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		h.searchPosts(w, r, q)
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	page, err := h.db.ListPosts(r.Context(), database.ListOptions{
+		Cursor: r.URL.Query().Get("cursor"),
+		Filter: visibleFilter(r),
+	})
 	if err != nil {
-		http.Error(w, "Failed to read response body", http.StatusInternalServerError)
+		renderError(w, r, err)
 		return
 	}
 
-	var postsResp PostsResponse
-	if err := json.Unmarshal(body, &postsResp); err != nil {
-		http.Error(w, "Failed to parse posts data", http.StatusInternalServerError)
+	// Render the posts list component
+	PostsList(page.Posts, page.PrevCursor, page.NextCursor).Render(r.Context(), w)
+}
+
+// searchPosts renders the posts matching q, best match first, with the
+// matches highlighted.
+func (h *Handlers) searchPosts(w http.ResponseWriter, r *http.Request, q string) {
+	results, err := h.db.SearchPosts(r.Context(), q, 0, visibleFilter(r))
+	if err != nil {
+		renderError(w, r, err)
 		return
 	}
 
-	// Render the posts list component
-	PostsList(postsResp.Data).Render(r.Context(), w)
+	SearchResults(results).Render(r.Context(), w)
 }
 
-func PostDetailPageHandler(w http.ResponseWriter, r *http.Request) {
+// getVisiblePost loads the post with the given ID, treating one the viewer
+// may not see as missing.
+func (h *Handlers) getVisiblePost(r *http.Request, id string) (*models.Post, error) {
+	post, err := h.db.GetPost(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.Visible(policy.PrincipalFrom(r.Context()), post) {
+		return nil, database.ErrPostNotFound
+	}
+	return post, nil
+}
+
+func (h *Handlers) PostDetailPageHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the post ID from the URL
 	// The URL format is /web/posts/:id
 	pathParts := strings.Split(r.URL.Path, "/")
 	id := pathParts[len(pathParts)-1]
 
-	// Fetch the post from the API endpoint
-	resp, err := http.Get("http://localhost:8080/api/posts/" + id)
+	post, err := h.getVisiblePost(r, id)
 	if err != nil {
-		http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		http.Error(w, "Post not found", http.StatusNotFound)
+		renderError(w, r, err)
 		return
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	content, err := h.renderings.Render(post)
 	if err != nil {
-		http.Error(w, "Failed to read response body: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var post models.Post
-	if err := json.Unmarshal(body, &post); err != nil {
-		http.Error(w, "Failed to parse post data: "+err.Error(), http.StatusInternalServerError)
+		renderError(w, r, err)
 		return
 	}
 
 	// Render the post detail page
-	PostDetailPage(post).Render(r.Context(), w)
+	PostDetailPage(*post, content).Render(r.Context(), w)
 }
-func UploadPageHandler(w http.ResponseWriter, r *http.Request) {
+
+func (h *Handlers) UploadPageHandler(w http.ResponseWriter, r *http.Request) {
 	UploadPage("", "").Render(r.Context(), w)
 }
 
-func UploadSubmitHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse the form data
-	if err := r.ParseForm(); err != nil {
+func (h *Handlers) UploadSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the form data, which holds files when media are attached
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
 		UploadPage("", "Failed to parse form data: "+err.Error()).Render(r.Context(), w)
 		return
 	}
 
 	// Get the form values
 	title := r.FormValue("title")
-	author := r.FormValue("author")
 	content := r.FormValue("content")
 
-	// Validate the form values
-	if title == "" || author == "" || content == "" {
+	// Validate the form values. The post is credited to the signed-in user.
+	if title == "" || content == "" {
 		UploadPage("", "All fields are required").Render(r.Context(), w)
 		return
 	}
 
-	// Create the payload
-	payload := map[string]string{
-		"title":   title,
-		"author":  author,
-		"content": content,
+	author := policy.PrincipalFrom(r.Context())
+	if err := policy.Decide(author, policy.CreatePost, nil); err != nil {
+		UploadPage("", errorMessage(r, err)).Render(r.Context(), w)
+		return
 	}
 
-	// Convert the payload to JSON
-	jsonPayload, err := json.Marshal(payload)
+	byline, err := policy.Byline(r.Context(), h.db, author)
 	if err != nil {
-		UploadPage("", "Failed to create JSON payload: "+err.Error()).Render(r.Context(), w)
+		UploadPage("", "Failed to create post. "+errorMessage(r, err)).Render(r.Context(), w)
 		return
 	}
 
-	// Create a new request to create the post
-	req, err := http.NewRequest("POST", "http://localhost:8080/api/posts", bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		UploadPage("", "Failed to create request: "+err.Error()).Render(r.Context(), w)
+	post := &models.Post{
+		Title:    title,
+		Content:  content,
+		Author:   byline,
+		AuthorID: author.ID,
+	}
+	if err := h.uploadPostMedia(r, post); err != nil {
+		UploadPage("", "Failed to upload media. "+errorMessage(r, err)).Render(r.Context(), w)
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		UploadPage("", "Failed to create post: "+err.Error()).Render(r.Context(), w)
+	if err := h.db.CreatePost(r.Context(), post); err != nil {
+		UploadPage("", "Failed to create post. "+errorMessage(r, err)).Render(r.Context(), w)
 		return
 	}
-	defer resp.Body.Close()
 
-	// Check if the creation was successful
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		// Read the error response
-		body, err := io.ReadAll(resp.Body)
+	// Render the upload page with a success message
+	UploadPage("Draft saved! It appears on the site once an editor publishes it.", "").Render(r.Context(), w)
+}
+
+// maxFormMemory is how much of a multipart form is kept in memory, the rest
+// goes to temporary files.
+const maxFormMemory = 8 << 20
+
+// uploadPostMedia stores the hero image and inline media attached to the
+// upload form and adds them to post.
+func (h *Handlers) uploadPostMedia(r *http.Request, post *models.Post) error {
+	if r.MultipartForm == nil {
+		return nil
+	}
+
+	if headers := r.MultipartForm.File["hero_image"]; len(headers) > 0 {
+		hero, err := h.uploadFile(r, headers[0])
 		if err != nil {
-			UploadPage("", "Failed to read error response: "+err.Error()).Render(r.Context(), w)
-			return
+			return err
 		}
+		hero.Alt = strings.TrimSpace(r.FormValue("hero_alt"))
+		post.HeroImage = &hero
+	}
 
-		UploadPage("", "Failed to create post: "+string(body)).Render(r.Context(), w)
-		return
+	for _, header := range r.MultipartForm.File["media"] {
+		m, err := h.uploadFile(r, header)
+		if err != nil {
+			return err
+		}
+		post.Media = append(post.Media, m)
 	}
+	return nil
+}
 
-	// Render the upload page with a success message
-	UploadPage("Post created successfully!", "").Render(r.Context(), w)
+func (h *Handlers) uploadFile(r *http.Request, header *multipart.FileHeader) (models.Media, error) {
+	file, err := header.Open()
+	if err != nil {
+		return models.Media{}, err
+	}
+	defer file.Close()
+
+	return h.media.Upload(r.Context(), file)
 }
 
-func DeletePageHandler(w http.ResponseWriter, r *http.Request) {
-	DeletePage("", "").Render(r.Context(), w)
+func (h *Handlers) DeletePageHandler(w http.ResponseWriter, r *http.Request) {
+	DeletePage("", "", "").Render(r.Context(), w)
 }
 
-func DeleteConfirmHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) DeleteConfirmHandler(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		DeletePage("", "Failed to parse form: "+err.Error()).Render(r.Context(), w)
+		DeletePage("", "Failed to parse form: "+err.Error(), "").Render(r.Context(), w)
 		return
 	}
 
-	postId := r.FormValue("postId")
+	postId := strings.TrimSpace(r.FormValue("postId"))
 	if postId == "" {
-		DeletePage("", "Post ID is required").Render(r.Context(), w)
+		DeletePage("", "Post ID is required", "").Render(r.Context(), w)
 		return
 	}
 
-	// Check if the post exists
-	resp, err := http.Get("http://localhost:8080/api/posts/" + postId)
-	if err != nil {
-		DeletePage("", "Failed to check post: "+err.Error()).Render(r.Context(), w)
-		return
+	// Check that the post exists and may be deleted before asking
+	post, err := h.getVisiblePost(r, postId)
+	if err == nil {
+		err = policy.Decide(policy.PrincipalFrom(r.Context()), policy.DeletePost, post)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		DeletePage("", "Post not found. Please check the ID and try again.").Render(r.Context(), w)
+	if err != nil {
+		DeletePage("", errorMessage(r, err), "").Render(r.Context(), w)
 		return
 	}
 
@@ -180,37 +230,289 @@ func DeleteConfirmHandler(w http.ResponseWriter, r *http.Request) {
 	DeleteConfirmPage(postId).Render(r.Context(), w)
 }
 
-func DeleteExecuteHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) DeleteExecuteHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the post ID from the URL
 	// The URL format is /web/delete/execute/:id
 	pathParts := strings.Split(r.URL.Path, "/")
 	postId := pathParts[len(pathParts)-1]
 
-	// Create a new request to delete the post
-	req, err := http.NewRequest("DELETE", "http://localhost:8080/api/posts/"+postId, nil)
+	post, err := h.getVisiblePost(r, postId)
+	if err == nil {
+		err = policy.Decide(policy.PrincipalFrom(r.Context()), policy.DeletePost, post)
+	}
+	if err == nil {
+		err = h.db.DeletePost(r.Context(), postId)
+	}
 	if err != nil {
-		DeletePage("", "Failed to create request: "+err.Error()).Render(r.Context(), w)
+		DeletePage("", "Failed to delete post. "+errorMessage(r, err), "").Render(r.Context(), w)
 		return
 	}
 
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// Render the delete page with a success message
+	DeletePage("Post moved to the trash.", "", postId).Render(r.Context(), w)
+}
+
+func (h *Handlers) DeleteUndoHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the post ID from the URL
+	// The URL format is /web/delete/undo/:id
+	pathParts := strings.Split(r.URL.Path, "/")
+	postId := pathParts[len(pathParts)-1]
+
+	trashed, err := h.db.GetTrashedPost(r.Context(), postId)
+	if err == nil {
+		err = policy.Decide(policy.PrincipalFrom(r.Context()), policy.DeletePost, trashed)
+	}
+	if err == nil {
+		_, err = h.db.RestorePost(r.Context(), postId)
+	}
 	if err != nil {
-		DeletePage("", "Failed to delete post: "+err.Error()).Render(r.Context(), w)
+		DeletePage("", "Failed to restore post. It may have been purged already.", "").Render(r.Context(), w)
 		return
 	}
-	defer resp.Body.Close()
 
-	// Check if the delete was successful
-	if resp.StatusCode != http.StatusOK {
-		DeletePage("", "Failed to delete post. Please try again.").Render(r.Context(), w)
+	DeletePage("Post restored successfully!", "", "").Render(r.Context(), w)
+}
+
+// UpdatePageHandler asks for the ID of the post to update, and sends the
+// visitor on to its edit page once given.
+func (h *Handlers) UpdatePageHandler(w http.ResponseWriter, r *http.Request) {
+	postId := strings.TrimSpace(r.URL.Query().Get("postId"))
+	if postId == "" {
+		UpdatePage("").Render(r.Context(), w)
 		return
 	}
 
-	// Render the delete page with a success message
-	DeletePage("Post deleted successfully!", "").Render(r.Context(), w)
+	if _, err := h.getVisiblePost(r, postId); err != nil {
+		UpdatePage(errorMessage(r, err)).Render(r.Context(), w)
+		return
+	}
+
+	http.Redirect(w, r, "/web/posts/"+postId+"/edit", http.StatusSeeOther)
 }
-func UpdatePageHandler(w http.ResponseWriter, r *http.Request) {
-	UpdatePage().Render(r.Context(), w)
+
+// maxTitleLength is the limit of the edit form, matching the upload form.
+const maxTitleLength = 100
+
+// validateEditForm returns a message per invalid field of form.
+func validateEditForm(form EditForm) map[string]string {
+	fieldErrors := map[string]string{}
+
+	switch title := strings.TrimSpace(form.Title); {
+	case title == "":
+		fieldErrors["title"] = "Title is required"
+	case utf8.RuneCountInString(title) > maxTitleLength:
+		fieldErrors["title"] = fmt.Sprintf("Title must be at most %d characters", maxTitleLength)
+	}
+
+	if strings.TrimSpace(form.Content) == "" {
+		fieldErrors["content"] = "Content is required"
+	}
+
+	return fieldErrors
+}
+
+// editablePost loads the post of an edit page, which the viewer must be
+// allowed to edit.
+func (h *Handlers) editablePost(r *http.Request) (*models.Post, error) {
+	// The URL format is /web/posts/:id/edit
+	pathParts := strings.Split(r.URL.Path, "/")
+	id := pathParts[3]
+
+	post, err := h.getVisiblePost(r, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Decide(policy.PrincipalFrom(r.Context()), policy.EditPost, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (h *Handlers) EditPageHandler(w http.ResponseWriter, r *http.Request) {
+	post, err := h.editablePost(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	EditPage(*post, editFormFor(post), nil, "", "").Render(r.Context(), w)
+}
+
+func (h *Handlers) EditSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	post, err := h.editablePost(r)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	// Parse the form data
+	if err := r.ParseForm(); err != nil {
+		EditPage(*post, editFormFor(post), nil, "", "Failed to parse form data: "+err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	form := EditForm{
+		Title:   r.FormValue("title"),
+		Content: r.FormValue("content"),
+	}
+	form.Version, err = parseVersion(r.FormValue("version"), "version")
+	if err != nil {
+		EditPage(*post, editFormFor(post), nil, "", errorMessage(r, err)).Render(r.Context(), w)
+		return
+	}
+
+	// Validate the form values
+	if fieldErrors := validateEditForm(form); len(fieldErrors) > 0 {
+		EditPage(*post, form, fieldErrors, "", "Please correct the errors below").Render(r.Context(), w)
+		return
+	}
+
+	// Update against the version the form was filled from, so that a change
+	// made in the meantime isn't overwritten
+	updated, err := h.db.UpdatePost(r.Context(), post.ID.Hex(), form.Version, &models.Post{
+		Title:   strings.TrimSpace(form.Title),
+		Content: form.Content,
+	})
+	if errors.Is(err, database.ErrVersionMismatch) {
+		// Keep what was typed, but based on the latest version: saving again
+		// is a deliberate choice to overwrite the other change.
+		form.Version = post.Version
+		EditPage(*post, form, nil, "", "Someone else changed this post since you loaded it. "+
+			"Check its history, then update again to overwrite their changes.").Render(r.Context(), w)
+		return
+	}
+	var verr *database.ValidationError
+	if errors.As(err, &verr) {
+		EditPage(*post, form, map[string]string{verr.Field: errorMessage(r, err)}, "", "Please correct the errors below").Render(r.Context(), w)
+		return
+	}
+	if err != nil {
+		EditPage(*post, form, nil, "", "Failed to update post. "+errorMessage(r, err)).Render(r.Context(), w)
+		return
+	}
+
+	// Render the edit page with a success message
+	EditPage(*updated, editFormFor(updated), nil, "Post updated successfully!", "").Render(r.Context(), w)
+}
+
+// historyPost loads the post with the given ID for its history, which the
+// viewer must be allowed to read.
+func (h *Handlers) historyPost(r *http.Request, id string) (*models.Post, error) {
+	post, err := h.getVisiblePost(r, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Decide(policy.PrincipalFrom(r.Context()), policy.ReadHistory, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// renderHistory renders the history page of the post with the given ID.
+func (h *Handlers) renderHistory(w http.ResponseWriter, r *http.Request, id string, successMessage string, errorMessage string) {
+	post, err := h.historyPost(r, id)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	revisions, err := h.db.ListRevisions(r.Context(), id)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	HistoryPage(*post, revisions, successMessage, errorMessage).Render(r.Context(), w)
+}
+
+func (h *Handlers) HistoryPageHandler(w http.ResponseWriter, r *http.Request) {
+	// The URL format is /web/posts/:id/history
+	pathParts := strings.Split(r.URL.Path, "/")
+	id := pathParts[3]
+
+	h.renderHistory(w, r, id, "", "")
+}
+
+// parseVersion parses a post version out of a path or query parameter.
+func parseVersion(value string, name string) (int64, error) {
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 1 {
+		return 0, &database.ValidationError{Field: name, Message: "must be a positive version number"}
+	}
+	return version, nil
+}
+
+func (h *Handlers) RevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	// The URL format is /web/posts/:id/history/diff
+	pathParts := strings.Split(r.URL.Path, "/")
+	id := pathParts[3]
+
+	from, err := parseVersion(r.URL.Query().Get("from"), "from")
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	to, err := parseVersion(r.URL.Query().Get("to"), "to")
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	post, err := h.historyPost(r, id)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	diff, err := database.DiffVersions(r.Context(), h.db, post, from, to)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	RevisionDiff(diff).Render(r.Context(), w)
+}
+
+func (h *Handlers) RestoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	// The URL format is /web/posts/:id/history/:rev/restore
+	pathParts := strings.Split(r.URL.Path, "/")
+	id := pathParts[3]
+
+	if err := r.ParseForm(); err != nil {
+		h.renderHistory(w, r, id, "", "Failed to parse form: "+err.Error())
+		return
+	}
+
+	rev, err := parseVersion(pathParts[5], "rev")
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+	// Restore against the version the page was rendered with, so that a
+	// change made in the meantime isn't overwritten
+	version, err := parseVersion(r.FormValue("version"), "version")
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	post, err := h.getVisiblePost(r, id)
+	if err == nil {
+		err = policy.Decide(policy.PrincipalFrom(r.Context()), policy.EditPost, post)
+	}
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	revision, err := h.db.GetRevision(r.Context(), id, rev)
+	if err == nil {
+		_, err = h.db.PatchPost(r.Context(), id, version, database.PatchFromRevision(revision))
+	}
+	if err != nil {
+		h.renderHistory(w, r, id, "", "Failed to restore revision. "+errorMessage(r, err))
+		return
+	}
+
+	h.renderHistory(w, r, id, "Version "+strconv.FormatInt(rev, 10)+" restored successfully!", "")
 }
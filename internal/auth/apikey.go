@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyPrefix starts every API key, which tells them apart from the JWTs
+// sent in the same Authorization header.
+const apiKeyPrefix = "tn_"
+
+// NewAPIKey returns a random API key secret together with its display prefix
+// and the hash to store, see HashAPIKey.
+func NewAPIKey() (secret, prefix, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+
+	secret = apiKeyPrefix + hex.EncodeToString(b)
+	return secret, secret[:len(apiKeyPrefix)+8], HashAPIKey(secret)
+}
+
+// HashAPIKey returns the hex SHA-256 of an API key secret. The secrets are
+// random and long, so a fast hash is enough and lets keys be looked up by it.
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether token looks like an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
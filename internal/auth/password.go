@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"test-news/internal/database"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password length limits. bcrypt only looks at the first 72 bytes, so longer
+// passwords are refused rather than silently truncated.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// HashPassword returns the bcrypt hash of password, failing with a
+// *database.ValidationError when the password is too short or too long.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", &database.ValidationError{Field: "password", Message: "must be at least 8 characters"}
+	}
+	if len(password) > MaxPasswordLength {
+		return "", &database.ValidationError{Field: "password", Message: "must be at most 72 bytes"}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// dummyHash is compared against when a user doesn't exist, so that a login
+// takes as long for an unknown username as for a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// CheckPassword reports whether password matches hash. An empty hash never
+// matches but costs the same as a real comparison.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
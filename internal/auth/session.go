@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// NewSessionToken returns a random token for a session cookie together with
+// the hash to store, see HashSessionToken.
+func NewSessionToken() (token, hash string) {
+	token = randomHex(32)
+	return token, HashSessionToken(token)
+}
+
+// HashSessionToken returns the hex SHA-256 of a session token, which like an
+// API key is random and long enough for a fast hash.
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewCSRFToken returns a random token to embed in the forms of a session.
+func NewCSRFToken() string {
+	return randomHex(32)
+}
+
+// CheckCSRFToken reports whether got is the CSRF token of the session,
+// comparing in constant time.
+func CheckCSRFToken(want, got string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
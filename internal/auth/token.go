@@ -0,0 +1,128 @@
+// Package auth hashes passwords and issues the signed tokens that callers of
+// the API present after logging in.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"test-news/internal/database/models"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for a token that is malformed, expired, signed
+// with another key or of the wrong kind.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Token kinds, stored in the "typ" claim. An access token signs requests in,
+// a refresh token only buys a new pair of tokens.
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// issuerName is the "iss" claim of every token.
+const issuerName = "test-news"
+
+// Claims are the contents of a token. The subject is the hex ID of the user.
+type Claims struct {
+	Name string      `json:"name"`
+	Role models.Role `json:"role"`
+	Type string      `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is the response to a successful login or refresh.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// Issuer signs and verifies HS256 tokens with a shared secret.
+type Issuer struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewIssuer returns an Issuer whose access and refresh tokens expire after
+// accessTTL and refreshTTL.
+func NewIssuer(secret []byte, accessTTL, refreshTTL time.Duration) *Issuer {
+	return &Issuer{
+		secret:     secret,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		now:        time.Now,
+	}
+}
+
+// Issue returns a fresh access and refresh token for user.
+func (i *Issuer) Issue(user *models.User) (*TokenPair, error) {
+	access, err := i.sign(user, AccessToken, i.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := i.sign(user, RefreshToken, i.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(i.accessTTL / time.Second),
+	}, nil
+}
+
+func (i *Issuer) sign(user *models.User, kind string, ttl time.Duration) (string, error) {
+	now := i.now()
+	claims := Claims{
+		Name: user.Name,
+		Role: user.Role,
+		Type: kind,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuerName,
+			Subject:   user.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.secret)
+	if err != nil {
+		return "", fmt.Errorf("error signing %s token: %w", kind, err)
+	}
+	return token, nil
+}
+
+// Verify checks the signature and expiry of token and that it is of the
+// given kind, and returns its claims.
+func (i *Issuer) Verify(token string, kind string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return i.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuerName),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(i.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if claims.Type != kind {
+		return nil, fmt.Errorf("%w: got a %q token, want %q", ErrInvalidToken, claims.Type, kind)
+	}
+	if !claims.Role.Valid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidToken, claims.Role)
+	}
+
+	return &claims, nil
+}
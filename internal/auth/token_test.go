@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"test-news/internal/database/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	issuer := NewIssuer([]byte("secret"), time.Minute, time.Hour)
+	user := &models.User{ID: primitive.NewObjectID(), Name: "Jane", Role: models.RoleEditor}
+
+	tokens, err := issuer.Issue(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := issuer.Verify(tokens.AccessToken, AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != user.ID.Hex() || claims.Name != "Jane" || claims.Role != models.RoleEditor {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := issuer.Verify(tokens.AccessToken, RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for the wrong kind, got %v", err)
+	}
+	if _, err := NewIssuer([]byte("other"), time.Minute, time.Hour).Verify(tokens.AccessToken, AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for another secret, got %v", err)
+	}
+
+	// The access token expires long before the refresh token.
+	issuer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := issuer.Verify(tokens.AccessToken, AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for an expired token, got %v", err)
+	}
+	if _, err := issuer.Verify(tokens.RefreshToken, RefreshToken); err != nil {
+		t.Fatalf("expected the refresh token to be valid, got %v", err)
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	if _, err := HashPassword("short"); err == nil {
+		t.Fatal("expected a short password to be refused")
+	}
+
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckPassword(hash, "correct horse") {
+		t.Fatal("expected the password to match")
+	}
+	if CheckPassword(hash, "battery staple") || CheckPassword("", "correct horse") {
+		t.Fatal("expected a wrong password to fail")
+	}
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LastUsedGranularity is how stale the last use of an API key may get. Busy
+// keys would otherwise cost a write on every request.
+const LastUsedGranularity = time.Minute
+
+// ValidateAPIKey checks the fields every stored API key must have.
+func ValidateAPIKey(key *models.APIKey) error {
+	if strings.TrimSpace(key.Name) == "" {
+		return &ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if len(key.Scopes) == 0 {
+		return &ValidationError{Field: "scopes", Message: "must not be empty"}
+	}
+	for _, scope := range key.Scopes {
+		if !scope.Valid() {
+			return &ValidationError{Field: "scopes", Message: "must be posts:read or posts:write"}
+		}
+	}
+	if key.RateLimit < 0 {
+		return &ValidationError{Field: "rate_limit", Message: "must not be negative"}
+	}
+	if key.Hash == "" {
+		return &ValidationError{Field: "hash", Message: "must not be empty"}
+	}
+	return nil
+}
+
+func (s *service) getAPIKeys() *mongo.Collection {
+	return s.db.Database(database).Collection("api_keys")
+}
+
+func (s *service) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if err := ValidateAPIKey(key); err != nil {
+		return err
+	}
+
+	key.ID = primitive.NewObjectID()
+	key.CreatedAt = time.Now()
+
+	if _, err := s.getAPIKeys().InsertOne(ctx, key); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("error creating API key: %w", ErrConflict)
+		}
+		return fmt.Errorf("error creating API key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	//time descending (newest first)
+	cursor, err := s.getAPIKeys().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching API keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	keys := []*models.APIKey{}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("error decoding API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *service) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var key models.APIKey
+	if err := s.getAPIKeys().FindOne(ctx, bson.M{"hash": hash}).Decode(&key); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("error fetching API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (s *service) RotateAPIKey(ctx context.Context, id string, prefix string, hash string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	var key models.APIKey
+	err = s.getAPIKeys().FindOneAndUpdate(ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"prefix": prefix, "hash": hash, "rotated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("error rotating API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (s *service) DeleteAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return InvalidIDError(err)
+	}
+
+	result, err := s.getAPIKeys().DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return fmt.Errorf("error deleting API key: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *service) TouchAPIKey(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// Only write when the recorded use is older than the granularity. A
+	// null query value matches a missing field too.
+	filter := bson.M{"_id": id, "$or": bson.A{
+		bson.M{"last_used_at": nil},
+		bson.M{"last_used_at": bson.M{"$lt": at.Add(-LastUsedGranularity)}},
+	}}
+	if _, err := s.getAPIKeys().UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_used_at": at}}); err != nil {
+		return fmt.Errorf("error recording API key use: %w", err)
+	}
+
+	return nil
+}
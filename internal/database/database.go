@@ -2,10 +2,14 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strings"
 	"test-news/internal/database/models"
+	"test-news/internal/env"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -17,12 +21,65 @@ import (
 )
 
 type Service interface {
-	Health() map[string]string
-	GetPosts() ([]*models.Post, error)
-	CreatePost(post *models.Post) error
-	GetPost(id string) (*models.Post, error)
-	UpdatePost(id string, post *models.Post) error
-	DeletePost(id string) error
+	Health(ctx context.Context) map[string]string
+	GetPosts(ctx context.Context) ([]*models.Post, error)
+	ListPosts(ctx context.Context, opts ListOptions) (*PostPage, error)
+	SearchPosts(ctx context.Context, query string, limit int, filter PostFilter) ([]*SearchResult, error)
+	CreatePost(ctx context.Context, post *models.Post) error
+	GetPost(ctx context.Context, id string) (*models.Post, error)
+	UpdatePost(ctx context.Context, id string, version int64, post *models.Post) (*models.Post, error)
+	PatchPost(ctx context.Context, id string, version int64, patch PostPatch) (*models.Post, error)
+	// DeletePost moves a post to the trash. Trashed posts are hidden from
+	// every other method until RestorePost brings them back, and are listed
+	// with ListOptions.Trashed.
+	DeletePost(ctx context.Context, id string) error
+	RestorePost(ctx context.Context, id string) (*models.Post, error)
+	// GetTrashedPost returns a post in the trash, failing with
+	// ErrPostNotFound for any other post.
+	GetTrashedPost(ctx context.Context, id string) (*models.Post, error)
+	// PurgeDeleted permanently removes the posts trashed before the given
+	// time, together with their history, and returns how many it removed.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+
+	// TransitionPost moves a post from one state of the Workflow to another,
+	// logging the change with the editor found in the context. It fails
+	// with ErrStatusChanged when the post is no longer in update.From.
+	TransitionPost(ctx context.Context, id string, update StatusUpdate) (*models.Post, error)
+	ListStatusChanges(ctx context.Context, postID string) ([]*models.StatusChange, error)
+	// DuePosts returns up to limit posts whose schedule says they should
+	// change status by now, see Due.
+	DuePosts(ctx context.Context, now time.Time, limit int) ([]*models.Post, error)
+
+	// Every update saves the replaced state of the post as a revision,
+	// crediting the editor found in the context, see WithEditor.
+	ListRevisions(ctx context.Context, postID string) ([]*models.Revision, error)
+	GetRevision(ctx context.Context, postID string, version int64) (*models.Revision, error)
+
+	// CreateUser stores a new user, normalizing the username first, and
+	// fails with ErrUsernameTaken when it is in use.
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	// ListUsers returns every user, ordered by username.
+	ListUsers(ctx context.Context) ([]*models.User, error)
+	SetUserRole(ctx context.Context, id string, role models.Role) (*models.User, error)
+
+	// API keys are looked up by the hash of their secret, which is all that
+	// is stored. RotateAPIKey replaces the secret of a key.
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	ListAPIKeys(ctx context.Context) ([]*models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	RotateAPIKey(ctx context.Context, id string, prefix string, hash string) (*models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, id string) error
+	// TouchAPIKey records that a key was used at the given time, at most
+	// once per LastUsedGranularity.
+	TouchAPIKey(ctx context.Context, id primitive.ObjectID, at time.Time) error
+
+	// Sessions of the web UI are looked up by the hash of their cookie
+	// token. Expired sessions are returned too, callers check Expired.
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSessionByHash(ctx context.Context, hash string) (*models.Session, error)
+	DeleteSession(ctx context.Context, id primitive.ObjectID) error
 }
 
 type service struct {
@@ -35,6 +92,11 @@ var (
 	username = os.Getenv("BLUEPRINT_DB_USERNAME")
 	password = os.Getenv("BLUEPRINT_DB_ROOT_PASSWORD")
 	database = "news_feed" // Default database name, can be overridden with env var
+
+	// Per-operation timeouts, each can be overridden with a duration such as "3s"
+	healthTimeout = 1 * time.Second  // BLUEPRINT_DB_HEALTH_TIMEOUT
+	listTimeout   = 10 * time.Second // BLUEPRINT_DB_LIST_TIMEOUT
+	queryTimeout  = 5 * time.Second  // BLUEPRINT_DB_QUERY_TIMEOUT
 )
 
 func init() {
@@ -46,6 +108,10 @@ func init() {
 	if dbName := os.Getenv("BLUEPRINT_DB_DATABASE"); dbName != "" {
 		database = dbName
 	}
+
+	healthTimeout = env.Duration("BLUEPRINT_DB_HEALTH_TIMEOUT", healthTimeout)
+	listTimeout = env.Duration("BLUEPRINT_DB_LIST_TIMEOUT", listTimeout)
+	queryTimeout = env.Duration("BLUEPRINT_DB_QUERY_TIMEOUT", queryTimeout)
 }
 
 func New() Service {
@@ -82,35 +148,66 @@ func New() Service {
 	}
 }
 
-func (s *service) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (s *service) Health(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
 	defer cancel()
 
-	err := s.db.Ping(ctx, nil)
-	if err != nil {
-		log.Fatalf("db down: %v", err)
+	// A failed ping only describes this request; the process keeps serving.
+	// The error is logged rather than returned, since /health is public.
+	if err := s.db.Ping(ctx, nil); err != nil {
+		log.Printf("db down: %v", err)
+		return map[string]string{
+			"status":  "down",
+			"message": "It's not healthy",
+		}
 	}
 
 	return map[string]string{
+		"status":  "up",
 		"message": "It's healthy",
 	}
 }
 
+// ValidatePost checks the fields every backend requires before storing a post.
+func ValidatePost(post *models.Post) error {
+	if strings.TrimSpace(post.Title) == "" {
+		return &ValidationError{Field: "title", Message: "must not be empty"}
+	}
+	if strings.TrimSpace(post.Content) == "" {
+		return &ValidationError{Field: "content", Message: "must not be empty"}
+	}
+	if post.HeroImage != nil && post.HeroImage.Key == "" {
+		return &ValidationError{Field: "hero_image", Message: "must name an uploaded file"}
+	}
+	return validateMedia(post.Media)
+}
+
+// validateMedia checks that every inline media names an uploaded file.
+func validateMedia(media []models.Media) error {
+	for _, m := range media {
+		if m.Key == "" {
+			return &ValidationError{Field: "media", Message: "must name uploaded files"}
+		}
+	}
+	return nil
+}
+
 func (s *service) getCollection() *mongo.Collection {
 	return s.db.Database(database).Collection("posts")
 }
 
-func (s *service) GetPosts() ([]*models.Post, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *service) GetPosts(ctx context.Context) ([]*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
 	defer cancel()
 
 	collection := s.getCollection()
 
-	//time descending (newest first)
+	//time descending (newest first), leaving out the trash. A null query
+	//value matches a missing field too.
 	findOptions := options.Find()
 	findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
 
-	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	cursor, err := collection.Find(ctx, bson.M{"deleted_at": nil}, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching posts: %w", err)
 	}
@@ -124,10 +221,195 @@ func (s *service) GetPosts() ([]*models.Post, error) {
 	return posts, nil
 }
 
-func (s *service) CreatePost(post *models.Post) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) ListPosts(ctx context.Context, opts ListOptions) (*PostPage, error) {
+	cursor, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	collection := s.getCollection()
+
+	filter := postFilter(opts.Filter)
+	if opts.Trashed {
+		filter["deleted_at"] = bson.M{"$ne": nil}
+	} else {
+		filter["deleted_at"] = nil
+	}
+	query := filter
+	order := -1
+	if opts.Sort.Asc {
+		order = 1
+	}
+	if cursor != nil {
+		query = bson.M{"$and": bson.A{filter, keysetFilter(cursor)}}
+		if cursor.Backward {
+			order = -order
+		}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: string(opts.Sort.Field), Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(int64(opts.Limit + 1))
+
+	results, err := collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching posts: %w", err)
+	}
+	defer results.Close(ctx)
+
+	var posts []*models.Post
+	if err = results.All(ctx, &posts); err != nil {
+		return nil, fmt.Errorf("error decoding posts: %w", err)
+	}
+
+	page := NewPostPage(posts, opts, cursor)
+
+	if opts.WithTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("error counting posts: %w", err)
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func (s *service) SearchPosts(ctx context.Context, query string, limit int, filter PostFilter) ([]*SearchResult, error) {
+	terms, err := PrepareSearch(query, &limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	collection := s.getCollection()
+
+	score := bson.M{"$meta": "textScore"}
+	findOptions := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit))
+
+	match := postFilter(filter)
+	match["$text"] = bson.M{"$search": query}
+	match["deleted_at"] = nil
+
+	cursor, err := collection.Find(ctx, match, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error searching posts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		models.Post `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("error decoding posts: %w", err)
+	}
+
+	results := make([]*SearchResult, 0, len(docs))
+	for i := range docs {
+		post := docs[i].Post
+		results = append(results, &SearchResult{
+			Post:    &post,
+			Score:   docs[i].Score,
+			Snippet: Highlight(post.Content, terms),
+		})
+	}
+
+	return results, nil
+}
+
+// PrepareSearch validates a search query and limit, defaulting the limit, and
+// returns the terms to highlight.
+func PrepareSearch(query string, limit *int) ([]string, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, &ValidationError{Field: "q", Message: "must contain at least one word"}
+	}
+
+	if *limit == 0 {
+		*limit = DefaultPageLimit
+	}
+	if *limit < 1 || *limit > MaxPageLimit {
+		return nil, &ValidationError{Field: "limit", Message: "must be between 1 and 100"}
+	}
+
+	return terms, nil
+}
+
+// postFilter translates a PostFilter into a Mongo query document.
+func postFilter(f PostFilter) bson.M {
+	filter := bson.M{}
+	if f.Author != "" {
+		filter["author"] = f.Author
+	}
+	if !f.AuthorID.IsZero() {
+		filter["author_id"] = f.AuthorID
+	}
+	if f.TitlePrefix != "" {
+		filter["title"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.TitlePrefix), Options: "i"}
+	}
+	if len(f.Created) > 0 {
+		filter["created_at"] = timeRange(f.Created)
+	}
+	if len(f.Updated) > 0 {
+		filter["updated_at"] = timeRange(f.Updated)
+	}
+	if len(f.Status) > 0 {
+		filter["status"] = bson.M{"$in": f.Status}
+	}
+	if !f.UnpublishedBy.IsZero() {
+		filter["$or"] = bson.A{
+			bson.M{"status": models.StatusPublished},
+			bson.M{"author_id": f.UnpublishedBy},
+		}
+	}
+	return filter
+}
+
+func timeRange(bounds []TimeBound) bson.M {
+	r := bson.M{}
+	for _, b := range bounds {
+		r["$"+string(b.Op)] = b.Value
+	}
+	return r
+}
+
+// keysetFilter matches the posts that come after the cursor in its
+// direction of travel.
+func keysetFilter(c *Cursor) bson.M {
+	// Walking forward through a descending listing, or backward through an
+	// ascending one, means looking for smaller values.
+	op := "$gt"
+	if c.Asc == c.Backward {
+		op = "$lt"
+	}
+
+	field := string(c.Sort)
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: c.Value()}},
+		bson.M{field: c.Value(), "_id": bson.M{op: c.ID}},
+	}}
+}
+
+func (s *service) CreatePost(ctx context.Context, post *models.Post) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
+	if err := ValidatePost(post); err != nil {
+		return err
+	}
+
 	collection := s.getCollection()
 
 	now := time.Now()
@@ -135,31 +417,36 @@ func (s *service) CreatePost(post *models.Post) error {
 	post.UpdatedAt = now
 
 	post.ID = primitive.NewObjectID()
+	post.Version = 1
+	post.Status = models.StatusDraft
 
 	_, err := collection.InsertOne(ctx, post)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("error creating post: %w", ErrConflict)
+		}
 		return fmt.Errorf("error creating post: %w", err)
 	}
 
 	return nil
 }
 
-func (s *service) GetPost(id string) (*models.Post, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *service) GetPost(ctx context.Context, id string) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
 	collection := s.getCollection()
 
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid ID format: %w", err)
+		return nil, InvalidIDError(err)
 	}
 
 	var post models.Post
-	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&post)
+	err = collection.FindOne(ctx, bson.M{"_id": objectID, "deleted_at": nil}).Decode(&post)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("post not found")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrPostNotFound
 		}
 		return nil, fmt.Errorf("error fetching post: %w", err)
 	}
@@ -167,61 +454,114 @@ func (s *service) GetPost(id string) (*models.Post, error) {
 	return &post, nil
 }
 
-func (s *service) UpdatePost(id string, post *models.Post) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// UpdatePost replaces the editable fields of a post and returns the result.
+// The ID and created_at are kept from the stored post. The update only
+// happens if the stored version equals version, unless it is AnyVersion.
+func (s *service) UpdatePost(ctx context.Context, id string, version int64, post *models.Post) (*models.Post, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	if err := ValidatePost(post); err != nil {
+		return nil, err
+	}
+
+	return s.PatchPost(ctx, id, version, PatchFromPost(post))
+}
+
+// PatchPost changes only the fields set in patch and returns the result,
+// in a single atomic round trip. Like UpdatePost it is conditional on the
+// stored version.
+func (s *service) PatchPost(ctx context.Context, id string, version int64, patch PostPatch) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
 	collection := s.getCollection()
 
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return fmt.Errorf("invalid ID format: %w", err)
+		return nil, InvalidIDError(err)
 	}
 
-	// Update the modification time
-	post.UpdatedAt = time.Now()
-
-	// don't change the original ID
-	post.ID = objectID
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
 
-	update := bson.M{
-		"$set": post,
+	filter := bson.M{"_id": objectID, "deleted_at": nil}
+	if version != AnyVersion {
+		filter["version"] = version
 	}
 
-	_, err = collection.UpdateOne(
+	// Update the modification time, at the precision Mongo stores
+	now := time.Now().Truncate(time.Millisecond)
+	set := bson.M(patch.set())
+	set["updated_at"] = now
+
+	// Taking the document as it was before the update gives the revision
+	// to save, and the updated post follows from it without another read.
+	var previous models.Post
+	err = collection.FindOneAndUpdate(
 		ctx,
-		bson.M{"_id": objectID},
-		update,
-	)
+		filter,
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&previous)
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return fmt.Errorf("post not found")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, s.missOrMismatch(ctx, objectID, ErrVersionMismatch)
 		}
-		return fmt.Errorf("error updating post: %w", err)
+		return nil, fmt.Errorf("error updating post: %w", err)
 	}
 
-	return nil
+	// The update has been applied at this point, so failing to record the
+	// revision must not turn it into an error the client would retry.
+	if err := s.saveRevision(ctx, models.NewRevision(&previous, EditorFrom(ctx), now)); err != nil {
+		log.Printf("Failed to save revision %d of post %s: %v", previous.Version, previous.ID.Hex(), err)
+	}
+
+	updated := previous
+	patch.Apply(&updated)
+	updated.UpdatedAt = now
+	updated.Version++
+
+	return &updated, nil
 }
 
-func (s *service) DeletePost(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// missOrMismatch tells apart the two reasons a conditional update can match
+// nothing: the post is gone, or it moved on and the mismatch error applies.
+func (s *service) missOrMismatch(ctx context.Context, objectID primitive.ObjectID, mismatch error) error {
+	n, err := s.getCollection().CountDocuments(ctx, bson.M{"_id": objectID, "deleted_at": nil}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("error updating post: %w", err)
+	}
+	if n == 0 {
+		return ErrPostNotFound
+	}
+	return mismatch
+}
+
+func (s *service) DeletePost(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
 	collection := s.getCollection()
 
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return fmt.Errorf("invalid ID format: %w", err)
+		return InvalidIDError(err)
 	}
 
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+	)
 	if err != nil {
 		return fmt.Errorf("error deleting post: %w", err)
 	}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("post not found")
+	if result.MatchedCount == 0 {
+		return ErrPostNotFound
 	}
 
 	return nil
@@ -2,12 +2,19 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
+	"strings"
 	"test-news/internal/database/models"
 	"testing"
+	"time"
 
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func mustStartMongoContainer() (func(context.Context, ...testcontainers.TerminateOption) error, error) {
@@ -43,6 +50,11 @@ func TestMain(m *testing.M) {
 	password = ""
 	database = "testdb"
 
+	// Search relies on the text index created by the migrations.
+	if _, err := New().(Migrator).Migrate(context.Background()); err != nil {
+		log.Fatalf("could not migrate the test database: %v", err)
+	}
+
 	m.Run()
 
 	if teardown != nil && teardown(context.Background()) != nil {
@@ -60,17 +72,34 @@ func TestNew(t *testing.T) {
 func TestHealth(t *testing.T) {
 	srv := New()
 
-	stats := srv.Health()
+	stats := srv.Health(context.Background())
 
 	if stats["message"] != "It's healthy" {
 		t.Fatalf("expected message to be 'It's healthy', got %s", stats["message"])
 	}
 }
 
+func TestHealthDown(t *testing.T) {
+	srv := New()
+
+	// A ping that can't complete reports the database down, without the
+	// error, which only goes to the log.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats := srv.Health(ctx)
+
+	if stats["status"] != "down" {
+		t.Fatalf("expected status to be 'down', got %s", stats["status"])
+	}
+	if _, ok := stats["error"]; ok {
+		t.Fatalf("expected no error in the report, got %v", stats)
+	}
+}
+
 func TestGetPosts(t *testing.T) {
 	srv := New()
 
-	posts, err := srv.GetPosts()
+	posts, err := srv.GetPosts(context.Background())
 	if err != nil {
 		t.Fatalf("GetPosts() returned an error: %v", err)
 	}
@@ -88,7 +117,7 @@ func TestCreatePost(t *testing.T) {
 		Content: "This is a test post",
 	}
 
-	err := srv.CreatePost(post)
+	err := srv.CreatePost(context.Background(), post)
 	if err != nil {
 		t.Fatalf("CreatePost() returned an error: %v", err)
 	}
@@ -106,12 +135,12 @@ func TestGetPostByID(t *testing.T) {
 		Content: "This is a test post",
 	}
 
-	err := srv.CreatePost(post)
+	err := srv.CreatePost(context.Background(), post)
 	if err != nil {
 		t.Fatalf("CreatePost() returned an error: %v", err)
 	}
 
-	fetchedPost, err := srv.GetPost(post.ID.Hex())
+	fetchedPost, err := srv.GetPost(context.Background(), post.ID.Hex())
 
 	if err != nil {
 		t.Fatalf("GetPostByID() returned an error: %v", err)
@@ -129,12 +158,21 @@ func TestGetPostByID(t *testing.T) {
 func TestGetPostByInvalidID(t *testing.T) {
 	srv := New()
 
-	_, err := srv.GetPost("invalid_id")
+	_, err := srv.GetPost(context.Background(), "invalid_id")
 
 	if err == nil {
 		t.Fatal("expected error for invalid ID, got nil")
 	}
 }
+func TestGetPostNotFound(t *testing.T) {
+	srv := New()
+
+	_, err := srv.GetPost(context.Background(), primitive.NewObjectID().Hex())
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
 func TestUpdatePost(t *testing.T) {
 	srv := New()
 
@@ -143,18 +181,18 @@ func TestUpdatePost(t *testing.T) {
 		Content: "This is a test post",
 	}
 
-	err := srv.CreatePost(post)
+	err := srv.CreatePost(context.Background(), post)
 	if err != nil {
 		t.Fatalf("CreatePost() returned an error: %v", err)
 	}
 
 	post.Title = "Updated Title"
-	err = srv.UpdatePost(post.ID.Hex(), post)
+	_, err = srv.UpdatePost(context.Background(), post.ID.Hex(), AnyVersion, post)
 	if err != nil {
 		t.Fatalf("UpdatePost() returned an error: %v", err)
 	}
 
-	fetchedPost, err := srv.GetPost(post.ID.Hex())
+	fetchedPost, err := srv.GetPost(context.Background(), post.ID.Hex())
 	if err != nil {
 		t.Fatalf("GetPostByID() returned an error: %v", err)
 	}
@@ -172,13 +210,13 @@ func TestUpdatePostInvalidID(t *testing.T) {
 		Content: "This is a test post",
 	}
 
-	err := srv.CreatePost(post)
+	err := srv.CreatePost(context.Background(), post)
 	if err != nil {
 		t.Fatalf("CreatePost() returned an error: %v", err)
 	}
 
 	post.Title = "Updated Title"
-	err = srv.UpdatePost("invalid_id", post)
+	_, err = srv.UpdatePost(context.Background(), "invalid_id", AnyVersion, post)
 	if err == nil {
 		t.Fatal("expected error for invalid ID, got nil")
 	}
@@ -191,17 +229,17 @@ func TestDeletePost(t *testing.T) {
 		Content: "This is a test post",
 	}
 
-	err := srv.CreatePost(post)
+	err := srv.CreatePost(context.Background(), post)
 	if err != nil {
 		t.Fatalf("CreatePost() returned an error: %v", err)
 	}
 
-	err = srv.DeletePost(post.ID.Hex())
+	err = srv.DeletePost(context.Background(), post.ID.Hex())
 	if err != nil {
 		t.Fatalf("DeletePost() returned an error: %v", err)
 	}
 
-	_, err = srv.GetPost(post.ID.Hex())
+	_, err = srv.GetPost(context.Background(), post.ID.Hex())
 	if err == nil {
 		t.Fatal("expected error for deleted post, got nil")
 	}
@@ -215,13 +253,624 @@ func TestDeletePostInvalidID(t *testing.T) {
 		Content: "This is a test post",
 	}
 
-	err := srv.CreatePost(post)
+	err := srv.CreatePost(context.Background(), post)
 	if err != nil {
 		t.Fatalf("CreatePost() returned an error: %v", err)
 	}
 
-	err = srv.DeletePost("invalid_id")
+	err = srv.DeletePost(context.Background(), "invalid_id")
 	if err == nil {
 		t.Fatal("expected error for invalid ID, got nil")
 	}
 }
+
+func TestTrash(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Trashed", Content: "Trashed content"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+	title := "Trashed v2"
+	if _, err := srv.PatchPost(ctx, post.ID.Hex(), 1, PostPatch{Title: &title}); err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+
+	if err := srv.DeletePost(ctx, post.ID.Hex()); err != nil {
+		t.Fatalf("DeletePost() returned an error: %v", err)
+	}
+	if err := srv.DeletePost(ctx, post.ID.Hex()); !errors.Is(err, ErrPostNotFound) {
+		t.Fatalf("expected ErrPostNotFound for a trashed post, got %v", err)
+	}
+
+	page, err := srv.ListPosts(ctx, ListOptions{Trashed: true, Filter: PostFilter{TitlePrefix: "Trashed"}})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].DeletedAt == nil {
+		t.Fatalf("expected the post in the trash, got %+v", page.Posts)
+	}
+	if _, err := srv.GetTrashedPost(ctx, post.ID.Hex()); err != nil {
+		t.Fatalf("GetTrashedPost() returned an error: %v", err)
+	}
+
+	if _, err := srv.RestorePost(ctx, post.ID.Hex()); err != nil {
+		t.Fatalf("RestorePost() returned an error: %v", err)
+	}
+	if _, err := srv.GetPost(ctx, post.ID.Hex()); err != nil {
+		t.Fatalf("expected the restored post to be readable, got %v", err)
+	}
+
+	if err := srv.DeletePost(ctx, post.ID.Hex()); err != nil {
+		t.Fatalf("DeletePost() returned an error: %v", err)
+	}
+	n, err := srv.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("PurgeDeleted() returned an error: %v", err)
+	}
+	if n < 1 {
+		t.Fatalf("expected the post to be purged, purged %d", n)
+	}
+	if _, err := srv.GetRevision(ctx, post.ID.Hex(), 1); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("expected the revisions to be purged, got %v", err)
+	}
+}
+
+func TestTransitionPost(t *testing.T) {
+	srv := New()
+	ctx := WithEditor(context.Background(), "erin")
+
+	post := &models.Post{Title: "Workflow", Content: "Workflow content"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	published, err := srv.TransitionPost(ctx, post.ID.Hex(), StatusUpdate{From: models.StatusDraft, To: models.StatusPublished})
+	if err != nil {
+		t.Fatalf("TransitionPost() returned an error: %v", err)
+	}
+	if published.Status != models.StatusPublished || published.Version != 2 {
+		t.Fatalf("unexpected post: %+v", published)
+	}
+
+	// The version a transition replaces is kept like that of any update.
+	revision, err := srv.GetRevision(ctx, post.ID.Hex(), 1)
+	if err != nil {
+		t.Fatalf("GetRevision() returned an error: %v", err)
+	}
+	if revision.Status != models.StatusDraft || revision.Title != post.Title || revision.Editor != "erin" {
+		t.Fatalf("unexpected revision: %+v", revision)
+	}
+
+	_, err = srv.TransitionPost(ctx, post.ID.Hex(), StatusUpdate{From: models.StatusDraft, To: models.StatusInReview})
+	if !errors.Is(err, ErrStatusChanged) {
+		t.Fatalf("expected ErrStatusChanged, got %v", err)
+	}
+
+	changes, err := srv.ListStatusChanges(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("ListStatusChanges() returned an error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].To != models.StatusPublished || changes[0].Actor != "erin" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+}
+
+func TestScheduledPosts(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+	now := time.Now()
+
+	post := &models.Post{Title: "Scheduled", Content: "Scheduled content"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	publishAt, unpublishAt := now.Add(time.Hour), now.Add(2*time.Hour)
+	if _, err := srv.TransitionPost(ctx, post.ID.Hex(), StatusUpdate{From: models.StatusDraft, To: models.StatusScheduled, PublishAt: &publishAt, UnpublishAt: &unpublishAt}); err != nil {
+		t.Fatalf("TransitionPost() returned an error: %v", err)
+	}
+
+	due, err := srv.DuePosts(ctx, publishAt, 100)
+	if err != nil {
+		t.Fatalf("DuePosts() returned an error: %v", err)
+	}
+	found := false
+	for _, p := range due {
+		found = found || p.ID == post.ID
+	}
+	if !found {
+		t.Fatal("expected the scheduled post to be due")
+	}
+
+	published, err := srv.TransitionPost(ctx, post.ID.Hex(), StatusUpdate{From: models.StatusScheduled, To: models.StatusPublished})
+	if err != nil {
+		t.Fatalf("TransitionPost() returned an error: %v", err)
+	}
+	if published.PublishAt != nil || published.UnpublishAt == nil {
+		t.Fatalf("unexpected schedule after publishing: %+v", published)
+	}
+}
+
+func TestLease(t *testing.T) {
+	srv := New().(Leaser)
+	ctx := context.Background()
+
+	ok, err := srv.AcquireLease(ctx, "test", "first", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected to acquire a free lease, got %v, %v", ok, err)
+	}
+	if ok, _ := srv.AcquireLease(ctx, "test", "second", time.Minute); ok {
+		t.Fatal("expected a held lease to be refused")
+	}
+	if ok, _ := srv.AcquireLease(ctx, "test", "first", time.Minute); !ok {
+		t.Fatal("expected the holder to renew its lease")
+	}
+
+	if err := srv.ReleaseLease(ctx, "test", "first"); err != nil {
+		t.Fatalf("ReleaseLease() returned an error: %v", err)
+	}
+	if ok, _ := srv.AcquireLease(ctx, "test", "second", time.Millisecond); !ok {
+		t.Fatal("expected a released lease to be free")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ok, _ := srv.AcquireLease(ctx, "test", "first", time.Minute); !ok {
+		t.Fatal("expected an expired lease to be free")
+	}
+}
+
+func TestListPosts(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		post := &models.Post{
+			Title:   "Paged Post",
+			Content: "This is a paged post",
+		}
+		if err := srv.CreatePost(ctx, post); err != nil {
+			t.Fatalf("CreatePost() returned an error: %v", err)
+		}
+	}
+
+	first, err := srv.ListPosts(ctx, ListOptions{Limit: 2, WithTotal: true})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(first.Posts) != 2 || first.NextCursor == "" {
+		t.Fatalf("expected a full first page with a next cursor, got %d posts", len(first.Posts))
+	}
+	if first.Total == nil || *first.Total < 3 {
+		t.Fatalf("expected a total of at least 3, got %v", first.Total)
+	}
+
+	second, err := srv.ListPosts(ctx, ListOptions{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	for _, p := range second.Posts {
+		if p.ID == first.Posts[0].ID || p.ID == first.Posts[1].ID {
+			t.Fatal("second page repeated a post from the first page")
+		}
+	}
+	if second.PrevCursor == "" {
+		t.Fatal("expected the second page to have a previous cursor")
+	}
+}
+
+func TestListPostsFilterAndSort(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	for _, title := range []string{"Filter b", "filter a", "Other"} {
+		post := &models.Post{Title: title, Content: "content", Author: "filter-author"}
+		if err := srv.CreatePost(ctx, post); err != nil {
+			t.Fatalf("CreatePost() returned an error: %v", err)
+		}
+	}
+
+	page, err := srv.ListPosts(ctx, ListOptions{
+		WithTotal: true,
+		Filter:    PostFilter{Author: "filter-author", TitlePrefix: "FILTER"},
+		Sort:      Sort{Field: SortTitle, Asc: true},
+	})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+
+	if page.Total == nil || *page.Total != 2 {
+		t.Fatalf("expected 2 matching posts, got %v", page.Total)
+	}
+	if page.Posts[0].Title != "Filter b" || page.Posts[1].Title != "filter a" {
+		t.Fatalf("expected byte order by title, got %q, %q", page.Posts[0].Title, page.Posts[1].Title)
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Volcano erupts", Content: "Ash clouds grounded flights across the region."}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	results, err := srv.SearchPosts(ctx, "volcano", 10, PostFilter{})
+	if err != nil {
+		t.Fatalf("SearchPosts() returned an error: %v", err)
+	}
+
+	if len(results) == 0 || results[0].Post.ID != post.ID {
+		t.Fatal("expected the volcano post to be the top result")
+	}
+	if results[0].Score <= 0 {
+		t.Fatalf("expected a positive score, got %f", results[0].Score)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	migrator := New().(Migrator)
+	ctx := context.Background()
+
+	// TestMain already applied everything, so a second run is a no-op.
+	applied, err := migrator.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate() returned an error: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected no pending migrations, applied %d", len(applied))
+	}
+
+	states, err := migrator.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus() returned an error: %v", err)
+	}
+	for _, state := range states {
+		if state.AppliedAt.IsZero() {
+			t.Fatalf("migration %d is still pending", state.Version)
+		}
+	}
+
+	if err := migrator.CheckIndexes(ctx); err != nil {
+		t.Fatalf("CheckIndexes() returned an error: %v", err)
+	}
+
+	// An index with the right name but another definition is reported too.
+	users := New().(*service).db.Database(database).Collection("users")
+	if _, err := users.Indexes().DropOne(ctx, "users_username"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetName("users_username"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	err = migrator.CheckIndexes(ctx)
+	if err == nil || !strings.Contains(err.Error(), "users.users_username differs in uniqueness") {
+		t.Fatalf("expected the changed index to be reported, got %v", err)
+	}
+
+	if _, err := users.Indexes().DropOne(ctx, "users_username"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations[6].run(ctx, users.Database()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexSpecDiff(t *testing.T) {
+	declared := declaredIndexes()
+	text := declared["posts"]["posts_text"]
+	sessions := declared["sessions"]["sessions_expires_at"]
+	zero := int64(0)
+
+	tests := []struct {
+		name  string
+		spec  indexSpec
+		model mongo.IndexModel
+		want  string
+	}{
+		{
+			name:  "same keys",
+			spec:  indexSpec{Key: bson.D{{Key: "created_at", Value: int32(-1)}, {Key: "_id", Value: float64(-1)}}},
+			model: declared["posts"]["posts_created_at"],
+		},
+		{
+			name:  "keys in another order",
+			spec:  indexSpec{Key: bson.D{{Key: "_id", Value: -1}, {Key: "created_at", Value: -1}}},
+			model: declared["posts"]["posts_created_at"],
+			want:  "has other keys",
+		},
+		{
+			name:  "text weights",
+			spec:  indexSpec{Key: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: 1}}, Weights: bson.D{{Key: "content", Value: int32(2)}, {Key: "title", Value: int32(10)}}},
+			model: text,
+		},
+		{
+			name:  "other text weights",
+			spec:  indexSpec{Key: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: 1}}, Weights: bson.D{{Key: "content", Value: 1}, {Key: "title", Value: 1}}},
+			model: text,
+			want:  "has other text fields or weights",
+		},
+		{
+			name:  "not unique",
+			spec:  indexSpec{Key: bson.D{{Key: "username", Value: 1}}},
+			model: declared["users"]["users_username"],
+			want:  "differs in uniqueness",
+		},
+		{
+			name:  "expiry",
+			spec:  indexSpec{Key: bson.D{{Key: "expires_at", Value: 1}}, ExpireAfterSeconds: &zero},
+			model: sessions,
+		},
+		{
+			name:  "no expiry",
+			spec:  indexSpec{Key: bson.D{{Key: "expires_at", Value: 1}}},
+			model: sessions,
+			want:  "differs in expiry",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.spec.diff(tt.model); got != tt.want {
+			t.Errorf("%s: diff() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPatchPost(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Patch me", Content: "Original content", Author: "jane"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	title := "Patched"
+	patched, err := srv.PatchPost(ctx, post.ID.Hex(), AnyVersion, PostPatch{Title: &title})
+	if err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+
+	if patched.Title != "Patched" || patched.Content != "Original content" {
+		t.Fatalf("unexpected patched post: %+v", patched)
+	}
+	if !patched.CreatedAt.Equal(post.CreatedAt.Truncate(time.Millisecond)) {
+		t.Fatalf("expected created_at to be kept, got %s", patched.CreatedAt)
+	}
+
+	_, err = srv.PatchPost(ctx, primitive.NewObjectID().Hex(), AnyVersion, PostPatch{Title: &title})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPostMedia(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	post := &models.Post{
+		Title:     "Pictured",
+		Content:   "body",
+		Author:    "jane",
+		HeroImage: &models.Media{Key: "hero.png", ContentType: "image/png", Alt: "The harbour"},
+	}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	inline := []models.Media{{Key: "one.jpg", ContentType: "image/jpeg", Caption: "At dawn"}}
+	if _, err := srv.PatchPost(ctx, post.ID.Hex(), AnyVersion, PostPatch{Media: &inline}); err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+
+	got, err := srv.GetPost(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetPost() returned an error: %v", err)
+	}
+	if got.HeroImage == nil || got.HeroImage.Alt != "The harbour" || len(got.Media) != 1 || got.Media[0].Caption != "At dawn" {
+		t.Fatalf("unexpected media: %+v", got)
+	}
+
+	if _, err := srv.PatchPost(ctx, post.ID.Hex(), AnyVersion, PostPatch{RemoveHeroImage: true}); err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+	got, err = srv.GetPost(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetPost() returned an error: %v", err)
+	}
+	if got.HeroImage != nil || len(got.Media) != 1 {
+		t.Fatalf("expected only the hero image to be removed: %+v", got)
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Versioned", Content: "Versioned content"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	title := "Versioned v2"
+	updated, err := srv.PatchPost(ctx, post.ID.Hex(), 1, PostPatch{Title: &title})
+	if err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("expected version 2, got %d", updated.Version)
+	}
+
+	_, err = srv.PatchPost(ctx, post.ID.Hex(), 1, PostPatch{Title: &title})
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expected ErrVersionMismatch, got %v", err)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	srv := New()
+	ctx := WithEditor(context.Background(), "alice")
+
+	hero := models.Media{Key: "hero.png", ContentType: "image/png", Alt: "A storm"}
+	post := &models.Post{Title: "Revised", Content: "Revised content", Author: "jane", HeroImage: &hero,
+		Media: []models.Media{{Key: "inline.png", ContentType: "image/png"}}}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	title := "Revised v2"
+	noMedia := []models.Media{}
+	if _, err := srv.PatchPost(ctx, post.ID.Hex(), 1, PostPatch{Title: &title, RemoveHeroImage: true, Media: &noMedia}); err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+
+	revisions, err := srv.ListRevisions(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("ListRevisions() returned an error: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Version != 1 || revisions[0].Title != "Revised" || revisions[0].Editor != "alice" {
+		t.Fatalf("unexpected revisions: %+v", revisions)
+	}
+
+	if _, err := srv.GetRevision(ctx, post.ID.Hex(), 2); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("expected ErrRevisionNotFound, got %v", err)
+	}
+
+	revision, err := srv.GetRevision(ctx, post.ID.Hex(), 1)
+	if err != nil {
+		t.Fatalf("GetRevision() returned an error: %v", err)
+	}
+	if revision.HeroImage == nil || *revision.HeroImage != hero || len(revision.Media) != 1 {
+		t.Fatalf("expected the media to be kept with the revision, got %+v", revision)
+	}
+
+	// Restoring the revision brings its media back.
+	restored, err := srv.PatchPost(ctx, post.ID.Hex(), 2, PatchFromRevision(revision))
+	if err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+	if restored.Title != "Revised" || restored.HeroImage == nil || *restored.HeroImage != hero || len(restored.Media) != 1 {
+		t.Fatalf("unexpected restored post: %+v", restored)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	user := &models.User{Username: "Mongo.Jane", Name: "Jane Doe", Role: models.RoleEditor, PasswordHash: "hash"}
+	if err := srv.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser() returned an error: %v", err)
+	}
+
+	found, err := srv.GetUserByUsername(ctx, "mongo.jane")
+	if err != nil {
+		t.Fatalf("GetUserByUsername() returned an error: %v", err)
+	}
+	if found.ID != user.ID || found.PasswordHash != "hash" {
+		t.Fatalf("unexpected user: %+v", found)
+	}
+	if _, err := srv.GetUser(ctx, user.ID.Hex()); err != nil {
+		t.Fatalf("GetUser() returned an error: %v", err)
+	}
+
+	// The unique index refuses a second account with the same username.
+	taken := &models.User{Username: "mongo.jane", Name: "Another Jane", Role: models.RoleWriter, PasswordHash: "hash"}
+	if err := srv.CreateUser(ctx, taken); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("expected ErrUsernameTaken, got %v", err)
+	}
+
+	if _, err := srv.GetUser(ctx, primitive.NewObjectID().Hex()); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	updated, err := srv.SetUserRole(ctx, user.ID.Hex(), models.RoleReader)
+	if err != nil {
+		t.Fatalf("SetUserRole() returned an error: %v", err)
+	}
+	if updated.Role != models.RoleReader {
+		t.Fatalf("expected the reader role, got %q", updated.Role)
+	}
+	users, err := srv.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers() returned an error: %v", err)
+	}
+	if len(users) == 0 {
+		t.Fatal("expected ListUsers() to return the user")
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	key := &models.APIKey{Name: "wire", Scopes: []models.Scope{models.ScopePostsWrite}, Prefix: "tn_1", Hash: "mongo-h1"}
+	if err := srv.CreateAPIKey(ctx, key); err != nil {
+		t.Fatalf("CreateAPIKey() returned an error: %v", err)
+	}
+
+	// The unique index refuses a second key with the same hash.
+	twin := &models.APIKey{Name: "twin", Scopes: []models.Scope{models.ScopePostsRead}, Prefix: "tn_1", Hash: "mongo-h1"}
+	if err := srv.CreateAPIKey(ctx, twin); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	if err := srv.TouchAPIKey(ctx, key.ID, time.Now()); err != nil {
+		t.Fatalf("TouchAPIKey() returned an error: %v", err)
+	}
+	found, err := srv.GetAPIKeyByHash(ctx, "mongo-h1")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash() returned an error: %v", err)
+	}
+	if found.ID != key.ID || found.LastUsedAt == nil {
+		t.Fatalf("unexpected key: %+v", found)
+	}
+
+	if _, err := srv.RotateAPIKey(ctx, key.ID.Hex(), "tn_2", "mongo-h2"); err != nil {
+		t.Fatalf("RotateAPIKey() returned an error: %v", err)
+	}
+	if _, err := srv.GetAPIKeyByHash(ctx, "mongo-h1"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("expected the old hash to be gone, got %v", err)
+	}
+
+	if err := srv.DeleteAPIKey(ctx, key.ID.Hex()); err != nil {
+		t.Fatalf("DeleteAPIKey() returned an error: %v", err)
+	}
+	if _, err := srv.GetAPIKeyByHash(ctx, "mongo-h2"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("expected the key to be deleted, got %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	session := &models.Session{UserID: primitive.NewObjectID(), Hash: "mongo-s1", CSRFToken: "c1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := srv.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession() returned an error: %v", err)
+	}
+
+	// The unique index refuses a second session with the same hash.
+	twin := &models.Session{UserID: session.UserID, Hash: "mongo-s1", CSRFToken: "c2", ExpiresAt: session.ExpiresAt}
+	if err := srv.CreateSession(ctx, twin); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	found, err := srv.GetSessionByHash(ctx, "mongo-s1")
+	if err != nil {
+		t.Fatalf("GetSessionByHash() returned an error: %v", err)
+	}
+	if found.ID != session.ID || found.UserID != session.UserID || found.CSRFToken != "c1" {
+		t.Fatalf("unexpected session: %+v", found)
+	}
+
+	if err := srv.DeleteSession(ctx, session.ID); err != nil {
+		t.Fatalf("DeleteSession() returned an error: %v", err)
+	}
+	if _, err := srv.GetSessionByHash(ctx, "mongo-s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected the session to be deleted, got %v", err)
+	}
+}
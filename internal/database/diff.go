@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"test-news/internal/database/models"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DiffVersions renders a unified diff between two versions of post, either
+// of which may be the current one.
+func DiffVersions(ctx context.Context, db Service, post *models.Post, from int64, to int64) (string, error) {
+	a, err := snapshot(ctx, db, post, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := snapshot(ctx, db, post, to)
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        revisionLines(a),
+		B:        revisionLines(b),
+		FromFile: fmt.Sprintf("version %d", from),
+		ToFile:   fmt.Sprintf("version %d", to),
+		Context:  3,
+	})
+}
+
+// snapshot returns the given version of post, which is either the post
+// itself or one of its saved revisions.
+func snapshot(ctx context.Context, db Service, post *models.Post, version int64) (*models.Revision, error) {
+	if version == post.Version {
+		return models.NewRevision(post, "", post.UpdatedAt), nil
+	}
+	return db.GetRevision(ctx, post.ID.Hex(), version)
+}
+
+// revisionLines lays a revision out as text, one line per field and media
+// followed by the content, so that a line diff reads naturally.
+func revisionLines(r *models.Revision) []string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Title: %s\nAuthor: %s\n", r.Title, r.Author)
+	if r.HeroImage != nil {
+		fmt.Fprintf(&b, "Hero image: %s\n", mediaLine(*r.HeroImage))
+	}
+	for _, m := range r.Media {
+		fmt.Fprintf(&b, "Media: %s\n", mediaLine(m))
+	}
+	fmt.Fprintf(&b, "\n%s\n", r.Content)
+	return difflib.SplitLines(b.String())
+}
+
+// mediaLine describes m by its key along with the text shown with it.
+func mediaLine(m models.Media) string {
+	line := m.Key
+	if m.Alt != "" {
+		line += fmt.Sprintf(" alt=%q", m.Alt)
+	}
+	if m.Caption != "" {
+		line += fmt.Sprintf(" caption=%q", m.Caption)
+	}
+	return line
+}
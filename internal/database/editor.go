@@ -0,0 +1,22 @@
+package database
+
+import "context"
+
+type editorKey struct{}
+
+// AnonymousEditor is recorded when a change carries no editor.
+const AnonymousEditor = "anonymous"
+
+// WithEditor returns a context recording who is making changes, which
+// backends store in the revision history.
+func WithEditor(ctx context.Context, editor string) context.Context {
+	return context.WithValue(ctx, editorKey{}, editor)
+}
+
+// EditorFrom returns the editor recorded by WithEditor.
+func EditorFrom(ctx context.Context) string {
+	if editor, ok := ctx.Value(editorKey{}).(string); ok && editor != "" {
+		return editor
+	}
+	return AnonymousEditor
+}
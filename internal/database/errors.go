@@ -0,0 +1,66 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned by every Service implementation. Callers should
+// match them with errors.Is, since they are usually wrapped with more context.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrInvalidID = errors.New("invalid ID format")
+	ErrConflict  = errors.New("conflict")
+)
+
+// ValidationError reports a field that failed validation before it reached
+// the database. Use errors.As to get at the field name.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ErrPostNotFound is returned when no post has the requested ID.
+var ErrPostNotFound = fmt.Errorf("post %w", ErrNotFound)
+
+// ErrRevisionNotFound is returned when a post has no such revision.
+var ErrRevisionNotFound = fmt.Errorf("revision %w", ErrNotFound)
+
+// ErrVersionMismatch is returned by conditional updates when the stored
+// version of a post is not the expected one. It matches ErrConflict too.
+var ErrVersionMismatch = fmt.Errorf("post version %w", ErrConflict)
+
+// ErrInvalidTransition is returned for a status change the workflow doesn't
+// allow from the current state of a post.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// ErrStatusChanged is returned when the status of a post changed while a
+// transition was in flight. It matches ErrConflict too.
+var ErrStatusChanged = fmt.Errorf("post status %w", ErrConflict)
+
+// ErrUserNotFound is returned when no user has the requested ID or username.
+var ErrUserNotFound = fmt.Errorf("user %w", ErrNotFound)
+
+// ErrUsernameTaken is returned when creating a user whose username is in
+// use. It matches ErrConflict too.
+var ErrUsernameTaken = fmt.Errorf("username %w", ErrConflict)
+
+// ErrAPIKeyNotFound is returned when no API key has the requested ID or
+// hash.
+var ErrAPIKeyNotFound = fmt.Errorf("API key %w", ErrNotFound)
+
+// ErrSessionNotFound is returned when no session has the requested ID or
+// hash.
+var ErrSessionNotFound = fmt.Errorf("session %w", ErrNotFound)
+
+// AnyVersion makes an update unconditional.
+const AnyVersion int64 = 0
+
+// InvalidIDError wraps ErrInvalidID together with the parse failure.
+func InvalidIDError(err error) error {
+	return fmt.Errorf("%w: %w", ErrInvalidID, err)
+}
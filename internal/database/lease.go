@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// leasesCollection holds one document per named lease.
+const leasesCollection = "leases"
+
+// Leaser hands out named, expiring leases, so that a job runs on only one of
+// several server instances sharing a database.
+type Leaser interface {
+	// AcquireLease takes the named lease for holder, or extends it when
+	// holder already has it, until ttl from now. It reports false while
+	// another holder has an unexpired lease.
+	AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives the lease up early if holder has it.
+	ReleaseLease(ctx context.Context, name string, holder string) error
+}
+
+func (s *service) getLeases() *mongo.Collection {
+	return s.db.Database(database).Collection(leasesCollection)
+}
+
+func (s *service) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	// Match the lease only if it is ours or has expired. When someone else
+	// holds it nothing matches, and the upsert fails on the duplicate _id.
+	filter := bson.M{"_id": name, "$or": bson.A{
+		bson.M{"holder": holder},
+		bson.M{"expires_at": bson.M{"$lte": now}},
+	}}
+	update := bson.M{"$set": bson.M{"holder": holder, "expires_at": now.Add(ttl)}}
+
+	_, err := s.getLeases().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error acquiring lease %s: %w", name, err)
+	}
+
+	return true, nil
+}
+
+func (s *service) ReleaseLease(ctx context.Context, name string, holder string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if _, err := s.getLeases().DeleteOne(ctx, bson.M{"_id": name, "holder": holder}); err != nil {
+		return fmt.Errorf("error releasing lease %s: %w", name, err)
+	}
+
+	return nil
+}
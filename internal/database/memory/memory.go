@@ -0,0 +1,836 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// service keeps posts in process memory. It is meant for local development
+// and tests, where running MongoDB is not worth the trouble.
+type service struct {
+	mu        sync.RWMutex
+	posts     map[primitive.ObjectID]models.Post
+	revisions map[primitive.ObjectID][]models.Revision
+	changes   map[primitive.ObjectID][]models.StatusChange
+	leases    map[string]lease
+	users     map[primitive.ObjectID]models.User
+	keys      map[primitive.ObjectID]models.APIKey
+	sessions  map[primitive.ObjectID]models.Session
+}
+
+type lease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+func New() database.Service {
+	return &service{
+		posts:     make(map[primitive.ObjectID]models.Post),
+		revisions: make(map[primitive.ObjectID][]models.Revision),
+		changes:   make(map[primitive.ObjectID][]models.StatusChange),
+		leases:    make(map[string]lease),
+		users:     make(map[primitive.ObjectID]models.User),
+		keys:      make(map[primitive.ObjectID]models.APIKey),
+		sessions:  make(map[primitive.ObjectID]models.Session),
+	}
+}
+
+func (s *service) Health(ctx context.Context) map[string]string {
+	return map[string]string{
+		"status":  "up",
+		"message": "It's healthy",
+	}
+}
+
+func (s *service) GetPosts(ctx context.Context) ([]*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := make([]*models.Post, 0, len(s.posts))
+	for _, p := range s.posts {
+		if p.DeletedAt != nil {
+			continue
+		}
+		post := p
+		posts = append(posts, &post)
+	}
+
+	//time descending (newest first)
+	sort.Slice(posts, func(i, j int) bool {
+		return database.DefaultSort.Compare(posts[i], posts[j]) < 0
+	})
+
+	return posts, nil
+}
+
+func (s *service) ListPosts(ctx context.Context, opts database.ListOptions) (*database.PostPage, error) {
+	cursor, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	var posts []*models.Post
+	for _, p := range s.posts {
+		if (p.DeletedAt != nil) == opts.Trashed && opts.Filter.Match(&p) {
+			post := p
+			posts = append(posts, &post)
+		}
+	}
+	s.mu.RUnlock()
+
+	total := int64(len(posts))
+
+	// Sort in the direction of travel, then keep what lies past the cursor.
+	order := opts.Sort
+	if cursor != nil && cursor.Backward {
+		order.Asc = !order.Asc
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return order.Compare(posts[i], posts[j]) < 0
+	})
+
+	if cursor != nil {
+		at := cursor.Post()
+		start := sort.Search(len(posts), func(i int) bool {
+			return order.Compare(posts[i], at) > 0
+		})
+		posts = posts[start:]
+	}
+	if len(posts) > opts.Limit+1 {
+		posts = posts[:opts.Limit+1]
+	}
+
+	page := database.NewPostPage(posts, opts, cursor)
+	if opts.WithTotal {
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func (s *service) SearchPosts(ctx context.Context, query string, limit int, filter database.PostFilter) ([]*database.SearchResult, error) {
+	terms, err := database.PrepareSearch(query, &limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	posts, err := s.GetPosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*database.SearchResult
+	for _, post := range posts {
+		if !filter.Match(post) {
+			continue
+		}
+		if score := database.ScorePost(post, terms); score > 0 {
+			results = append(results, &database.SearchResult{
+				Post:    post,
+				Score:   score,
+				Snippet: database.Highlight(post.Content, terms),
+			})
+		}
+	}
+
+	// posts is newest first, so a stable sort keeps that order between ties.
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+func (s *service) CreatePost(ctx context.Context, post *models.Post) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := database.ValidatePost(post); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	post.CreatedAt = now
+	post.UpdatedAt = now
+
+	post.ID = primitive.NewObjectID()
+	post.Version = 1
+	post.Status = models.StatusDraft
+
+	s.posts[post.ID] = *post
+
+	return nil
+}
+
+func (s *service) GetPost(ctx context.Context, id string) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[objectID]
+	if !ok || post.DeletedAt != nil {
+		return nil, database.ErrPostNotFound
+	}
+
+	return &post, nil
+}
+
+func (s *service) UpdatePost(ctx context.Context, id string, version int64, post *models.Post) (*models.Post, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	if err := database.ValidatePost(post); err != nil {
+		return nil, err
+	}
+
+	return s.PatchPost(ctx, id, version, database.PatchFromPost(post))
+}
+
+func (s *service) PatchPost(ctx context.Context, id string, version int64, patch database.PostPatch) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[objectID]
+	if !ok || post.DeletedAt != nil {
+		return nil, database.ErrPostNotFound
+	}
+	if version != database.AnyVersion && post.Version != version {
+		return nil, database.ErrVersionMismatch
+	}
+
+	now := time.Now()
+	s.saveRevision(ctx, &post, now)
+
+	patch.Apply(&post)
+	// Update the modification time
+	post.UpdatedAt = now
+	post.Version++
+	s.posts[objectID] = post
+
+	return &post, nil
+}
+
+// saveRevision keeps post as the revision of its current version, which a
+// change made at now is about to replace. The caller holds the write lock.
+func (s *service) saveRevision(ctx context.Context, post *models.Post, now time.Time) {
+	revision := models.NewRevision(post, database.EditorFrom(ctx), now)
+	revision.ID = primitive.NewObjectID()
+	s.revisions[post.ID] = append(s.revisions[post.ID], *revision)
+}
+
+func (s *service) DeletePost(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return database.InvalidIDError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[objectID]
+	if !ok || post.DeletedAt != nil {
+		return database.ErrPostNotFound
+	}
+
+	now := time.Now()
+	post.DeletedAt = &now
+	s.posts[objectID] = post
+
+	return nil
+}
+
+func (s *service) RestorePost(ctx context.Context, id string) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[objectID]
+	if !ok || post.DeletedAt == nil {
+		return nil, database.ErrPostNotFound
+	}
+
+	post.DeletedAt = nil
+	s.posts[objectID] = post
+
+	return &post, nil
+}
+
+func (s *service) GetTrashedPost(ctx context.Context, id string) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[objectID]
+	if !ok || post.DeletedAt == nil {
+		return nil, database.ErrPostNotFound
+	}
+
+	return &post, nil
+}
+
+func (s *service) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, post := range s.posts {
+		if post.DeletedAt != nil && post.DeletedAt.Before(before) {
+			delete(s.posts, id)
+			delete(s.revisions, id)
+			delete(s.changes, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (s *service) ListRevisions(ctx context.Context, postID string) ([]*models.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Revisions are appended in version order, so walk them backward to
+	// return the newest first.
+	stored := s.revisions[objectID]
+	revisions := make([]*models.Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revision := stored[i]
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, nil
+}
+
+func (s *service) GetRevision(ctx context.Context, postID string, version int64) (*models.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, revision := range s.revisions[objectID] {
+		if revision.Version == version {
+			return &revision, nil
+		}
+	}
+
+	return nil, database.ErrRevisionNotFound
+}
+
+func (s *service) TransitionPost(ctx context.Context, id string, update database.StatusUpdate) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[objectID]
+	if !ok || post.DeletedAt != nil {
+		return nil, database.ErrPostNotFound
+	}
+	if post.Status != update.From {
+		return nil, database.ErrStatusChanged
+	}
+
+	now := time.Now()
+	s.saveRevision(ctx, &post, now)
+
+	update.Apply(&post)
+	post.UpdatedAt = now
+	post.Version++
+	s.posts[objectID] = post
+
+	s.changes[objectID] = append(s.changes[objectID], models.StatusChange{
+		ID:        primitive.NewObjectID(),
+		PostID:    objectID,
+		From:      update.From,
+		To:        update.To,
+		Actor:     database.EditorFrom(ctx),
+		Comment:   update.Comment,
+		CreatedAt: now,
+	})
+
+	return &post, nil
+}
+
+func (s *service) DuePosts(ctx context.Context, now time.Time, limit int) ([]*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var posts []*models.Post
+	for _, p := range s.posts {
+		if _, due := database.Due(&p, now); due && p.DeletedAt == nil && len(posts) < limit {
+			post := p
+			posts = append(posts, &post)
+		}
+	}
+
+	return posts, nil
+}
+
+func (s *service) ListStatusChanges(ctx context.Context, postID string) ([]*models.StatusChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Changes are appended as they happen, newest last.
+	stored := s.changes[objectID]
+	changes := make([]*models.StatusChange, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		change := stored[i]
+		changes = append(changes, &change)
+	}
+
+	return changes, nil
+}
+
+func (s *service) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := s.leases[name]; ok && l.holder != holder && l.expiresAt.After(now) {
+		return false, nil
+	}
+	s.leases[name] = lease{holder: holder, expiresAt: now.Add(ttl)}
+
+	return true, nil
+}
+
+func (s *service) ReleaseLease(ctx context.Context, name string, holder string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leases[name].holder == holder {
+		delete(s.leases, name)
+	}
+
+	return nil
+}
+
+func (s *service) CreateUser(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	user.Username = database.NormalizeUsername(user.Username)
+	if err := database.ValidateUser(user); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Username == user.Username {
+			return database.ErrUsernameTaken
+		}
+	}
+
+	now := time.Now()
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	s.users[user.ID] = *user
+
+	return nil
+}
+
+func (s *service) GetUser(ctx context.Context, id string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[objectID]
+	if !ok {
+		return nil, database.ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (s *service) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	username = database.NormalizeUsername(username)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			user := u
+			return &user, nil
+		}
+	}
+
+	return nil, database.ErrUserNotFound
+}
+
+func (s *service) ListUsers(ctx context.Context) ([]*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*models.User, 0, len(s.users))
+	for _, u := range s.users {
+		user := u
+		users = append(users, &user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users, nil
+}
+
+func (s *service) SetUserRole(ctx context.Context, id string, role models.Role) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+	if err := database.ValidateRole(role); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[objectID]
+	if !ok {
+		return nil, database.ErrUserNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	s.users[objectID] = user
+
+	return &user, nil
+}
+
+func (s *service) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := database.ValidateAPIKey(key); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys {
+		if k.Hash == key.Hash {
+			return database.ErrConflict
+		}
+	}
+
+	key.ID = primitive.NewObjectID()
+	key.CreatedAt = time.Now()
+	s.keys[key.ID] = *key
+
+	return nil
+}
+
+func (s *service) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*models.APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		key := k
+		keys = append(keys, &key)
+	}
+
+	//time descending (newest first)
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (s *service) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, k := range s.keys {
+		if k.Hash == hash {
+			key := k
+			return &key, nil
+		}
+	}
+
+	return nil, database.ErrAPIKeyNotFound
+}
+
+func (s *service) RotateAPIKey(ctx context.Context, id string, prefix string, hash string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, database.InvalidIDError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[objectID]
+	if !ok {
+		return nil, database.ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	key.Prefix = prefix
+	key.Hash = hash
+	key.RotatedAt = &now
+	s.keys[objectID] = key
+
+	return &key, nil
+}
+
+func (s *service) DeleteAPIKey(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return database.InvalidIDError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[objectID]; !ok {
+		return database.ErrAPIKeyNotFound
+	}
+	delete(s.keys, objectID)
+
+	return nil
+}
+
+func (s *service) TouchAPIKey(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok || key.LastUsedAt != nil && !key.LastUsedAt.Before(at.Add(-database.LastUsedGranularity)) {
+		return nil
+	}
+	key.LastUsedAt = &at
+	s.keys[id] = key
+
+	return nil
+}
+
+func (s *service) CreateSession(ctx context.Context, session *models.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := database.ValidateSession(session); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, other := range s.sessions {
+		// There is no TTL index to clean up after expired sessions.
+		if other.Expired(now) {
+			delete(s.sessions, id)
+			continue
+		}
+		if other.Hash == session.Hash {
+			return database.ErrConflict
+		}
+	}
+
+	session.ID = primitive.NewObjectID()
+	session.CreatedAt = now
+	s.sessions[session.ID] = *session
+
+	return nil
+}
+
+func (s *service) GetSessionByHash(ctx context.Context, hash string) (*models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sess := range s.sessions {
+		if sess.Hash == hash {
+			session := sess
+			return &session, nil
+		}
+	}
+
+	return nil, database.ErrSessionNotFound
+}
+
+func (s *service) DeleteSession(ctx context.Context, id primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return database.ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+
+	return nil
+}
@@ -0,0 +1,895 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHealth(t *testing.T) {
+	srv := New()
+
+	stats := srv.Health(context.Background())
+
+	if stats["message"] != "It's healthy" {
+		t.Fatalf("expected message to be 'It's healthy', got %s", stats["message"])
+	}
+}
+
+func TestGetPostsNewestFirst(t *testing.T) {
+	srv := New()
+
+	for _, title := range []string{"first", "second", "third"} {
+		if err := srv.CreatePost(context.Background(), &models.Post{Title: title, Content: "body"}); err != nil {
+			t.Fatalf("CreatePost() returned an error: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	posts, err := srv.GetPosts(context.Background())
+	if err != nil {
+		t.Fatalf("GetPosts() returned an error: %v", err)
+	}
+
+	if len(posts) != 3 {
+		t.Fatalf("expected 3 posts, got %d", len(posts))
+	}
+
+	if posts[0].Title != "third" || posts[2].Title != "first" {
+		t.Fatalf("expected newest post first, got %s, %s, %s", posts[0].Title, posts[1].Title, posts[2].Title)
+	}
+}
+
+func TestCreateAndGetPost(t *testing.T) {
+	srv := New()
+
+	post := &models.Post{
+		Title:   "Test Post",
+		Content: "This is a test post",
+	}
+
+	if err := srv.CreatePost(context.Background(), post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	if post.ID.IsZero() {
+		t.Fatal("expected post ID to be set, got zero value")
+	}
+
+	fetchedPost, err := srv.GetPost(context.Background(), post.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetPost() returned an error: %v", err)
+	}
+
+	if fetchedPost.Title != post.Title {
+		t.Fatalf("expected title %s, got %s", post.Title, fetchedPost.Title)
+	}
+
+	// Mutating the returned post must not leak into the store.
+	fetchedPost.Title = "changed"
+	again, _ := srv.GetPost(context.Background(), post.ID.Hex())
+	if again.Title != post.Title {
+		t.Fatalf("stored post was mutated through a returned pointer")
+	}
+}
+
+func TestGetPostErrors(t *testing.T) {
+	srv := New()
+
+	if _, err := srv.GetPost(context.Background(), "invalid_id"); !errors.Is(err, database.ErrInvalidID) {
+		t.Fatalf("expected ErrInvalidID, got %v", err)
+	}
+
+	_, err := srv.GetPost(context.Background(), "000000000000000000000000")
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUpdatePost(t *testing.T) {
+	srv := New()
+
+	post := &models.Post{Title: "Test Post", Content: "body"}
+	if err := srv.CreatePost(context.Background(), post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	post.Title = "Updated Title"
+	if _, err := srv.UpdatePost(context.Background(), post.ID.Hex(), database.AnyVersion, post); err != nil {
+		t.Fatalf("UpdatePost() returned an error: %v", err)
+	}
+
+	fetchedPost, err := srv.GetPost(context.Background(), post.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetPost() returned an error: %v", err)
+	}
+
+	if fetchedPost.Title != "Updated Title" {
+		t.Fatalf("expected fetched post title to be 'Updated Title', got %s", fetchedPost.Title)
+	}
+
+	_, err = srv.UpdatePost(context.Background(), "000000000000000000000000", database.AnyVersion, post)
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDeletePost(t *testing.T) {
+	srv := New()
+
+	post := &models.Post{Title: "Test Post", Content: "body"}
+	if err := srv.CreatePost(context.Background(), post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	if err := srv.DeletePost(context.Background(), post.ID.Hex()); err != nil {
+		t.Fatalf("DeletePost() returned an error: %v", err)
+	}
+
+	if _, err := srv.GetPost(context.Background(), post.ID.Hex()); err == nil {
+		t.Fatal("expected error for deleted post, got nil")
+	}
+
+	err := srv.DeletePost(context.Background(), post.ID.Hex())
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	srv := New()
+
+	done := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			post := &models.Post{Title: "concurrent", Content: "body"}
+			if err := srv.CreatePost(context.Background(), post); err != nil {
+				t.Errorf("CreatePost() returned an error: %v", err)
+				return
+			}
+			if _, err := srv.GetPosts(context.Background()); err != nil {
+				t.Errorf("GetPosts() returned an error: %v", err)
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		<-done
+	}
+
+	posts, _ := srv.GetPosts(context.Background())
+	if len(posts) != 20 {
+		t.Fatalf("expected 20 posts, got %d", len(posts))
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	srv := New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := srv.CreatePost(ctx, &models.Post{Title: "late"}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCreatePostValidation(t *testing.T) {
+	srv := New()
+
+	err := srv.CreatePost(context.Background(), &models.Post{Title: "  ", Content: "body"})
+
+	var verr *database.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if verr.Field != "title" {
+		t.Fatalf("expected title to fail validation, got %s", verr.Field)
+	}
+}
+
+func TestListPostsPagination(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	// Equal timestamps exercise the _id tie breaker.
+	stamp := time.Now()
+	for i := 0; i < 5; i++ {
+		post := &models.Post{Title: fmt.Sprintf("post %d", i), Content: "body"}
+		if err := srv.CreatePost(ctx, post); err != nil {
+			t.Fatalf("CreatePost() returned an error: %v", err)
+		}
+		s := srv.(*service)
+		stored := s.posts[post.ID]
+		stored.CreatedAt = stamp.Add(time.Duration(i/2) * time.Second)
+		s.posts[post.ID] = stored
+	}
+
+	all, _ := srv.GetPosts(ctx)
+
+	first, err := srv.ListPosts(ctx, database.ListOptions{Limit: 2, WithTotal: true})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(first.Posts) != 2 || first.NextCursor == "" || first.PrevCursor != "" {
+		t.Fatalf("unexpected first page: %d posts, next %q, prev %q", len(first.Posts), first.NextCursor, first.PrevCursor)
+	}
+	if first.Total == nil || *first.Total != 5 {
+		t.Fatalf("expected total of 5, got %v", first.Total)
+	}
+
+	second, err := srv.ListPosts(ctx, database.ListOptions{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	third, err := srv.ListPosts(ctx, database.ListOptions{Limit: 2, Cursor: second.NextCursor})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(third.Posts) != 1 || third.NextCursor != "" {
+		t.Fatalf("expected a final page of 1 post, got %d with next %q", len(third.Posts), third.NextCursor)
+	}
+
+	var walked []*models.Post
+	for _, page := range []*database.PostPage{first, second, third} {
+		walked = append(walked, page.Posts...)
+	}
+	for i := range all {
+		if walked[i].ID != all[i].ID {
+			t.Fatalf("page walk diverged from GetPosts at %d", i)
+		}
+	}
+
+	back, err := srv.ListPosts(ctx, database.ListOptions{Limit: 2, Cursor: third.PrevCursor})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(back.Posts) != 2 || back.Posts[0].ID != second.Posts[0].ID || back.Posts[1].ID != second.Posts[1].ID {
+		t.Fatal("walking backward did not return the second page")
+	}
+}
+
+func TestListPostsInvalidOptions(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	var verr *database.ValidationError
+	if _, err := srv.ListPosts(ctx, database.ListOptions{Limit: 1000}); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for limit, got %v", err)
+	}
+	if _, err := srv.ListPosts(ctx, database.ListOptions{Cursor: "garbage"}); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for cursor, got %v", err)
+	}
+}
+
+func TestListPostsFilterAndSort(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	for _, p := range []struct{ title, author string }{
+		{"Breaking: storm", "jane"},
+		{"breaking: markets", "john"},
+		{"Weather", "jane"},
+		{"Breaking: sports", "jane"},
+	} {
+		if err := srv.CreatePost(ctx, &models.Post{Title: p.title, Author: p.author, Content: "body"}); err != nil {
+			t.Fatalf("CreatePost() returned an error: %v", err)
+		}
+	}
+
+	opts := database.ListOptions{
+		Limit:     1,
+		WithTotal: true,
+		Filter:    database.PostFilter{Author: "jane", TitlePrefix: "BREAKING"},
+		Sort:      database.Sort{Field: database.SortTitle, Asc: true},
+	}
+	first, err := srv.ListPosts(ctx, opts)
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if *first.Total != 2 || first.Posts[0].Title != "Breaking: sports" {
+		t.Fatalf("unexpected first page: total %d, %q", *first.Total, first.Posts[0].Title)
+	}
+
+	opts.Cursor = first.NextCursor
+	second, err := srv.ListPosts(ctx, opts)
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(second.Posts) != 1 || second.Posts[0].Title != "Breaking: storm" || second.NextCursor != "" {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+
+	// A cursor only makes sense for the order it was issued for.
+	opts.Sort = database.DefaultSort
+	var verr *database.ValidationError
+	if _, err := srv.ListPosts(ctx, opts); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for mismatched cursor, got %v", err)
+	}
+
+	future := database.PostFilter{Created: []database.TimeBound{{Op: database.OpGT, Value: time.Now().Add(time.Hour)}}}
+	none, err := srv.ListPosts(ctx, database.ListOptions{Filter: future})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(none.Posts) != 0 {
+		t.Fatalf("expected no posts created in the future, got %d", len(none.Posts))
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	posts := []*models.Post{
+		{Title: "Storm hits the coast", Content: "Residents were told to stay indoors."},
+		{Title: "Markets", Content: "Traders watched the storms <and> the rates closely."},
+		{Title: "Sports", Content: "Nothing to see here."},
+	}
+	for _, post := range posts {
+		if err := srv.CreatePost(ctx, post); err != nil {
+			t.Fatalf("CreatePost() returned an error: %v", err)
+		}
+	}
+
+	results, err := srv.SearchPosts(ctx, "storm", 0, database.PostFilter{})
+	if err != nil {
+		t.Fatalf("SearchPosts() returned an error: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Post.ID != posts[0].ID || results[0].Score <= results[1].Score {
+		t.Fatal("expected the title match to rank first")
+	}
+
+	want := "Traders watched the <mark>storms</mark> &lt;and&gt; the rates closely."
+	if results[1].Snippet != want {
+		t.Fatalf("unexpected snippet:\n got %s\nwant %s", results[1].Snippet, want)
+	}
+
+	var verr *database.ValidationError
+	if _, err := srv.SearchPosts(ctx, "  -- ", 0, database.PostFilter{}); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for an empty query, got %v", err)
+	}
+}
+
+func TestUpdatePostKeepsServerFields(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Original", Content: "body", Author: "jane"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+	created := post.CreatedAt
+
+	updated, err := srv.UpdatePost(ctx, post.ID.Hex(), database.AnyVersion, &models.Post{Title: "Replaced", Content: "new body", Author: "john"})
+	if err != nil {
+		t.Fatalf("UpdatePost() returned an error: %v", err)
+	}
+	if updated.ID != post.ID || !updated.CreatedAt.Equal(created) {
+		t.Fatalf("UpdatePost() changed server managed fields: %+v", updated)
+	}
+	if updated.Title != "Replaced" || updated.Author != "jane" {
+		t.Fatalf("UpdatePost() did not apply the new fields, or changed the author: %+v", updated)
+	}
+
+	title := "Patched"
+	patched, err := srv.PatchPost(ctx, post.ID.Hex(), database.AnyVersion, database.PostPatch{Title: &title})
+	if err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+	if patched.Title != "Patched" || patched.Content != "new body" || patched.Author != "jane" {
+		t.Fatalf("PatchPost() touched fields outside the patch: %+v", patched)
+	}
+
+	empty := ""
+	var verr *database.ValidationError
+	if _, err := srv.PatchPost(ctx, post.ID.Hex(), database.AnyVersion, database.PostPatch{Content: &empty}); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for empty content, got %v", err)
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Original", Content: "body"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+	if post.Version != 1 {
+		t.Fatalf("expected new posts to start at version 1, got %d", post.Version)
+	}
+
+	title := "First"
+	updated, err := srv.PatchPost(ctx, post.ID.Hex(), 1, database.PostPatch{Title: &title})
+	if err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("expected version 2, got %d", updated.Version)
+	}
+
+	title = "Second"
+	_, err = srv.PatchPost(ctx, post.ID.Hex(), 1, database.PostPatch{Title: &title})
+	if !errors.Is(err, database.ErrVersionMismatch) || !errors.Is(err, database.ErrConflict) {
+		t.Fatalf("expected ErrVersionMismatch, got %v", err)
+	}
+
+	_, err = srv.PatchPost(ctx, "000000000000000000000000", 1, database.PostPatch{Title: &title})
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing post, got %v", err)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	srv := New()
+	ctx := database.WithEditor(context.Background(), "alice")
+
+	hero := models.Media{Key: "hero.png", ContentType: "image/png", Alt: "A storm"}
+	post := &models.Post{Title: "First", Content: "one", Author: "jane", HeroImage: &hero,
+		Media: []models.Media{{Key: "inline.png", ContentType: "image/png"}}}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	revisions, err := srv.ListRevisions(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("ListRevisions() returned an error: %v", err)
+	}
+	if len(revisions) != 0 {
+		t.Fatalf("expected no revisions for a new post, got %d", len(revisions))
+	}
+
+	noMedia := []models.Media{}
+	for _, title := range []string{"Second", "Third"} {
+		patch := database.PostPatch{Title: &title, RemoveHeroImage: true, Media: &noMedia}
+		if _, err := srv.PatchPost(ctx, post.ID.Hex(), database.AnyVersion, patch); err != nil {
+			t.Fatalf("PatchPost() returned an error: %v", err)
+		}
+	}
+
+	revisions, err = srv.ListRevisions(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("ListRevisions() returned an error: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 2 || revisions[1].Version != 1 {
+		t.Fatalf("expected versions 2 and 1 newest first, got %+v", revisions)
+	}
+	if revisions[0].Title != "Second" || revisions[0].Editor != "alice" {
+		t.Fatalf("unexpected revision: %+v", revisions[0])
+	}
+
+	revision, err := srv.GetRevision(ctx, post.ID.Hex(), 1)
+	if err != nil {
+		t.Fatalf("GetRevision() returned an error: %v", err)
+	}
+	if revision.Title != "First" || revision.Content != "one" || revision.Author != "jane" {
+		t.Fatalf("unexpected revision: %+v", revision)
+	}
+	if revision.HeroImage == nil || *revision.HeroImage != hero || len(revision.Media) != 1 || revision.Media[0].Key != "inline.png" {
+		t.Fatalf("expected the media to be kept with the revision, got %+v", revision)
+	}
+
+	if _, err := srv.GetRevision(ctx, post.ID.Hex(), 3); !errors.Is(err, database.ErrRevisionNotFound) {
+		t.Fatalf("expected ErrRevisionNotFound for the current version, got %v", err)
+	}
+
+	// Restoring the revision brings its media back.
+	restored, err := srv.PatchPost(ctx, post.ID.Hex(), 3, database.PatchFromRevision(revision))
+	if err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+	if restored.Title != "First" || restored.HeroImage == nil || *restored.HeroImage != hero || len(restored.Media) != 1 {
+		t.Fatalf("unexpected restored post: %+v", restored)
+	}
+
+	if err := srv.DeletePost(ctx, post.ID.Hex()); err != nil {
+		t.Fatalf("DeletePost() returned an error: %v", err)
+	}
+	if _, err := srv.PurgeDeleted(ctx, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("PurgeDeleted() returned an error: %v", err)
+	}
+	if _, err := srv.GetRevision(ctx, post.ID.Hex(), 1); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected revisions to be purged with the post, got %v", err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	kept := &models.Post{Title: "Kept", Content: "body", Author: "jane"}
+	trashed := &models.Post{Title: "Trashed", Content: "storm warning", Author: "jane"}
+	for _, post := range []*models.Post{kept, trashed} {
+		if err := srv.CreatePost(ctx, post); err != nil {
+			t.Fatalf("CreatePost() returned an error: %v", err)
+		}
+	}
+
+	if err := srv.DeletePost(ctx, trashed.ID.Hex()); err != nil {
+		t.Fatalf("DeletePost() returned an error: %v", err)
+	}
+
+	// The trashed post is gone from every read path.
+	if _, err := srv.GetPost(ctx, trashed.ID.Hex()); !errors.Is(err, database.ErrPostNotFound) {
+		t.Fatalf("expected ErrPostNotFound, got %v", err)
+	}
+	title := "Edited"
+	if _, err := srv.PatchPost(ctx, trashed.ID.Hex(), database.AnyVersion, database.PostPatch{Title: &title}); !errors.Is(err, database.ErrPostNotFound) {
+		t.Fatalf("expected ErrPostNotFound when patching, got %v", err)
+	}
+	posts, _ := srv.GetPosts(ctx)
+	if len(posts) != 1 || posts[0].ID != kept.ID {
+		t.Fatalf("expected only the kept post, got %+v", posts)
+	}
+	page, _ := srv.ListPosts(ctx, database.ListOptions{})
+	if len(page.Posts) != 1 || page.Posts[0].ID != kept.ID {
+		t.Fatalf("expected only the kept post, got %+v", page.Posts)
+	}
+	results, _ := srv.SearchPosts(ctx, "storm", 0, database.PostFilter{})
+	if len(results) != 0 {
+		t.Fatalf("expected no search results, got %d", len(results))
+	}
+
+	page, err := srv.ListPosts(ctx, database.ListOptions{Trashed: true})
+	if err != nil {
+		t.Fatalf("ListPosts() returned an error: %v", err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].ID != trashed.ID || page.Posts[0].DeletedAt == nil {
+		t.Fatalf("expected the trashed post in the trash, got %+v", page.Posts)
+	}
+	if _, err := srv.GetTrashedPost(ctx, trashed.ID.Hex()); err != nil {
+		t.Fatalf("GetTrashedPost() returned an error: %v", err)
+	}
+	if _, err := srv.GetTrashedPost(ctx, kept.ID.Hex()); !errors.Is(err, database.ErrPostNotFound) {
+		t.Fatalf("expected ErrPostNotFound for a post outside the trash, got %v", err)
+	}
+
+	restored, err := srv.RestorePost(ctx, trashed.ID.Hex())
+	if err != nil {
+		t.Fatalf("RestorePost() returned an error: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Fatal("expected the restored post to leave the trash")
+	}
+	if _, err := srv.RestorePost(ctx, trashed.ID.Hex()); !errors.Is(err, database.ErrPostNotFound) {
+		t.Fatalf("expected ErrPostNotFound for a post outside the trash, got %v", err)
+	}
+
+	// Only posts trashed before the cutoff are purged.
+	if err := srv.DeletePost(ctx, trashed.ID.Hex()); err != nil {
+		t.Fatalf("DeletePost() returned an error: %v", err)
+	}
+	if n, _ := srv.PurgeDeleted(ctx, time.Now().Add(-time.Hour)); n != 0 {
+		t.Fatalf("expected nothing to purge yet, purged %d", n)
+	}
+	if n, _ := srv.PurgeDeleted(ctx, time.Now().Add(time.Second)); n != 1 {
+		t.Fatalf("expected one post purged, purged %d", n)
+	}
+	if _, err := srv.RestorePost(ctx, trashed.ID.Hex()); !errors.Is(err, database.ErrPostNotFound) {
+		t.Fatalf("expected a purged post to be gone, got %v", err)
+	}
+}
+
+func TestTransitionPost(t *testing.T) {
+	srv := New()
+	ctx := database.WithEditor(context.Background(), "erin")
+
+	post := &models.Post{Title: "Draft", Content: "body"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+	if post.Status != models.StatusDraft {
+		t.Fatalf("expected new posts to be drafts, got %q", post.Status)
+	}
+
+	published, err := srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusPublished, Comment: "looks good"})
+	if err != nil {
+		t.Fatalf("TransitionPost() returned an error: %v", err)
+	}
+	if published.Status != models.StatusPublished || published.Version != 2 {
+		t.Fatalf("unexpected post: %+v", published)
+	}
+
+	// The version a transition replaces is kept like that of any update.
+	revision, err := srv.GetRevision(ctx, post.ID.Hex(), 1)
+	if err != nil {
+		t.Fatalf("GetRevision() returned an error: %v", err)
+	}
+	if revision.Status != models.StatusDraft || revision.Title != post.Title || revision.Editor != "erin" {
+		t.Fatalf("unexpected revision: %+v", revision)
+	}
+
+	// A second reviewer still thinks the post is a draft.
+	_, err = srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusInReview})
+	if !errors.Is(err, database.ErrStatusChanged) || !errors.Is(err, database.ErrConflict) {
+		t.Fatalf("expected ErrStatusChanged, got %v", err)
+	}
+
+	_, err = srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusPublished, To: models.StatusInReview})
+	if !errors.Is(err, database.ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+
+	page, _ := srv.ListPosts(ctx, database.ListOptions{Filter: database.PostFilter{Status: []models.PostStatus{models.StatusDraft}}})
+	if len(page.Posts) != 0 {
+		t.Fatalf("expected no drafts left, got %d", len(page.Posts))
+	}
+
+	changes, err := srv.ListStatusChanges(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("ListStatusChanges() returned an error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].From != models.StatusDraft || changes[0].To != models.StatusPublished ||
+		changes[0].Actor != "erin" || changes[0].Comment != "looks good" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+}
+
+func TestScheduledPosts(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+	now := time.Now()
+
+	post := &models.Post{Title: "Embargoed", Content: "body"}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	var verr *database.ValidationError
+	_, err := srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusScheduled})
+	if !errors.As(err, &verr) || verr.Field != "publish_at" {
+		t.Fatalf("expected publish_at to be required, got %v", err)
+	}
+	publishAt, unpublishAt := now.Add(time.Hour), now.Add(time.Minute)
+	_, err = srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusScheduled, PublishAt: &publishAt, UnpublishAt: &unpublishAt})
+	if !errors.As(err, &verr) || verr.Field != "unpublish_at" {
+		t.Fatalf("expected unpublish_at to follow publish_at, got %v", err)
+	}
+
+	unpublishAt = now.Add(2 * time.Hour)
+	scheduled, err := srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusScheduled, PublishAt: &publishAt, UnpublishAt: &unpublishAt})
+	if err != nil {
+		t.Fatalf("TransitionPost() returned an error: %v", err)
+	}
+	if scheduled.PublishAt == nil || scheduled.UnpublishAt == nil {
+		t.Fatalf("expected the schedule to be stored, got %+v", scheduled)
+	}
+
+	if due, _ := srv.DuePosts(ctx, now, 10); len(due) != 0 {
+		t.Fatalf("expected nothing due yet, got %d", len(due))
+	}
+	due, err := srv.DuePosts(ctx, publishAt, 10)
+	if err != nil {
+		t.Fatalf("DuePosts() returned an error: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != post.ID {
+		t.Fatalf("expected the scheduled post to be due, got %+v", due)
+	}
+
+	// Publishing keeps the unpublish time, going back to draft drops it.
+	published, err := srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusScheduled, To: models.StatusPublished})
+	if err != nil {
+		t.Fatalf("TransitionPost() returned an error: %v", err)
+	}
+	if published.PublishAt != nil || published.UnpublishAt == nil {
+		t.Fatalf("unexpected schedule after publishing: %+v", published)
+	}
+	draft, err := srv.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusPublished, To: models.StatusDraft})
+	if err != nil {
+		t.Fatalf("TransitionPost() returned an error: %v", err)
+	}
+	if draft.UnpublishAt != nil {
+		t.Fatalf("expected the schedule to be dropped, got %+v", draft)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	user := &models.User{Username: " Jane ", Name: "Jane Doe", Role: models.RoleEditor, PasswordHash: "hash"}
+	if err := srv.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser() returned an error: %v", err)
+	}
+	if user.ID.IsZero() || user.Username != "jane" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	found, err := srv.GetUserByUsername(ctx, "JANE")
+	if err != nil {
+		t.Fatalf("GetUserByUsername() returned an error: %v", err)
+	}
+	if found.ID != user.ID {
+		t.Fatalf("expected %s, got %s", user.ID.Hex(), found.ID.Hex())
+	}
+	if _, err := srv.GetUser(ctx, user.ID.Hex()); err != nil {
+		t.Fatalf("GetUser() returned an error: %v", err)
+	}
+
+	taken := &models.User{Username: "jane", Name: "Another Jane", Role: models.RoleWriter, PasswordHash: "hash"}
+	if err := srv.CreateUser(ctx, taken); !errors.Is(err, database.ErrUsernameTaken) {
+		t.Fatalf("expected ErrUsernameTaken, got %v", err)
+	}
+
+	var verr *database.ValidationError
+	invalid := &models.User{Username: "j", Name: "J", Role: models.RoleWriter, PasswordHash: "hash"}
+	if err := srv.CreateUser(ctx, invalid); !errors.As(err, &verr) || verr.Field != "username" {
+		t.Fatalf("expected the username to be refused, got %v", err)
+	}
+
+	if _, err := srv.GetUserByUsername(ctx, "nobody"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	updated, err := srv.SetUserRole(ctx, user.ID.Hex(), models.RoleReader)
+	if err != nil {
+		t.Fatalf("SetUserRole() returned an error: %v", err)
+	}
+	if updated.Role != models.RoleReader {
+		t.Fatalf("expected the reader role, got %q", updated.Role)
+	}
+	if _, err := srv.SetUserRole(ctx, user.ID.Hex(), "chief"); !errors.As(err, &verr) || verr.Field != "role" {
+		t.Fatalf("expected the role to be refused, got %v", err)
+	}
+
+	aaron := &models.User{Username: "aaron", Name: "Aaron", Role: models.RoleWriter, PasswordHash: "hash"}
+	if err := srv.CreateUser(ctx, aaron); err != nil {
+		t.Fatalf("CreateUser() returned an error: %v", err)
+	}
+	users, err := srv.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers() returned an error: %v", err)
+	}
+	if len(users) != 2 || users[0].Username != "aaron" || users[1].Role != models.RoleReader {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	var verr *database.ValidationError
+	if err := srv.CreateAPIKey(ctx, &models.APIKey{Name: "wire", Hash: "h1"}); !errors.As(err, &verr) || verr.Field != "scopes" {
+		t.Fatalf("expected the scopes to be required, got %v", err)
+	}
+
+	key := &models.APIKey{Name: "wire", Scopes: []models.Scope{models.ScopePostsWrite}, Prefix: "tn_1", Hash: "h1"}
+	if err := srv.CreateAPIKey(ctx, key); err != nil {
+		t.Fatalf("CreateAPIKey() returned an error: %v", err)
+	}
+
+	found, err := srv.GetAPIKeyByHash(ctx, "h1")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash() returned an error: %v", err)
+	}
+	if found.ID != key.ID || found.LastUsedAt != nil {
+		t.Fatalf("unexpected key: %+v", found)
+	}
+
+	// Uses within the granularity are not recorded again.
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(time.Second)} {
+		if err := srv.TouchAPIKey(ctx, key.ID, at); err != nil {
+			t.Fatalf("TouchAPIKey() returned an error: %v", err)
+		}
+	}
+	found, _ = srv.GetAPIKeyByHash(ctx, "h1")
+	if found.LastUsedAt == nil || !found.LastUsedAt.Equal(now) {
+		t.Fatalf("expected the first use to be recorded, got %v", found.LastUsedAt)
+	}
+
+	rotated, err := srv.RotateAPIKey(ctx, key.ID.Hex(), "tn_2", "h2")
+	if err != nil {
+		t.Fatalf("RotateAPIKey() returned an error: %v", err)
+	}
+	if rotated.Hash != "h2" || rotated.RotatedAt == nil || rotated.Name != "wire" {
+		t.Fatalf("unexpected rotated key: %+v", rotated)
+	}
+	if _, err := srv.GetAPIKeyByHash(ctx, "h1"); !errors.Is(err, database.ErrAPIKeyNotFound) {
+		t.Fatalf("expected the old hash to be gone, got %v", err)
+	}
+
+	if keys, _ := srv.ListAPIKeys(ctx); len(keys) != 1 {
+		t.Fatalf("expected one key, got %d", len(keys))
+	}
+	if err := srv.DeleteAPIKey(ctx, key.ID.Hex()); err != nil {
+		t.Fatalf("DeleteAPIKey() returned an error: %v", err)
+	}
+	if err := srv.DeleteAPIKey(ctx, key.ID.Hex()); !errors.Is(err, database.ErrAPIKeyNotFound) {
+		t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	var verr *database.ValidationError
+	if err := srv.CreateSession(ctx, &models.Session{Hash: "s1", CSRFToken: "c1", ExpiresAt: time.Now().Add(time.Hour)}); !errors.As(err, &verr) || verr.Field != "user_id" {
+		t.Fatalf("expected the user to be required, got %v", err)
+	}
+
+	session := &models.Session{UserID: primitive.NewObjectID(), Hash: "s1", CSRFToken: "c1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := srv.CreateSession(ctx, session); err != nil {
+		t.Fatalf("CreateSession() returned an error: %v", err)
+	}
+	if err := srv.CreateSession(ctx, &models.Session{UserID: session.UserID, Hash: "s1", CSRFToken: "c2", ExpiresAt: session.ExpiresAt}); !errors.Is(err, database.ErrConflict) {
+		t.Fatalf("expected ErrConflict for a taken hash, got %v", err)
+	}
+
+	found, err := srv.GetSessionByHash(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSessionByHash() returned an error: %v", err)
+	}
+	if found.ID != session.ID || found.UserID != session.UserID || found.CSRFToken != "c1" || found.Expired(time.Now()) {
+		t.Fatalf("unexpected session: %+v", found)
+	}
+	if !found.Expired(session.ExpiresAt) {
+		t.Fatalf("expected the session to expire at %v", session.ExpiresAt)
+	}
+
+	if err := srv.DeleteSession(ctx, session.ID); err != nil {
+		t.Fatalf("DeleteSession() returned an error: %v", err)
+	}
+	if _, err := srv.GetSessionByHash(ctx, "s1"); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+	if err := srv.DeleteSession(ctx, session.ID); !errors.Is(err, database.ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestPostMedia(t *testing.T) {
+	srv := New()
+	ctx := context.Background()
+
+	hero := &models.Media{Key: "hero.png", ContentType: "image/png", Alt: "The harbour"}
+	post := &models.Post{Title: "Pictured", Content: "body", Author: "jane", HeroImage: hero}
+	if err := srv.CreatePost(ctx, post); err != nil {
+		t.Fatalf("CreatePost() returned an error: %v", err)
+	}
+
+	// A full update leaves the media alone.
+	updated, err := srv.UpdatePost(ctx, post.ID.Hex(), database.AnyVersion, &models.Post{Title: "Pictured", Content: "new body", Author: "jane"})
+	if err != nil {
+		t.Fatalf("UpdatePost() returned an error: %v", err)
+	}
+	if updated.HeroImage == nil || updated.HeroImage.Alt != "The harbour" {
+		t.Fatalf("UpdatePost() dropped the hero image: %+v", updated)
+	}
+
+	inline := []models.Media{{Key: "one.jpg", ContentType: "image/jpeg"}, {Key: "two.mp4", ContentType: "video/mp4"}}
+	patched, err := srv.PatchPost(ctx, post.ID.Hex(), database.AnyVersion, database.PostPatch{Media: &inline, RemoveHeroImage: true})
+	if err != nil {
+		t.Fatalf("PatchPost() returned an error: %v", err)
+	}
+	if patched.HeroImage != nil || len(patched.Media) != 2 || patched.Media[1].Key != "two.mp4" {
+		t.Fatalf("PatchPost() did not apply the media: %+v", patched)
+	}
+
+	inline[0].Key = "changed.jpg"
+	got, err := srv.GetPost(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("GetPost() returned an error: %v", err)
+	}
+	if got.Media[0].Key != "one.jpg" {
+		t.Fatalf("expected the stored media not to share the patch slice, got %+v", got.Media)
+	}
+
+	var verr *database.ValidationError
+	if _, err := srv.PatchPost(ctx, post.ID.Hex(), database.AnyVersion, database.PostPatch{HeroImage: &models.Media{}}); !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError for a hero image without a key, got %v", err)
+	}
+}
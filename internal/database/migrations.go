@@ -0,0 +1,486 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationsCollection records which migrations have been applied.
+const migrationsCollection = "schema_migrations"
+
+// Migration is one versioned step of the data layout. Migrations run in
+// Version order and must be idempotent: a crash between running a migration
+// and recording it means it runs again on the next attempt.
+type Migration struct {
+	Version     int
+	Description string
+	// Up changes the data, for migrations that do more than build indexes.
+	Up func(ctx context.Context, db *mongo.Database) error
+	// Indexes are built after Up, per collection. They belong to the
+	// migration and are frozen with it: changing an index takes a new
+	// migration that drops the old definition in its Up.
+	Indexes map[string][]mongo.IndexModel
+}
+
+// MigrationState describes a migration and whether it has been applied.
+type MigrationState struct {
+	Version     int
+	Description string
+	// AppliedAt is zero while the migration is pending.
+	AppliedAt time.Time
+}
+
+// Migrator is implemented by backends with a persistent schema. Backends
+// without one, such as the in-memory store, simply don't implement it.
+type Migrator interface {
+	// Migrate applies every pending migration in order and returns the ones
+	// it applied.
+	Migrate(ctx context.Context) ([]MigrationState, error)
+	// MigrationStatus lists every known migration, applied or not.
+	MigrationStatus(ctx context.Context) ([]MigrationState, error)
+	// CheckIndexes reports the indexes the migrations build that are
+	// missing from the database or defined differently there.
+	CheckIndexes(ctx context.Context) error
+}
+
+// migrations is the ordered history of the data layout. Never edit or
+// reorder an entry once released, append a new one instead.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create posts indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"posts": {
+				{
+					Keys:    bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+					Options: options.Index().SetName("posts_created_at"),
+				},
+				{
+					Keys:    bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}},
+					Options: options.Index().SetName("posts_updated_at"),
+				},
+				{
+					Keys:    bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("posts_title"),
+				},
+				{
+					Keys:    bson.D{{Key: "author", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("posts_author_created_at"),
+				},
+				{
+					Keys: bson.D{{Key: "title", Value: "text"}, {Key: "content", Value: "text"}},
+					Options: options.Index().
+						SetName("posts_text").
+						SetWeights(bson.D{{Key: "title", Value: 10}, {Key: "content", Value: 2}}),
+				},
+			},
+		},
+	},
+	{
+		Version:     2,
+		Description: "start post versions at 1",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("posts").UpdateMany(ctx,
+				bson.M{"version": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"version": 1}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "create post_revisions indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"post_revisions": {
+				{
+					Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "version", Value: -1}},
+					Options: options.Index().SetName("post_revisions_post_version").SetUnique(true),
+				},
+			},
+		},
+	},
+	{
+		Version:     4,
+		Description: "create posts trash index",
+		Indexes: map[string][]mongo.IndexModel{
+			"posts": {
+				{
+					// Only trashed posts have the field, which keeps the index small.
+					Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+					Options: options.Index().SetName("posts_deleted_at").SetSparse(true),
+				},
+			},
+		},
+	},
+	{
+		Version:     5,
+		Description: "publish existing posts and index post status",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Posts went live on creation before the workflow existed.
+			_, err := db.Collection("posts").UpdateMany(ctx,
+				bson.M{"status": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"status": "published"}},
+			)
+			return err
+		},
+		Indexes: map[string][]mongo.IndexModel{
+			"posts": {
+				{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("posts_status_created_at"),
+				},
+			},
+			"post_transitions": {
+				{
+					Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("post_transitions_post_created_at"),
+				},
+			},
+		},
+	},
+	{
+		Version:     6,
+		Description: "index post schedules",
+		Indexes: map[string][]mongo.IndexModel{
+			"posts": {
+				{
+					Keys:    bson.D{{Key: "publish_at", Value: 1}},
+					Options: options.Index().SetName("posts_publish_at").SetSparse(true),
+				},
+				{
+					Keys:    bson.D{{Key: "unpublish_at", Value: 1}},
+					Options: options.Index().SetName("posts_unpublish_at").SetSparse(true),
+				},
+			},
+		},
+	},
+	{
+		Version:     7,
+		Description: "create users indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"users": {
+				{
+					Keys:    bson.D{{Key: "username", Value: 1}},
+					Options: options.Index().SetName("users_username").SetUnique(true),
+				},
+			},
+		},
+	},
+	{
+		Version:     8,
+		Description: "create api_keys indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"api_keys": {
+				{
+					Keys:    bson.D{{Key: "hash", Value: 1}},
+					Options: options.Index().SetName("api_keys_hash").SetUnique(true),
+				},
+			},
+		},
+	},
+	{
+		Version:     9,
+		Description: "create sessions indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"sessions": {
+				{
+					Keys:    bson.D{{Key: "hash", Value: 1}},
+					Options: options.Index().SetName("sessions_hash").SetUnique(true),
+				},
+				{
+					// MongoDB removes sessions once they expire.
+					Keys:    bson.D{{Key: "expires_at", Value: 1}},
+					Options: options.Index().SetName("sessions_expires_at").SetExpireAfterSeconds(0),
+				},
+			},
+		},
+	},
+	{
+		Version:     10,
+		Description: "index posts by author account",
+		Indexes: map[string][]mongo.IndexModel{
+			"posts": {
+				{
+					Keys:    bson.D{{Key: "author_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("posts_author_id_status_created_at"),
+				},
+			},
+		},
+	},
+}
+
+// run applies the migration: Up first, then its indexes. Creating an index
+// that already exists with the same definition is a no-op.
+func (m Migration) run(ctx context.Context, db *mongo.Database) error {
+	if m.Up != nil {
+		if err := m.Up(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	for _, collection := range slices.Sorted(maps.Keys(m.Indexes)) {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, m.Indexes[collection]); err != nil {
+			return fmt.Errorf("error creating %s indexes: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// declaredIndexes returns the indexes the migrations build, per collection
+// and name. A later migration redefining an index replaces the earlier one.
+func declaredIndexes() map[string]map[string]mongo.IndexModel {
+	declared := make(map[string]map[string]mongo.IndexModel)
+	for _, m := range migrations {
+		for collection, models := range m.Indexes {
+			if declared[collection] == nil {
+				declared[collection] = make(map[string]mongo.IndexModel)
+			}
+			for _, model := range models {
+				declared[collection][*model.Options.Name] = model
+			}
+		}
+	}
+	return declared
+}
+
+func (s *service) applied(ctx context.Context) (map[int]time.Time, error) {
+	cursor, err := s.db.Database(database).Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", migrationsCollection, err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []struct {
+		Version   int       `bson:"_id"`
+		AppliedAt time.Time `bson:"applied_at"`
+	}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", migrationsCollection, err)
+	}
+
+	applied := make(map[int]time.Time, len(records))
+	for _, r := range records {
+		applied[r.Version] = r.AppliedAt
+	}
+	return applied, nil
+}
+
+func (s *service) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	applied, err := s.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		states = append(states, MigrationState{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   applied[m.Version],
+		})
+	}
+	return states, nil
+}
+
+func (s *service) Migrate(ctx context.Context) ([]MigrationState, error) {
+	applied, err := s.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.db.Database(database)
+	var ran []MigrationState
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		if err := m.run(ctx, db); err != nil {
+			return ran, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+
+		state := MigrationState{Version: m.Version, Description: m.Description, AppliedAt: time.Now()}
+		_, err := db.Collection(migrationsCollection).InsertOne(ctx, bson.M{
+			"_id":         state.Version,
+			"description": state.Description,
+			"applied_at":  state.AppliedAt,
+		})
+		// Another instance may have applied the same migration concurrently,
+		// which is harmless since migrations are idempotent.
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return ran, fmt.Errorf("error recording migration %d: %w", m.Version, err)
+		}
+		ran = append(ran, state)
+	}
+
+	return ran, nil
+}
+
+func (s *service) CheckIndexes(ctx context.Context) error {
+	db := s.db.Database(database)
+
+	var problems []string
+	for collection, declared := range declaredIndexes() {
+		existing, err := listIndexes(ctx, db.Collection(collection))
+		if err != nil {
+			return err
+		}
+
+		for name, model := range declared {
+			spec, ok := existing[name]
+			if !ok {
+				problems = append(problems, collection+"."+name+" is missing")
+				continue
+			}
+			if diff := spec.diff(model); diff != "" {
+				problems = append(problems, collection+"."+name+" "+diff)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("indexes out of date: %s; run the migrations", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// indexSpec is an index as MongoDB describes it.
+type indexSpec struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	Unique             bool   `bson:"unique"`
+	Sparse             bool   `bson:"sparse"`
+	ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+	// Weights are the fields of a text index, whose key only says that it
+	// is one.
+	Weights bson.D `bson:"weights"`
+}
+
+// listIndexes returns the indexes of collection by name, none when the
+// collection doesn't exist yet.
+func listIndexes(ctx context.Context, collection *mongo.Collection) (map[string]indexSpec, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if isNamespaceNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s indexes: %w", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	var specs []indexSpec
+	if err := cursor.All(ctx, &specs); err != nil {
+		return nil, fmt.Errorf("error decoding %s indexes: %w", collection.Name(), err)
+	}
+
+	byName := make(map[string]indexSpec, len(specs))
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+	return byName, nil
+}
+
+// diff describes how the index differs from model, empty when it matches.
+func (spec indexSpec) diff(model mongo.IndexModel) string {
+	keys, _ := model.Keys.(bson.D)
+	opts := model.Options
+
+	var text bson.D
+	for _, key := range keys {
+		if key.Value == "text" {
+			text = append(text, bson.E{Key: key.Key, Value: 1})
+		}
+	}
+	if text != nil {
+		// MongoDB keeps the fields of a text index, and their weights, apart
+		// from its key.
+		if weights, ok := opts.Weights.(bson.D); ok {
+			text = weights
+		}
+		if !sameKeys(spec.Weights, text, true) {
+			return "has other text fields or weights"
+		}
+	} else if !sameKeys(spec.Key, keys, false) {
+		return "has other keys"
+	}
+
+	if spec.Unique != (opts.Unique != nil && *opts.Unique) {
+		return "differs in uniqueness"
+	}
+	if spec.Sparse != (opts.Sparse != nil && *opts.Sparse) {
+		return "differs in sparseness"
+	}
+	if (spec.ExpireAfterSeconds == nil) != (opts.ExpireAfterSeconds == nil) ||
+		spec.ExpireAfterSeconds != nil && *spec.ExpireAfterSeconds != int64(*opts.ExpireAfterSeconds) {
+		return "differs in expiry"
+	}
+	return ""
+}
+
+// sameKeys compares index keys, or the weights of a text index when
+// anyOrder is set, whose numbers MongoDB may store with another type.
+func sameKeys(got, want bson.D, anyOrder bool) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	values := make(map[string]any, len(got))
+	for i, key := range got {
+		if !anyOrder && key.Key != want[i].Key {
+			return false
+		}
+		values[key.Key] = key.Value
+	}
+	for _, key := range want {
+		value, ok := values[key.Key]
+		if !ok || !sameValue(value, key.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameValue compares the value of an index key, 1, -1 or a string such as
+// "2dsphere".
+func sameValue(got, want any) bool {
+	g, gok := number(got)
+	w, wok := number(want)
+	if gok || wok {
+		return gok && wok && g == w
+	}
+	return got == want
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// isNamespaceNotFound reports whether err says the collection doesn't exist
+// yet, in which case it has no indexes either.
+func isNamespaceNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 26
+}
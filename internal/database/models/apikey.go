@@ -0,0 +1,56 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scope limits what an API key may do.
+type Scope string
+
+const (
+	// ScopePostsRead reads published posts, like a reader.
+	ScopePostsRead Scope = "posts:read"
+	// ScopePostsWrite also creates posts and reads and changes the ones the key
+	// created, like a writer.
+	ScopePostsWrite Scope = "posts:write"
+)
+
+// Valid reports whether s is one of the known scopes.
+func (s Scope) Valid() bool {
+	return s == ScopePostsRead || s == ScopePostsWrite
+}
+
+// APIKey lets a program such as an ingest bot call the API without logging
+// in. Only a hash of the secret is stored, the secret itself is shown once
+// when the key is created or rotated.
+type APIKey struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// Name identifies the key, and is the author of the posts it creates.
+	Name   string  `bson:"name" json:"name"`
+	Scopes []Scope `bson:"scopes" json:"scopes"`
+	// Prefix is the start of the secret, to tell keys apart in listings.
+	Prefix string `bson:"prefix" json:"prefix"`
+	// Hash is the SHA-256 of the secret, never sent to clients.
+	Hash string `bson:"hash" json:"-"`
+	// RateLimit is how many requests per minute the key may make, zero for
+	// the server default.
+	RateLimit  int                `bson:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	RotatedAt  *time.Time         `bson:"rotated_at,omitempty" json:"rotated_at,omitempty"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Expired reports whether the key has expired by now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
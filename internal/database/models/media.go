@@ -0,0 +1,32 @@
+package models
+
+import "strings"
+
+// Media is an uploaded file used by a post, as a hero image or inline.
+type Media struct {
+	// Key names the file in the media store. It is derived from the hash of
+	// the bytes, so the same file uploaded twice has the same key.
+	Key         string `bson:"key" json:"key"`
+	ContentType string `bson:"content_type" json:"content_type"`
+	// Width and Height are the size of an image in pixels.
+	Width  int `bson:"width,omitempty" json:"width,omitempty"`
+	Height int `bson:"height,omitempty" json:"height,omitempty"`
+	// Alt describes the file for readers who can't see it.
+	Alt     string `bson:"alt,omitempty" json:"alt,omitempty"`
+	Caption string `bson:"caption,omitempty" json:"caption,omitempty"`
+}
+
+// URL is where the file is served from.
+func (m Media) URL() string {
+	return "/media/" + m.Key
+}
+
+// VariantURL is where the named resized variant of an image is served from.
+func (m Media) VariantURL(variant string) string {
+	return m.URL() + "/" + variant
+}
+
+// IsVideo reports whether the file is a video rather than an image.
+func (m Media) IsVideo() bool {
+	return strings.HasPrefix(m.ContentType, "video/")
+}
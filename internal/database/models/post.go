@@ -8,9 +8,31 @@ import (
 
 type Post struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Title     string             `bson:"title" json:"title" binding:"required"`
-	Content   string             `bson:"content" json:"content" binding:"required"`
-	Author    string             `bson:"author" json:"author" binding:"required"`
+	Title     string             `bson:"title" json:"title"`
+	Content   string             `bson:"content" json:"content"`
+	Author    string             `bson:"author" json:"author"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	// Version starts at 1 and grows by one with every update. It backs
+	// optimistic concurrency control through ETag and If-Match.
+	Version int64 `bson:"version" json:"version"`
+	// Status is where the post stands in the editorial workflow. It only
+	// changes through a transition, see database.Workflow.
+	Status PostStatus `bson:"status" json:"status"`
+	// PublishAt is when a scheduled post goes live. Until then it stays
+	// hidden, which also serves embargoes.
+	PublishAt *time.Time `bson:"publish_at,omitempty" json:"publish_at,omitempty"`
+	// UnpublishAt is when a published post is archived again.
+	UnpublishAt *time.Time `bson:"unpublish_at,omitempty" json:"unpublish_at,omitempty"`
+	// DeletedAt is set while the post sits in the trash. Trashed posts are
+	// hidden from every read path until restored or purged.
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	// AuthorID is the user or API key that created the post, and Author its
+	// name at the time. Both are set by the server, never by the client.
+	// Posts written before user accounts existed have no AuthorID.
+	AuthorID primitive.ObjectID `bson:"author_id,omitempty" json:"author_id,omitzero"`
+	// HeroImage leads the post, above the title.
+	HeroImage *Media `bson:"hero_image,omitempty" json:"hero_image,omitempty"`
+	// Media are shown with the content, in order.
+	Media []Media `bson:"media,omitempty" json:"media,omitempty"`
 }
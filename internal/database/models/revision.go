@@ -0,0 +1,50 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Revision is a snapshot of a post as it was before an update or a status
+// change replaced it.
+type Revision struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostID primitive.ObjectID `bson:"post_id" json:"post_id"`
+	// Version is the version of the post this snapshot holds.
+	Version int64  `bson:"version" json:"version"`
+	Title   string `bson:"title" json:"title"`
+	Content string `bson:"content" json:"content"`
+	Author  string `bson:"author" json:"author"`
+	// HeroImage and Media are the media of the post at this version.
+	// Revisions saved before they were recorded have none.
+	HeroImage *Media  `bson:"hero_image,omitempty" json:"hero_image,omitempty"`
+	Media     []Media `bson:"media,omitempty" json:"media,omitempty"`
+	// Status is where the post stood in the workflow at this version.
+	// Revisions saved before it was recorded have none.
+	Status PostStatus `bson:"status,omitempty" json:"status,omitempty"`
+	// Editor made the change that replaced this version, at CreatedAt.
+	Editor    string    `bson:"editor" json:"editor"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// NewRevision snapshots post, recording who replaced it and when.
+func NewRevision(post *Post, editor string, at time.Time) *Revision {
+	revision := &Revision{
+		PostID:    post.ID,
+		Version:   post.Version,
+		Title:     post.Title,
+		Content:   post.Content,
+		Author:    post.Author,
+		Media:     slices.Clone(post.Media),
+		Status:    post.Status,
+		Editor:    editor,
+		CreatedAt: at,
+	}
+	if post.HeroImage != nil {
+		hero := *post.HeroImage
+		revision.HeroImage = &hero
+	}
+	return revision
+}
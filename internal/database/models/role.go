@@ -0,0 +1,31 @@
+package models
+
+// Role decides what a signed-in member of the newsroom may do.
+type Role string
+
+const (
+	// RoleReader may read published posts but change none. Unpublished
+	// posts are left to their authors and reviewers.
+	RoleReader Role = "reader"
+	// RoleWriter drafts posts and submits them for review.
+	RoleWriter Role = "writer"
+	// RoleEditor reviews posts and decides what gets published.
+	RoleEditor Role = "editor"
+	// RoleAdmin may do anything an editor can, and manage users.
+	RoleAdmin Role = "admin"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleReader, RoleWriter, RoleEditor, RoleAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reviewer reports whether r may publish and archive posts.
+func (r Role) Reviewer() bool {
+	return r == RoleEditor || r == RoleAdmin
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session keeps a member of the newsroom signed in to the web UI. The
+// browser holds a random token in a cookie, only its hash is stored.
+type Session struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	// Hash is the SHA-256 of the cookie token.
+	Hash string `bson:"hash" json:"-"`
+	// CSRFToken must accompany every request of the session that changes
+	// data, which a third-party page can't read and so can't forge.
+	CSRFToken string    `bson:"csrf_token" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// Expired reports whether the session has expired by now.
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostStatus is the editorial state of a post. Only published posts are
+// visible to the public.
+type PostStatus string
+
+const (
+	StatusDraft     PostStatus = "draft"
+	StatusInReview  PostStatus = "in_review"
+	StatusScheduled PostStatus = "scheduled"
+	StatusPublished PostStatus = "published"
+	StatusArchived  PostStatus = "archived"
+)
+
+// Valid reports whether s is one of the known states.
+func (s PostStatus) Valid() bool {
+	switch s {
+	case StatusDraft, StatusInReview, StatusScheduled, StatusPublished, StatusArchived:
+		return true
+	default:
+		return false
+	}
+}
+
+// StatusChange records who moved a post from one state to another.
+type StatusChange struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostID    primitive.ObjectID `bson:"post_id" json:"post_id"`
+	From      PostStatus         `bson:"from" json:"from"`
+	To        PostStatus         `bson:"to" json:"to"`
+	Actor     string             `bson:"actor" json:"actor"`
+	Comment   string             `bson:"comment,omitempty" json:"comment,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
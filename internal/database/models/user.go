@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// User is a member of the newsroom who signs in to the API.
+type User struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// Username is what the user logs in with. It is unique and lower case.
+	Username string `bson:"username" json:"username"`
+	// Name is shown as the author of the user's posts.
+	Name string `bson:"name" json:"name"`
+	Role Role   `bson:"role" json:"role"`
+	// PasswordHash is never sent to clients.
+	PasswordHash string    `bson:"password_hash" json:"-"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DefaultPageLimit is used when ListOptions.Limit is zero.
+	DefaultPageLimit = 20
+	// MaxPageLimit caps how many posts a single page may hold.
+	MaxPageLimit = 100
+)
+
+// ListOptions selects one page of posts.
+type ListOptions struct {
+	// Limit is the page size, between 1 and MaxPageLimit.
+	Limit int
+	// Cursor is an opaque value taken from PostPage.NextCursor or
+	// PostPage.PrevCursor. Empty means the first page.
+	Cursor string
+	// WithTotal asks for the number of matching posts across all pages,
+	// which costs an extra count query.
+	WithTotal bool
+	// Filter narrows the listing, the zero value matches every post.
+	Filter PostFilter
+	// Sort orders the listing, the zero value is DefaultSort.
+	Sort Sort
+	// Trashed lists the posts in the trash instead of the live ones.
+	Trashed bool
+}
+
+// PostPage is one page of a keyset paginated listing.
+type PostPage struct {
+	Posts      []*models.Post
+	NextCursor string
+	PrevCursor string
+	Total      *int64
+}
+
+// Cursor is the decoded form of a page cursor. Pages are keyed on the sort
+// field plus _id so that posts sharing a sort value are never skipped.
+type Cursor struct {
+	Sort SortField `json:"s,omitempty"`
+	Asc  bool      `json:"a,omitempty"`
+	// Time holds the sort value for date fields, Text for title.
+	Time time.Time          `json:"t"`
+	Text string             `json:"x,omitempty"`
+	ID   primitive.ObjectID `json:"id"`
+	// Backward is set on cursors that walk towards the start of the listing.
+	Backward bool `json:"b,omitempty"`
+}
+
+// Encode returns the opaque string form of the cursor.
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Value returns the sort field value the cursor points at.
+func (c Cursor) Value() any {
+	if c.Sort == SortTitle {
+		return c.Text
+	}
+	return c.Time
+}
+
+// Post returns a stand-in post positioned at the cursor, which lets backends
+// compare stored posts against it with Sort.Compare.
+func (c Cursor) Post() *models.Post {
+	p := &models.Post{ID: c.ID, Title: c.Text}
+	switch c.Sort {
+	case SortUpdatedAt:
+		p.UpdatedAt = c.Time
+	case SortCreatedAt:
+		p.CreatedAt = c.Time
+	}
+	return p
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode.
+func DecodeCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, &ValidationError{Field: "cursor", Message: "is not a valid cursor"}
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return nil, &ValidationError{Field: "cursor", Message: "is not a valid cursor"}
+	}
+
+	// Cursors issued before sorting existed walk the default order.
+	if c.Sort == "" {
+		c.Sort = DefaultSort.Field
+	}
+
+	return &c, nil
+}
+
+// Normalize validates the options, fills in defaults and decodes the cursor.
+// A nil cursor means the first page.
+func (o *ListOptions) Normalize() (*Cursor, error) {
+	if o.Limit == 0 {
+		o.Limit = DefaultPageLimit
+	}
+	if o.Limit < 1 || o.Limit > MaxPageLimit {
+		return nil, &ValidationError{Field: "limit", Message: "must be between 1 and 100"}
+	}
+
+	if o.Sort.Field == "" {
+		o.Sort = DefaultSort
+	}
+	if err := o.Sort.Validate(); err != nil {
+		return nil, err
+	}
+	if err := o.Filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	cursor, err := DecodeCursor(o.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cursor.Sort != o.Sort.Field || cursor.Asc != o.Sort.Asc {
+		return nil, &ValidationError{Field: "cursor", Message: "was issued for a different sort order"}
+	}
+
+	return cursor, nil
+}
+
+// NewPostPage turns the posts fetched for a page into a PostPage. Backends
+// fetch up to limit+1 posts in traversal order, which is reversed when the
+// cursor walks backward, so that a surplus post signals another page.
+func NewPostPage(posts []*models.Post, opts ListOptions, cursor *Cursor) *PostPage {
+	hasMore := len(posts) > opts.Limit
+	if hasMore {
+		posts = posts[:opts.Limit]
+	}
+
+	backward := cursor != nil && cursor.Backward
+	if backward {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+
+	page := &PostPage{Posts: posts}
+	if len(posts) == 0 {
+		return page
+	}
+
+	first, last := posts[0], posts[len(posts)-1]
+	if (!backward && hasMore) || backward {
+		page.NextCursor = cursorAt(last, opts.Sort, false).Encode()
+	}
+	if (backward && hasMore) || (!backward && cursor != nil) {
+		page.PrevCursor = cursorAt(first, opts.Sort, true).Encode()
+	}
+
+	return page
+}
+
+// CursorAfter returns a cursor for the page that starts right after post in
+// the given order, for callers that split a listing at a post of their own
+// choosing rather than at a page boundary.
+func CursorAfter(post *models.Post, sort Sort) string {
+	return cursorAt(post, sort, false).Encode()
+}
+
+func cursorAt(post *models.Post, sort Sort, backward bool) Cursor {
+	c := Cursor{Sort: sort.Field, Asc: sort.Asc, ID: post.ID, Backward: backward}
+	switch sort.Field {
+	case SortTitle:
+		c.Text = post.Title
+	case SortUpdatedAt:
+		c.Time = post.UpdatedAt
+	default:
+		c.Time = post.CreatedAt
+	}
+	return c
+}
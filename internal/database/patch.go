@@ -0,0 +1,107 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"test-news/internal/database/models"
+)
+
+// PostPatch lists the client editable fields of a post that an update
+// changes. Nil fields are left alone, so a patch never touches server
+// managed fields such as the ID or created_at.
+type PostPatch struct {
+	Title   *string
+	Content *string
+	// HeroImage replaces the hero image, RemoveHeroImage takes it away.
+	HeroImage       *models.Media
+	RemoveHeroImage bool
+	// Media replaces the whole list of inline media when not nil.
+	Media *[]models.Media
+}
+
+// PatchFromPost returns a patch replacing the title and content with the
+// values of post, which is what a full update (PUT) does. The author is set
+// once from the account creating the post and never patched, and the media
+// of a post only change through a patch that names them.
+func PatchFromPost(post *models.Post) PostPatch {
+	return PostPatch{Title: &post.Title, Content: &post.Content}
+}
+
+// PatchFromRevision returns a patch bringing a post back to the version
+// revision holds, media included.
+func PatchFromRevision(revision *models.Revision) PostPatch {
+	media := revision.Media
+	return PostPatch{
+		Title:           &revision.Title,
+		Content:         &revision.Content,
+		HeroImage:       revision.HeroImage,
+		RemoveHeroImage: revision.HeroImage == nil,
+		Media:           &media,
+	}
+}
+
+// IsEmpty reports whether the patch changes nothing.
+func (p PostPatch) IsEmpty() bool {
+	return p.Title == nil && p.Content == nil &&
+		p.HeroImage == nil && !p.RemoveHeroImage && p.Media == nil
+}
+
+// Validate applies the rules of ValidatePost to the fields being changed.
+func (p PostPatch) Validate() error {
+	if p.Title != nil && strings.TrimSpace(*p.Title) == "" {
+		return &ValidationError{Field: "title", Message: "must not be empty"}
+	}
+	if p.Content != nil && strings.TrimSpace(*p.Content) == "" {
+		return &ValidationError{Field: "content", Message: "must not be empty"}
+	}
+	if p.HeroImage != nil && p.HeroImage.Key == "" {
+		return &ValidationError{Field: "hero_image", Message: "must name an uploaded file"}
+	}
+	if p.Media != nil {
+		if err := validateMedia(*p.Media); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply copies the changed fields onto post.
+func (p PostPatch) Apply(post *models.Post) {
+	if p.Title != nil {
+		post.Title = *p.Title
+	}
+	if p.Content != nil {
+		post.Content = *p.Content
+	}
+	if p.HeroImage != nil {
+		hero := *p.HeroImage
+		post.HeroImage = &hero
+	}
+	if p.RemoveHeroImage {
+		post.HeroImage = nil
+	}
+	if p.Media != nil {
+		post.Media = slices.Clone(*p.Media)
+	}
+}
+
+// set returns the fields being changed as a Mongo $set document.
+func (p PostPatch) set() map[string]any {
+	set := make(map[string]any, 4)
+	if p.Title != nil {
+		set["title"] = *p.Title
+	}
+	if p.Content != nil {
+		set["content"] = *p.Content
+	}
+	if p.HeroImage != nil {
+		set["hero_image"] = p.HeroImage
+	}
+	if p.RemoveHeroImage {
+		set["hero_image"] = nil
+	}
+	if p.Media != nil {
+		set["media"] = *p.Media
+	}
+	return set
+}
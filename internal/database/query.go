@@ -0,0 +1,161 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SortField names a post field that listings can be ordered by.
+type SortField string
+
+const (
+	SortCreatedAt SortField = "created_at"
+	SortUpdatedAt SortField = "updated_at"
+	SortTitle     SortField = "title"
+)
+
+// Sort orders a listing. The zero value is newest first.
+type Sort struct {
+	Field SortField
+	Asc   bool
+}
+
+// DefaultSort is the order used when no sort is requested.
+var DefaultSort = Sort{Field: SortCreatedAt}
+
+// RangeOp compares a time field against a bound.
+type RangeOp string
+
+const (
+	OpGT  RangeOp = "gt"
+	OpGTE RangeOp = "gte"
+	OpLT  RangeOp = "lt"
+	OpLTE RangeOp = "lte"
+)
+
+// TimeBound is one side of a date range, such as created_at >= 2024-01-01.
+type TimeBound struct {
+	Op    RangeOp
+	Value time.Time
+}
+
+// PostFilter narrows a listing. Every set condition must hold.
+type PostFilter struct {
+	// Author matches the author name exactly.
+	Author string
+	// AuthorID matches the account that created the post, when not zero.
+	AuthorID primitive.ObjectID
+	// TitlePrefix matches titles starting with it, ignoring case.
+	TitlePrefix string
+	Created     []TimeBound
+	Updated     []TimeBound
+	// Status matches any of the given states, empty matches every state.
+	Status []models.PostStatus
+	// UnpublishedBy, when not zero, only lets unpublished posts match when
+	// they belong to that account. Published posts match as usual.
+	UnpublishedBy primitive.ObjectID
+}
+
+// Validate rejects sort fields and operators no backend understands.
+func (s Sort) Validate() error {
+	switch s.Field {
+	case SortCreatedAt, SortUpdatedAt, SortTitle:
+		return nil
+	default:
+		return &ValidationError{Field: "sort", Message: "must be one of created_at, updated_at or title"}
+	}
+}
+
+// Validate rejects operators and states no backend understands.
+func (f PostFilter) Validate() error {
+	for _, status := range f.Status {
+		if !status.Valid() {
+			return &ValidationError{Field: "status", Message: "unknown status " + string(status)}
+		}
+	}
+	for field, bounds := range map[string][]TimeBound{"created_at": f.Created, "updated_at": f.Updated} {
+		seen := make(map[RangeOp]bool)
+		for _, b := range bounds {
+			switch b.Op {
+			case OpGT, OpGTE, OpLT, OpLTE:
+			default:
+				return &ValidationError{Field: field, Message: "unknown operator " + string(b.Op)}
+			}
+			if seen[b.Op] {
+				return &ValidationError{Field: field, Message: "operator " + string(b.Op) + " given more than once"}
+			}
+			seen[b.Op] = true
+		}
+	}
+	return nil
+}
+
+// Match reports whether post satisfies the filter. Backends without a native
+// query language, such as the in-memory one, filter with it directly.
+func (f PostFilter) Match(post *models.Post) bool {
+	if f.Author != "" && post.Author != f.Author {
+		return false
+	}
+	if !f.AuthorID.IsZero() && post.AuthorID != f.AuthorID {
+		return false
+	}
+	if f.TitlePrefix != "" && !strings.HasPrefix(strings.ToLower(post.Title), strings.ToLower(f.TitlePrefix)) {
+		return false
+	}
+	if len(f.Status) > 0 && !slices.Contains(f.Status, post.Status) {
+		return false
+	}
+	if !f.UnpublishedBy.IsZero() && post.Status != models.StatusPublished && post.AuthorID != f.UnpublishedBy {
+		return false
+	}
+	return matchBounds(post.CreatedAt, f.Created) && matchBounds(post.UpdatedAt, f.Updated)
+}
+
+func matchBounds(t time.Time, bounds []TimeBound) bool {
+	for _, b := range bounds {
+		var ok bool
+		switch b.Op {
+		case OpGT:
+			ok = t.After(b.Value)
+		case OpGTE:
+			ok = !t.Before(b.Value)
+		case OpLT:
+			ok = t.Before(b.Value)
+		case OpLTE:
+			ok = !t.After(b.Value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare orders a before b under s, returning a negative number when a
+// comes first. Ties on the sort field are broken by ID in the same direction
+// so that every post has a unique position.
+func (s Sort) Compare(a, b *models.Post) int {
+	c := compareField(a, b, s.Field)
+	if c == 0 {
+		c = strings.Compare(a.ID.Hex(), b.ID.Hex())
+	}
+	if !s.Asc {
+		c = -c
+	}
+	return c
+}
+
+func compareField(a, b *models.Post, field SortField) int {
+	switch field {
+	case SortTitle:
+		return strings.Compare(a.Title, b.Title)
+	case SortUpdatedAt:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	default:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test-news/internal/database/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *service) getRevisions() *mongo.Collection {
+	return s.db.Database(database).Collection("post_revisions")
+}
+
+func (s *service) saveRevision(ctx context.Context, revision *models.Revision) error {
+	revision.ID = primitive.NewObjectID()
+
+	_, err := s.getRevisions().InsertOne(ctx, revision)
+	if err != nil {
+		return fmt.Errorf("error saving revision: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) ListRevisions(ctx context.Context, postID string) ([]*models.Revision, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	//version descending (newest first)
+	findOptions := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+
+	cursor, err := s.getRevisions().Find(ctx, bson.M{"post_id": objectID}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching revisions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []*models.Revision{}
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return nil, fmt.Errorf("error decoding revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+func (s *service) GetRevision(ctx context.Context, postID string, version int64) (*models.Revision, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	var revision models.Revision
+	err = s.getRevisions().FindOne(ctx, bson.M{"post_id": objectID, "version": version}).Decode(&revision)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("error fetching revision: %w", err)
+	}
+
+	return &revision, nil
+}
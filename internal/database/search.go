@@ -0,0 +1,156 @@
+package database
+
+import (
+	"html"
+	"strings"
+	"test-news/internal/database/models"
+	"unicode"
+)
+
+// Text search weights, a match in the title counts five times as much as a
+// match in the content. The text index of migration 1 is built with them, so
+// changing them takes a new migration.
+const (
+	titleWeight   = 10
+	contentWeight = 2
+)
+
+// snippetRadius is how many runes of context surround the first match.
+const snippetRadius = 80
+
+// SearchResult is a post matched by a full-text search.
+type SearchResult struct {
+	Post *models.Post
+	// Score is the relevance reported by the backend, higher is better.
+	// Scores are only comparable within one result set.
+	Score float64
+	// Snippet is an HTML fragment of the content around the first match
+	// with every matched word wrapped in <mark>. All other text is escaped.
+	Snippet string
+}
+
+// SearchTerms splits a search query into lower case terms, dropping the
+// quotes and negations understood by the Mongo text search syntax.
+func SearchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '-'
+	}) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		if term := strings.Trim(field, "-"); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// stem trims common English suffixes so that "storms" finds "storm". It is
+// deliberately crude, the goal is highlighting what the text index matched.
+func stem(term string) string {
+	for _, suffix := range []string{"ing", "es", "ed", "s"} {
+		if len(term) > len(suffix)+2 && strings.HasSuffix(term, suffix) {
+			return strings.TrimSuffix(term, suffix)
+		}
+	}
+	return term
+}
+
+// matchesTerm reports whether word, in lower case, matches one of the terms.
+func matchesTerm(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, stem(term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// words splits text into words, keeping the rune offsets of each.
+func words(text []rune) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if inWord && start < 0 {
+			start = i
+		}
+		if !inWord && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// ScorePost rates post against the terms with the same weights as the Mongo
+// text index. Zero means no match.
+func ScorePost(post *models.Post, terms []string) float64 {
+	return float64(titleWeight*countMatches(post.Title, terms) + contentWeight*countMatches(post.Content, terms))
+}
+
+func countMatches(text string, terms []string) int {
+	runes := []rune(text)
+	n := 0
+	for _, span := range words(runes) {
+		if matchesTerm(strings.ToLower(string(runes[span[0]:span[1]])), terms) {
+			n++
+		}
+	}
+	return n
+}
+
+// Highlight returns an escaped HTML snippet of text around the first word
+// matching one of the terms, with every matching word wrapped in <mark>.
+// Without a match the snippet is the start of the text.
+func Highlight(text string, terms []string) string {
+	runes := []rune(text)
+	spans := words(runes)
+
+	first := -1
+	for _, span := range spans {
+		if matchesTerm(strings.ToLower(string(runes[span[0]:span[1]])), terms) {
+			first = span[0]
+			break
+		}
+	}
+
+	from, to := 0, len(runes)
+	if first > snippetRadius {
+		from = first - snippetRadius
+	}
+	if from+2*snippetRadius < to {
+		to = from + 2*snippetRadius
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, span := range spans {
+		if span[1] <= from || span[0] >= to {
+			continue
+		}
+		start, end := max(span[0], from), min(span[1], to)
+		word := string(runes[start:end])
+		if !matchesTerm(strings.ToLower(string(runes[span[0]:span[1]])), terms) {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(word))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
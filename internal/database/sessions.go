@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ValidateSession checks the fields every stored session must have.
+func ValidateSession(session *models.Session) error {
+	if session.UserID.IsZero() {
+		return &ValidationError{Field: "user_id", Message: "must not be empty"}
+	}
+	if session.Hash == "" {
+		return &ValidationError{Field: "hash", Message: "must not be empty"}
+	}
+	if session.CSRFToken == "" {
+		return &ValidationError{Field: "csrf_token", Message: "must not be empty"}
+	}
+	if session.ExpiresAt.IsZero() {
+		return &ValidationError{Field: "expires_at", Message: "must not be empty"}
+	}
+	return nil
+}
+
+func (s *service) getSessions() *mongo.Collection {
+	return s.db.Database(database).Collection("sessions")
+}
+
+func (s *service) CreateSession(ctx context.Context, session *models.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if err := ValidateSession(session); err != nil {
+		return err
+	}
+
+	session.ID = primitive.NewObjectID()
+	session.CreatedAt = time.Now()
+
+	if _, err := s.getSessions().InsertOne(ctx, session); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("error creating session: %w", ErrConflict)
+		}
+		return fmt.Errorf("error creating session: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) GetSessionByHash(ctx context.Context, hash string) (*models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var session models.Session
+	if err := s.getSessions().FindOne(ctx, bson.M{"hash": hash}).Decode(&session); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("error fetching session: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (s *service) DeleteSession(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.getSessions().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RestorePost takes a post out of the trash and returns it. It fails with
+// ErrPostNotFound when the post is not in the trash.
+func (s *service) RestorePost(ctx context.Context, id string) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	var post models.Post
+	err = s.getCollection().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deleted_at": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&post)
+
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrPostNotFound
+		}
+		return nil, fmt.Errorf("error restoring post: %w", err)
+	}
+
+	return &post, nil
+}
+
+func (s *service) GetTrashedPost(ctx context.Context, id string) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	var post models.Post
+	err = s.getCollection().FindOne(ctx, bson.M{"_id": objectID, "deleted_at": bson.M{"$ne": nil}}).Decode(&post)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrPostNotFound
+		}
+		return nil, fmt.Errorf("error fetching post: %w", err)
+	}
+
+	return &post, nil
+}
+
+func (s *service) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	collection := s.getCollection()
+	expired := bson.M{"deleted_at": bson.M{"$lt": before}}
+
+	// Collect the IDs first so that the revisions of these posts can go
+	// with them.
+	ids, err := collection.Distinct(ctx, "_id", expired)
+	if err != nil {
+		return 0, fmt.Errorf("error finding expired posts: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, fmt.Errorf("error purging posts: %w", err)
+	}
+
+	// A post restored in the meantime was not deleted and keeps its history.
+	restored, err := collection.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return result.DeletedCount, fmt.Errorf("error finding purged posts: %w", err)
+	}
+
+	if restored == nil {
+		restored = bson.A{}
+	}
+
+	history := bson.M{"post_id": bson.M{"$in": ids, "$nin": restored}}
+	if _, err := s.getRevisions().DeleteMany(ctx, history); err != nil {
+		return result.DeletedCount, fmt.Errorf("error purging revisions: %w", err)
+	}
+	if _, err := s.getStatusChanges().DeleteMany(ctx, history); err != nil {
+		return result.DeletedCount, fmt.Errorf("error purging status changes: %w", err)
+	}
+
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// usernamePattern is what a username may look like once lower-cased.
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,31}$`)
+
+// NormalizeUsername returns the form usernames are stored and looked up in.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// ValidateUser checks the fields every stored user must have. The username
+// is expected to be normalized already, see NormalizeUsername.
+func ValidateUser(user *models.User) error {
+	if !usernamePattern.MatchString(user.Username) {
+		return &ValidationError{Field: "username", Message: "must be 2 to 32 letters, digits, dots, dashes or underscores"}
+	}
+	if strings.TrimSpace(user.Name) == "" {
+		return &ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if err := ValidateRole(user.Role); err != nil {
+		return err
+	}
+	if user.PasswordHash == "" {
+		return &ValidationError{Field: "password", Message: "must not be empty"}
+	}
+	return nil
+}
+
+// ValidateRole checks that role is one of the known roles.
+func ValidateRole(role models.Role) error {
+	if !role.Valid() {
+		return &ValidationError{Field: "role", Message: "must be reader, writer, editor or admin"}
+	}
+	return nil
+}
+
+func (s *service) getUsers() *mongo.Collection {
+	return s.db.Database(database).Collection("users")
+}
+
+func (s *service) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	user.Username = NormalizeUsername(user.Username)
+	if err := ValidateUser(user); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	if _, err := s.getUsers().InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrUsernameTaken
+		}
+		return fmt.Errorf("error creating user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) GetUser(ctx context.Context, id string) (*models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	return s.findUser(ctx, bson.M{"_id": objectID})
+}
+
+func (s *service) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return s.findUser(ctx, bson.M{"username": NormalizeUsername(username)})
+}
+
+func (s *service) ListUsers(ctx context.Context) ([]*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	cursor, err := s.getUsers().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "username", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []*models.User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *service) SetUserRole(ctx context.Context, id string, role models.Role) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+	if err := ValidateRole(role); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = s.getUsers().FindOneAndUpdate(ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error updating user: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (s *service) findUser(ctx context.Context, filter bson.M) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var user models.User
+	if err := s.getUsers().FindOne(ctx, filter).Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error fetching user: %w", err)
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Transition is an allowed move between two post states.
+type Transition struct {
+	From models.PostStatus
+	To   models.PostStatus
+	// ReviewerOnly transitions need a reviewer, see models.Role.Reviewer.
+	ReviewerOnly bool
+}
+
+// Workflow lists every allowed transition. Writers submit their drafts for
+// review, and reviewers decide what is published, scheduled, unpublished or
+// archived. The scheduler publishes scheduled posts when they are due.
+var Workflow = []Transition{
+	{From: models.StatusDraft, To: models.StatusInReview},
+	{From: models.StatusInReview, To: models.StatusDraft},
+	{From: models.StatusInReview, To: models.StatusPublished, ReviewerOnly: true},
+	{From: models.StatusDraft, To: models.StatusPublished, ReviewerOnly: true},
+	{From: models.StatusInReview, To: models.StatusScheduled, ReviewerOnly: true},
+	{From: models.StatusDraft, To: models.StatusScheduled, ReviewerOnly: true},
+	{From: models.StatusScheduled, To: models.StatusPublished, ReviewerOnly: true},
+	{From: models.StatusScheduled, To: models.StatusDraft, ReviewerOnly: true},
+	{From: models.StatusPublished, To: models.StatusDraft, ReviewerOnly: true},
+	{From: models.StatusPublished, To: models.StatusArchived, ReviewerOnly: true},
+	{From: models.StatusArchived, To: models.StatusDraft, ReviewerOnly: true},
+}
+
+// FindTransition returns the transition from one state to another, or
+// ErrInvalidTransition when the workflow has no such move.
+func FindTransition(from models.PostStatus, to models.PostStatus) (*Transition, error) {
+	if !to.Valid() {
+		return nil, &ValidationError{Field: "status", Message: "must be one of draft, in_review, scheduled, published or archived"}
+	}
+	for _, t := range Workflow {
+		if t.From == from && t.To == to {
+			return &t, nil
+		}
+	}
+	return nil, ErrInvalidTransition
+}
+
+// StatusUpdate describes a transition of one post.
+type StatusUpdate struct {
+	From    models.PostStatus
+	To      models.PostStatus
+	Comment string
+	// PublishAt is required when scheduling a post and not allowed otherwise.
+	PublishAt *time.Time
+	// UnpublishAt optionally archives a scheduled or published post later.
+	UnpublishAt *time.Time
+}
+
+// Validate checks that the transition exists and that the schedule fits it.
+func (u StatusUpdate) Validate() error {
+	if _, err := FindTransition(u.From, u.To); err != nil {
+		return err
+	}
+
+	if u.To == models.StatusScheduled && u.PublishAt == nil {
+		return &ValidationError{Field: "publish_at", Message: "is required to schedule a post"}
+	}
+	if u.To != models.StatusScheduled && u.PublishAt != nil {
+		return &ValidationError{Field: "publish_at", Message: "is only allowed when scheduling a post"}
+	}
+	if u.UnpublishAt != nil {
+		if u.To != models.StatusScheduled && u.To != models.StatusPublished {
+			return &ValidationError{Field: "unpublish_at", Message: "is only allowed when scheduling or publishing a post"}
+		}
+		if u.PublishAt != nil && !u.UnpublishAt.After(*u.PublishAt) {
+			return &ValidationError{Field: "unpublish_at", Message: "must be after publish_at"}
+		}
+	}
+	return nil
+}
+
+// Apply moves post to the new status and schedule. Publishing keeps an
+// unpublish time set while the post was scheduled, every other state drops
+// the schedule.
+func (u StatusUpdate) Apply(post *models.Post) {
+	post.Status = u.To
+	switch u.To {
+	case models.StatusScheduled:
+		post.PublishAt = u.PublishAt
+		post.UnpublishAt = u.UnpublishAt
+	case models.StatusPublished:
+		post.PublishAt = nil
+		if u.UnpublishAt != nil {
+			post.UnpublishAt = u.UnpublishAt
+		}
+	default:
+		post.PublishAt = nil
+		post.UnpublishAt = nil
+	}
+}
+
+// Due reports the state a post should move to on its own at time now, or
+// false when it should stay where it is.
+func Due(post *models.Post, now time.Time) (models.PostStatus, bool) {
+	switch {
+	case post.Status == models.StatusScheduled && post.PublishAt != nil && !post.PublishAt.After(now):
+		return models.StatusPublished, true
+	case post.Status == models.StatusPublished && post.UnpublishAt != nil && !post.UnpublishAt.After(now):
+		return models.StatusArchived, true
+	default:
+		return "", false
+	}
+}
+
+func (s *service) getStatusChanges() *mongo.Collection {
+	return s.db.Database(database).Collection("post_transitions")
+}
+
+func (s *service) TransitionPost(ctx context.Context, id string, update StatusUpdate) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Update the modification time, at the precision Mongo stores
+	now := time.Now().Truncate(time.Millisecond)
+
+	// Work out the schedule with Apply, then store what it set and drop
+	// what it cleared.
+	var scheduled models.Post
+	update.Apply(&scheduled)
+	set := bson.M{"status": update.To, "updated_at": now}
+	unset := bson.M{}
+	if scheduled.PublishAt != nil {
+		set["publish_at"] = scheduled.PublishAt
+	} else {
+		unset["publish_at"] = ""
+	}
+	if scheduled.UnpublishAt != nil {
+		set["unpublish_at"] = scheduled.UnpublishAt
+	} else if update.To != models.StatusPublished {
+		unset["unpublish_at"] = ""
+	}
+
+	changes := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		changes["$unset"] = unset
+	}
+
+	// As with PatchPost, the document before the change is the revision of
+	// the version it replaces, and the changed post follows from it.
+	var previous models.Post
+	err = s.getCollection().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectID, "deleted_at": nil, "status": update.From},
+		changes,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&previous)
+
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, s.missOrMismatch(ctx, objectID, ErrStatusChanged)
+		}
+		return nil, fmt.Errorf("error changing post status: %w", err)
+	}
+
+	if err := s.saveRevision(ctx, models.NewRevision(&previous, EditorFrom(ctx), now)); err != nil {
+		log.Printf("Failed to save revision %d of post %s: %v", previous.Version, id, err)
+	}
+
+	post := previous
+	update.Apply(&post)
+	post.UpdatedAt = now
+	post.Version++
+
+	// Like revisions, the log must not turn an applied change into an error.
+	change := &models.StatusChange{
+		ID:        primitive.NewObjectID(),
+		PostID:    objectID,
+		From:      update.From,
+		To:        update.To,
+		Actor:     EditorFrom(ctx),
+		Comment:   update.Comment,
+		CreatedAt: now,
+	}
+	if _, err := s.getStatusChanges().InsertOne(ctx, change); err != nil {
+		log.Printf("Failed to log the status change of post %s: %v", id, err)
+	}
+
+	return &post, nil
+}
+
+func (s *service) DuePosts(ctx context.Context, now time.Time, limit int) ([]*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	filter := bson.M{"deleted_at": nil, "$or": bson.A{
+		bson.M{"status": models.StatusScheduled, "publish_at": bson.M{"$lte": now}},
+		bson.M{"status": models.StatusPublished, "unpublish_at": bson.M{"$lte": now}},
+	}}
+
+	cursor, err := s.getCollection().Find(ctx, filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching due posts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var posts []*models.Post
+	if err = cursor.All(ctx, &posts); err != nil {
+		return nil, fmt.Errorf("error decoding posts: %w", err)
+	}
+
+	return posts, nil
+}
+
+func (s *service) ListStatusChanges(ctx context.Context, postID string) ([]*models.StatusChange, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return nil, InvalidIDError(err)
+	}
+
+	//time descending (newest first)
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+
+	cursor, err := s.getStatusChanges().Find(ctx, bson.M{"post_id": objectID}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching status changes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	changes := []*models.StatusChange{}
+	if err = cursor.All(ctx, &changes); err != nil {
+		return nil, fmt.Errorf("error decoding status changes: %w", err)
+	}
+
+	return changes, nil
+}
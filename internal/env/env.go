@@ -0,0 +1,84 @@
+// Package env reads the settings of the news server from environment
+// variables. Every reader falls back to a default when its variable is unset
+// and logs, then ignores, a value it cannot use.
+package env
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Int reads a positive integer from key, falling back when it is unset or
+// invalid.
+func Int(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		ignore(key, value, fallback)
+		return fallback
+	}
+
+	return n
+}
+
+// Duration reads a positive duration such as "15m" from key, falling back
+// when it is unset or invalid.
+func Duration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		ignore(key, value, fallback)
+		return fallback
+	}
+
+	return d
+}
+
+// Bool reads a boolean such as "true" or "0" from key, falling back when it
+// is unset or invalid.
+func Bool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		ignore(key, value, fallback)
+		return fallback
+	}
+
+	return b
+}
+
+// List reads a comma separated list from key, falling back when it is
+// unset. Set to an empty value, it yields an empty list.
+func List(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func ignore(key, value string, fallback any) {
+	log.Printf("Ignoring invalid %s %q, using %v", key, value, fallback)
+}
@@ -0,0 +1,56 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInt(t *testing.T) {
+	const key = "TEST_ENV_INT"
+	for value, want := range map[string]int{"": 7, "12": 12, "0": 7, "-3": 7, "many": 7} {
+		t.Setenv(key, value)
+		if got := Int(key, 7); got != want {
+			t.Errorf("Int(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	const key = "TEST_ENV_DURATION"
+	for value, want := range map[string]time.Duration{"": time.Second, "15m": 15 * time.Minute, "0s": time.Second, "soon": time.Second} {
+		t.Setenv(key, value)
+		if got := Duration(key, time.Second); got != want {
+			t.Errorf("Duration(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestBool(t *testing.T) {
+	const key = "TEST_ENV_BOOL"
+	for value, want := range map[string]bool{"": true, "false": false, "0": false, "yes please": true} {
+		t.Setenv(key, value)
+		if got := Bool(key, true); got != want {
+			t.Errorf("Bool(%q) = %t, want %t", value, got, want)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	const key = "TEST_ENV_LIST"
+	fallback := []string{"/api/"}
+
+	if got := List(key, fallback); !reflect.DeepEqual(got, fallback) {
+		t.Errorf("List() of an unset key = %q, want the fallback", got)
+	}
+
+	t.Setenv(key, " /a/ , ,/b/")
+	if got := List(key, fallback); !reflect.DeepEqual(got, []string{"/a/", "/b/"}) {
+		t.Errorf("List() = %q", got)
+	}
+
+	t.Setenv(key, "")
+	if got := List(key, fallback); len(got) != 0 {
+		t.Errorf("List() of an empty value = %q, want none", got)
+	}
+}
@@ -0,0 +1,82 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// AtomContentType is the media type of Atom documents.
+const AtomContentType = "application/atom+xml; charset=utf-8"
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Link      atomLink    `xml:"link"`
+	Author    atomPerson  `xml:"author"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Atom encodes the feed as Atom (RFC 4287). A feed without posts takes the
+// Unix epoch as the time it was updated, which Atom requires.
+func (f *Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		ID:       f.FeedURL,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  atomTime(f.Updated),
+		Links: []atomLink{
+			{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.HomeURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	for _, item := range f.Items {
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Link:      atomLink{Href: item.ID, Rel: "alternate", Type: "text/html"},
+			Author:    atomPerson{Name: item.Author},
+			Published: atomTime(item.Published),
+			Updated:   atomTime(item.Updated),
+			Content:   atomContent{Type: "html", Value: item.ContentHTML},
+		})
+	}
+
+	return encodeXML(doc)
+}
+
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,112 @@
+// Package feed publishes the latest posts as syndication feeds: RSS, Atom
+// and JSON Feed. The posts are selected and turned into a Feed once, which
+// each format then encodes.
+package feed
+
+import (
+	"context"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"test-news/internal/markdown"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limit is how many posts a feed lists.
+const Limit = 20
+
+// Select returns the posts a feed lists: the latest published posts, newest
+// first, of the account authorID unless it is zero. Drafts and scheduled
+// posts never reach a feed, whoever asks for it.
+func Select(ctx context.Context, db database.Service, authorID primitive.ObjectID) ([]*models.Post, error) {
+	page, err := db.ListPosts(ctx, database.ListOptions{
+		Limit: Limit,
+		Filter: database.PostFilter{
+			AuthorID: authorID,
+			Status:   []models.PostStatus{models.StatusPublished},
+		},
+		Sort: database.DefaultSort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page.Posts, nil
+}
+
+// Renderer turns the content of a post into HTML, see markdown.Cache.
+type Renderer interface {
+	Render(post *models.Post) (string, error)
+}
+
+// Feed is a feed in a form independent of its format.
+type Feed struct {
+	Title       string
+	Description string
+	// HomeURL is the page of the site the feed follows, FeedURL the feed
+	// document itself.
+	HomeURL string
+	FeedURL string
+	// Author is set for the feed of a single author.
+	Author string
+	// Updated is when the newest change to a post of the feed was made. It
+	// is zero for a feed without posts.
+	Updated time.Time
+	Items   []Item
+}
+
+// Item is a post in a feed.
+type Item struct {
+	// ID is the permanent URL of the post, which also identifies it.
+	ID          string
+	Title       string
+	Author      string
+	Published   time.Time
+	Updated     time.Time
+	ContentHTML string
+	ContentText string
+	// Image is the URL of the hero image of the post, if it has one.
+	Image string
+}
+
+// New builds the feed of posts for the site at baseURL, rendering their
+// content with render.
+func New(title string, description string, baseURL string, feedURL string, posts []*models.Post, render Renderer) (*Feed, error) {
+	f := &Feed{
+		Title:       title,
+		Description: description,
+		HomeURL:     baseURL + "/web/posts",
+		FeedURL:     feedURL,
+		Items:       make([]Item, 0, len(posts)),
+	}
+
+	for _, post := range posts {
+		content, err := render.Render(post)
+		if err != nil {
+			return nil, err
+		}
+		text, err := markdown.PlainText(post.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		item := Item{
+			ID:          baseURL + "/web/posts/" + post.ID.Hex(),
+			Title:       post.Title,
+			Author:      post.Author,
+			Published:   post.CreatedAt.UTC(),
+			Updated:     post.UpdatedAt.UTC(),
+			ContentHTML: content,
+			ContentText: text,
+		}
+		if post.HeroImage != nil {
+			item.Image = baseURL + post.HeroImage.VariantURL("full")
+		}
+		f.Items = append(f.Items, item)
+		if post.UpdatedAt.After(f.Updated) {
+			f.Updated = post.UpdatedAt.UTC()
+		}
+	}
+
+	return f, nil
+}
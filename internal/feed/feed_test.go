@@ -0,0 +1,289 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/database/memory"
+	"test-news/internal/database/models"
+	"test-news/internal/markdown"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testFeed(t *testing.T) *Feed {
+	t.Helper()
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	posts := []*models.Post{{
+		ID:        primitive.NewObjectID(),
+		Title:     "Fish & <chips>",
+		Content:   "Tasty **and** cheap <script>alert(1)</script>",
+		Author:    "jane",
+		CreatedAt: created,
+		UpdatedAt: created.Add(2 * time.Hour),
+		Version:   2,
+		HeroImage: &models.Media{Key: strings.Repeat("a", 64) + ".png", ContentType: "image/png"},
+	}}
+
+	f, err := New("Test News", "The latest posts", "https://news.example", "https://news.example/feed.atom", posts, markdown.NewCache(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestSelect(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	jane, john := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// The author of a feed is an account, so a post merely named after jane
+	// stays out of her feed.
+	for _, p := range []struct {
+		authorID primitive.ObjectID
+		author   string
+		publish  bool
+	}{{jane, "jane", true}, {john, "john", true}, {jane, "jane", false}, {john, "jane", true}} {
+		post := &models.Post{Title: "Post", Content: "body", Author: p.author, AuthorID: p.authorID}
+		if err := db.CreatePost(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+		if p.publish {
+			if _, err := db.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusPublished}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	all, err := Select(ctx, db, primitive.NilObjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected the 3 published posts, got %d", len(all))
+	}
+	janes, err := Select(ctx, db, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(janes) != 1 || janes[0].AuthorID != jane || janes[0].Status != models.StatusPublished {
+		t.Fatalf("expected the published post of jane, got %+v", janes)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	body, err := testFeed(t).RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title       string `xml:"title"`
+				GUID        string `xml:"guid"`
+				PubDate     string `xml:"pubDate"`
+				Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+				Description string `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("expected well formed XML: %v\n%s", err, body)
+	}
+	if len(doc.Channel.Items) != 1 {
+		t.Fatalf("expected one item: %s", body)
+	}
+
+	item := doc.Channel.Items[0]
+	if item.Title != "Fish & <chips>" || item.Creator != "jane" || !strings.HasPrefix(item.GUID, "https://news.example/web/posts/") {
+		t.Fatalf("unexpected item %+v", item)
+	}
+	if item.PubDate != "Fri, 01 Mar 2024 09:30:00 +0000" {
+		t.Fatalf("expected pubDate from created_at, got %q", item.PubDate)
+	}
+	if !strings.Contains(item.Description, "<strong>and</strong>") || strings.Contains(item.Description, "<script") {
+		t.Fatalf("expected sanitized HTML content, got %q", item.Description)
+	}
+	if strings.Contains(string(body), "<chips>") {
+		t.Fatalf("expected the title to be escaped: %s", body)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := testFeed(t).Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			Title     string `xml:"title"`
+			Published string `xml:"published"`
+			Updated   string `xml:"updated"`
+			Author    string `xml:"author>name"`
+			Content   struct {
+				Type  string `xml:"type,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("expected well formed Atom: %v\n%s", err, body)
+	}
+	if doc.ID != "https://news.example/feed.atom" || doc.Updated != "2024-03-01T11:30:00Z" || len(doc.Entries) != 1 {
+		t.Fatalf("unexpected feed: %s", body)
+	}
+
+	entry := doc.Entries[0]
+	if entry.Published != "2024-03-01T09:30:00Z" || entry.Updated != "2024-03-01T11:30:00Z" {
+		t.Fatalf("expected published and updated from created_at and updated_at, got %q and %q", entry.Published, entry.Updated)
+	}
+	if entry.Title != "Fish & <chips>" || entry.Author != "jane" || entry.Content.Type != "html" || !strings.Contains(entry.Content.Value, "<strong>and</strong>") {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+}
+
+// jsonFeedKeys are the members JSON Feed 1.1 defines for the top-level
+// object and for items. Anything else would have to start with an
+// underscore to be a valid extension.
+var jsonFeedKeys = map[string]bool{
+	"version": true, "title": true, "home_page_url": true, "feed_url": true, "description": true,
+	"user_comment": true, "next_url": true, "icon": true, "favicon": true, "authors": true,
+	"language": true, "expired": true, "hubs": true, "items": true,
+}
+
+var jsonItemKeys = map[string]bool{
+	"id": true, "url": true, "external_url": true, "title": true, "content_html": true, "content_text": true,
+	"summary": true, "image": true, "banner_image": true, "date_published": true, "date_modified": true,
+	"authors": true, "tags": true, "language": true, "attachments": true,
+}
+
+// checkJSONFeed checks body against the rules of JSON Feed 1.1 that apply
+// to the members the feed uses.
+func checkJSONFeed(t *testing.T, body []byte) map[string]any {
+	t.Helper()
+
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("expected a JSON object: %v", err)
+	}
+	for key := range doc {
+		if !jsonFeedKeys[key] {
+			t.Fatalf("unknown top-level member %q", key)
+		}
+	}
+	if doc["version"] != "https://jsonfeed.org/version/1.1" {
+		t.Fatalf("expected version 1.1, got %v", doc["version"])
+	}
+	if title, ok := doc["title"].(string); !ok || title == "" {
+		t.Fatalf("expected a title, got %v", doc["title"])
+	}
+	for _, key := range []string{"home_page_url", "feed_url"} {
+		if u, ok := doc[key].(string); !ok || !strings.HasPrefix(u, "https://") {
+			t.Fatalf("expected %s to be an absolute URL, got %v", key, doc[key])
+		}
+	}
+	if authors, ok := doc["authors"]; ok {
+		checkJSONAuthors(t, authors)
+	}
+
+	items, ok := doc["items"].([]any)
+	if !ok {
+		t.Fatalf("expected an items array, got %v", doc["items"])
+	}
+	for _, raw := range items {
+		item, ok := raw.(map[string]any)
+		if !ok {
+			t.Fatalf("expected items to be objects, got %v", raw)
+		}
+		for key := range item {
+			if !jsonItemKeys[key] {
+				t.Fatalf("unknown item member %q", key)
+			}
+		}
+		if id, ok := item["id"].(string); !ok || id == "" {
+			t.Fatalf("expected a string id, got %v", item["id"])
+		}
+		_, hasHTML := item["content_html"].(string)
+		_, hasText := item["content_text"].(string)
+		if !hasHTML && !hasText {
+			t.Fatal("expected content_html or content_text")
+		}
+		for _, key := range []string{"date_published", "date_modified"} {
+			if value, ok := item[key]; ok {
+				if _, err := time.Parse(time.RFC3339, value.(string)); err != nil {
+					t.Fatalf("expected %s in RFC 3339 format, got %v", key, value)
+				}
+			}
+		}
+		if authors, ok := item["authors"]; ok {
+			checkJSONAuthors(t, authors)
+		}
+	}
+	return doc
+}
+
+func checkJSONAuthors(t *testing.T, raw any) {
+	t.Helper()
+	authors, ok := raw.([]any)
+	if !ok || len(authors) == 0 {
+		t.Fatalf("expected authors to be a non-empty array, got %v", raw)
+	}
+	for _, a := range authors {
+		author, ok := a.(map[string]any)
+		if !ok {
+			t.Fatalf("expected an author object, got %v", a)
+		}
+		// An author must have at least one of name, url or avatar.
+		if _, ok := author["name"].(string); !ok {
+			t.Fatalf("expected an author name, got %v", author)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	f := testFeed(t)
+	body, err := f.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := checkJSONFeed(t, body)
+	if _, ok := doc["authors"]; ok {
+		t.Fatal("expected a feed of every author to have no authors of its own")
+	}
+
+	item := doc["items"].([]any)[0].(map[string]any)
+	if item["title"] != "Fish & <chips>" || item["date_published"] != "2024-03-01T09:30:00Z" || item["date_modified"] != "2024-03-01T11:30:00Z" {
+		t.Fatalf("unexpected item %v", item)
+	}
+	if item["content_text"] != "Tasty and cheap alert(1)" || !strings.Contains(item["content_html"].(string), "<strong>and</strong>") {
+		t.Fatalf("unexpected content %q and %q", item["content_text"], item["content_html"])
+	}
+	if item["image"] != "https://news.example/media/"+strings.Repeat("a", 64)+".png/full" {
+		t.Fatalf("expected the hero image, got %v", item["image"])
+	}
+	if item["url"] != item["id"] || item["authors"].([]any)[0].(map[string]any)["name"] != "jane" {
+		t.Fatalf("unexpected item %v", item)
+	}
+
+	f.Author = "jane"
+	f.Items = nil
+	body, err = f.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = checkJSONFeed(t, body)
+	if len(doc["items"].([]any)) != 0 || doc["authors"] == nil {
+		t.Fatalf("expected an empty feed of jane: %s", body)
+	}
+}
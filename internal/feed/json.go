@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JSONContentType is the media type of JSON Feed documents.
+const JSONContentType = "application/feed+json; charset=utf-8"
+
+// jsonFeedVersion is the JSON Feed version the documents follow.
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url"`
+	FeedURL     string       `json:"feed_url"`
+	Description string       `json:"description,omitempty"`
+	Language    string       `json:"language"`
+	Authors     []jsonAuthor `json:"authors,omitempty"`
+	Items       []jsonItem   `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	ContentHTML   string       `json:"content_html"`
+	ContentText   string       `json:"content_text"`
+	Image         string       `json:"image,omitempty"`
+	DatePublished string       `json:"date_published"`
+	DateModified  string       `json:"date_modified"`
+	Authors       []jsonAuthor `json:"authors"`
+}
+
+// JSON encodes the feed as JSON Feed 1.1. Items always list their author,
+// since a feed of every author has none of its own.
+func (f *Feed) JSON() ([]byte, error) {
+	doc := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.FeedURL,
+		Description: f.Description,
+		Language:    "en",
+		Items:       make([]jsonItem, 0, len(f.Items)),
+	}
+	if f.Author != "" {
+		doc.Authors = []jsonAuthor{{Name: f.Author}}
+	}
+
+	for _, item := range f.Items {
+		doc.Items = append(doc.Items, jsonItem{
+			ID:            item.ID,
+			URL:           item.ID,
+			Title:         item.Title,
+			ContentHTML:   item.ContentHTML,
+			ContentText:   item.ContentText,
+			Image:         item.Image,
+			DatePublished: item.Published.Format(time.RFC3339),
+			DateModified:  item.Updated.Format(time.RFC3339),
+			Authors:       []jsonAuthor{{Name: item.Author}},
+		})
+	}
+
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
@@ -0,0 +1,89 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+)
+
+// RSSContentType is the media type of RSS 2.0 documents.
+const RSSContentType = "application/rss+xml; charset=utf-8"
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	Creator     string  `xml:"dc:creator"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS encodes the feed as RSS 2.0. RSS has no place for the time a post
+// changed, so items carry when they were published only.
+func (f *Feed) RSS() ([]byte, error) {
+	doc := rss{
+		Version: "2.0",
+		AtomNS:  atomNamespace,
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.HomeURL,
+			Description: f.Description,
+			Language:    "en",
+			Self:        atomLink{Href: f.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !f.Updated.IsZero() {
+		doc.Channel.LastBuildDate = f.Updated.Format(time.RFC1123Z)
+	}
+
+	for _, item := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.ID,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.ID},
+			Creator:     item.Author,
+			PubDate:     item.Published.Format(time.RFC1123Z),
+			Description: item.ContentHTML,
+		})
+	}
+
+	return encodeXML(doc)
+}
+
+// encodeXML encodes doc as an indented XML document. encoding/xml escapes
+// every value, so titles and HTML content need no care of their own.
+func encodeXML(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
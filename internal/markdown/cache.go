@@ -0,0 +1,77 @@
+package markdown
+
+import (
+	"container/list"
+	"sync"
+	"test-news/internal/database/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cacheKey names one version of a post. Every change to a post bumps its
+// version, so a cached rendering never goes stale.
+type cacheKey struct {
+	id      primitive.ObjectID
+	version int64
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	html string
+}
+
+// Cache keeps the rendered content of the most recently shown post versions.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[cacheKey]*list.Element
+}
+
+// NewCache returns a cache holding up to size renderings.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// Render returns the sanitized HTML of the content of post, rendering it
+// only when this version of the post isn't cached yet.
+func (c *Cache) Render(post *models.Post) (string, error) {
+	key := cacheKey{id: post.ID, version: post.Version}
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*cacheEntry).html, nil
+	}
+	c.mu.Unlock()
+
+	// Rendering happens outside the lock, at worst twice for one version.
+	html, err := Render(post.Content)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&cacheEntry{key: key, html: html})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return html, nil
+}
+
+// Len returns the number of cached renderings.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,76 @@
+// Package markdown renders the Markdown content of posts to HTML that is
+// safe to put on a page.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// converter turns GitHub flavoured Markdown into HTML. Raw HTML in the
+// source is dropped, and single line breaks are kept, so that posts written
+// as plain text before Markdown read as they did.
+var converter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(goldmarkhtml.WithHardWraps()),
+)
+
+// policy is the allow-list of the sanitizer. Anything not listed here is
+// removed from the rendered HTML, whatever the converter produced.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "blockquote", "pre",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"ul", "ol", "li",
+		"em", "strong", "del", "code",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	// Fenced code blocks name their language in a class.
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// Render converts Markdown source to sanitized HTML.
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := converter.Convert([]byte(source), &buf); err != nil {
+		return "", fmt.Errorf("error rendering markdown: %w", err)
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// textPolicy removes every tag, leaving the text.
+var textPolicy = bluemonday.StrictPolicy()
+
+// PlainText renders Markdown source to text without any markup, for
+// excerpts. The text is not escaped.
+func PlainText(source string) (string, error) {
+	rendered, err := Render(source)
+	if err != nil {
+		return "", err
+	}
+	// Blocks end in newlines, which become spaces between their text.
+	text := html.UnescapeString(textPolicy.Sanitize(rendered))
+	return strings.Join(strings.Fields(text), " "), nil
+}
@@ -0,0 +1,92 @@
+package markdown
+
+import (
+	"strings"
+	"test-news/internal/database/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"heading", "# Breaking", "<h1>Breaking</h1>"},
+		{"emphasis", "*new* and **bold**", "<em>new</em> and <strong>bold</strong>"},
+		{"list", "- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>"},
+		{"link", "[docs](https://example.com)", `<a href="https://example.com" rel="nofollow noopener" target="_blank">docs</a>`},
+		{"line breaks", "first\nsecond", "first<br>\nsecond"},
+		{"code", "```go\nx := 1\n```", `<pre><code class="language-go">x := 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("expected %q in %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderSanitizes(t *testing.T) {
+	for _, source := range []string{
+		"<script>alert(1)</script>",
+		`<img src=x onerror="alert(1)">`,
+		"[click](javascript:alert(1))",
+		`<a href="https://example.com" onclick="alert(1)">x</a>`,
+		"<iframe src=\"https://example.com\"></iframe>",
+	} {
+		got, err := Render(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, bad := range []string{"<script", "onerror", "javascript:", "onclick", "<iframe", "<img"} {
+			if strings.Contains(got, bad) {
+				t.Fatalf("expected %q to be removed from %q, got %q", bad, source, got)
+			}
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	got, err := PlainText("# Title\n\nSome *text* & [a link](https://example.com).")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Title Some text & a link." {
+		t.Fatalf("unexpected text %q", got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(2)
+	post := &models.Post{ID: primitive.NewObjectID(), Version: 1, Content: "*one*"}
+
+	first, err := cache.Render(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cache is keyed on the version, so an unchanged version serves the
+	// rendering it cached.
+	post.Content = "*changed without a new version*"
+	if again, _ := cache.Render(post); again != first {
+		t.Fatalf("expected the cached rendering, got %q", again)
+	}
+
+	post.Version = 2
+	if updated, _ := cache.Render(post); !strings.Contains(updated, "changed without a new version") {
+		t.Fatalf("expected a new version to be rendered, got %q", updated)
+	}
+
+	other := &models.Post{ID: primitive.NewObjectID(), Version: 1, Content: "other"}
+	cache.Render(other)
+	if cache.Len() != 2 {
+		t.Fatalf("expected the cache to hold 2 renderings, got %d", cache.Len())
+	}
+}
@@ -0,0 +1,77 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DiskStore keeps files in a directory of the local disk, spread over
+// subdirectories named after the first two characters of their keys.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore returns a store keeping files under dir, which is created
+// when missing.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating media directory: %w", err)
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+func (s *DiskStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+// Put writes r to a temporary file first and renames it into place, so a
+// file is never seen half written.
+func (s *DiskStore) Put(ctx context.Context, key string, r io.Reader) error {
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DiskStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *DiskStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,188 @@
+// Package media keeps the files uploaded for posts, such as hero images.
+// Files are stored under a key derived from their bytes, so a file is
+// stored once however often it is uploaded and never changes once stored.
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"test-news/internal/database/models"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrNotFound is returned for a key no file is stored under.
+	ErrNotFound = errors.New("media not found")
+	// ErrTooLarge is returned for an upload over the size limit.
+	ErrTooLarge = errors.New("media too large")
+	// ErrUnsupportedType is returned for an upload that is not one of the
+	// accepted image or video formats.
+	ErrUnsupportedType = errors.New("unsupported media type")
+	// ErrInvalidKey is returned for a key that can't name a stored file.
+	ErrInvalidKey = errors.New("invalid media key")
+)
+
+// Store keeps the bytes of uploaded files. Implementations only ever see
+// keys that passed ValidKey, so a key is safe to use as a file name.
+type Store interface {
+	// Put stores the bytes of r under key. Keys name their content, so
+	// putting a key that is stored already changes nothing.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns the file stored under key, or ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Exists reports whether a file is stored under key.
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// extensions are the accepted media types, as sniffed from the first bytes
+// of a file, with the extension their keys end in.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+var keyPattern = regexp.MustCompile(`^[0-9a-f]{64}(-(thumb|card|full))?\.(jpg|png|gif|webp|mp4|webm)$`)
+
+// ValidKey reports whether key has the shape of the keys Library hands out,
+// for uploads and their variants.
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// ContentType returns the media type of the file stored under key.
+func ContentType(key string) string {
+	for contentType, ext := range extensions {
+		if strings.HasSuffix(key, ext) {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// Library checks uploaded files and keeps them in a Store.
+type Library struct {
+	store    Store
+	maxBytes int64
+	// resizing dedupes the variants being made of an image, and resizes
+	// holds a slot for each image being resized.
+	resizing singleflight.Group
+	resizes  chan struct{}
+}
+
+// NewLibrary returns a library on top of store accepting files of up to
+// maxBytes.
+func NewLibrary(store Store, maxBytes int64) *Library {
+	return &Library{store: store, maxBytes: maxBytes, resizes: make(chan struct{}, maxResizes)}
+}
+
+// MaxBytes is the size limit of an upload.
+func (l *Library) MaxBytes() int64 {
+	return l.maxBytes
+}
+
+// Upload reads a file from r, checks its size and type, and stores it along
+// with its variants if it is an image. The type is sniffed from the bytes,
+// whatever the client claimed it to be.
+func (l *Library) Upload(ctx context.Context, r io.Reader) (models.Media, error) {
+	data, err := io.ReadAll(io.LimitReader(r, l.maxBytes+1))
+	if err != nil {
+		return models.Media{}, fmt.Errorf("error reading upload: %w", err)
+	}
+	if int64(len(data)) > l.maxBytes {
+		return models.Media{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return models.Media{}, ErrUnsupportedType
+	}
+
+	m := models.Media{ContentType: contentType}
+	if strings.HasPrefix(contentType, "image/") {
+		if m.Width, m.Height, err = imageSize(data); err != nil {
+			return models.Media{}, err
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	m.Key = hex.EncodeToString(sum[:]) + ext
+
+	// Variants are made before anything is stored, so an image that can't
+	// be resized is refused rather than kept.
+	var variants map[string][]byte
+	if m.Width > 0 {
+		if variants, err = l.makeVariants(ctx, m.Key, data); err != nil {
+			return models.Media{}, err
+		}
+	}
+	if err := l.store.Put(ctx, m.Key, bytes.NewReader(data)); err != nil {
+		return models.Media{}, fmt.Errorf("error storing upload: %w", err)
+	}
+	if err := l.putVariants(ctx, variants); err != nil {
+		return models.Media{}, err
+	}
+
+	return m, nil
+}
+
+// Resolve checks that m names a stored file and fills in its content type
+// and dimensions, for media a client refers to by key.
+func (l *Library) Resolve(ctx context.Context, m *models.Media) error {
+	if !ValidKey(m.Key) || strings.Contains(m.Key, "-") {
+		return ErrInvalidKey
+	}
+
+	ok, err := l.store.Exists(ctx, m.Key)
+	if err != nil {
+		return fmt.Errorf("error looking up media: %w", err)
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	m.ContentType = ContentType(m.Key)
+	m.Width, m.Height = 0, 0
+	if strings.HasPrefix(m.ContentType, "image/") {
+		return l.readSize(ctx, m)
+	}
+	return nil
+}
+
+// readSize fills in the dimensions of the image m names.
+func (l *Library) readSize(ctx context.Context, m *models.Media) error {
+	f, err := l.store.Open(ctx, m.Key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return fmt.Errorf("error reading media: %w", err)
+	}
+	m.Width, m.Height = config.Width, config.Height
+	return nil
+}
+
+// Open returns the file stored under key.
+func (l *Library) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotFound
+	}
+	return l.store.Open(ctx, key)
+}
@@ -0,0 +1,308 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+func pngBytes(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	lib := NewLibrary(NewMemoryStore(), 1024)
+	data := pngBytes(t)
+
+	m, err := lib.Upload(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ContentType != "image/png" || !strings.HasSuffix(m.Key, ".png") || !ValidKey(m.Key) {
+		t.Fatalf("unexpected media %+v", m)
+	}
+
+	again, err := lib.Upload(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Key != m.Key {
+		t.Fatalf("expected the same file to get the same key, got %s and %s", m.Key, again.Key)
+	}
+
+	f, err := lib.Open(ctx, m.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stored, _ := io.ReadAll(f)
+	if !bytes.Equal(stored, data) {
+		t.Fatal("expected the stored bytes to be the uploaded ones")
+	}
+
+	if _, err := lib.Upload(ctx, strings.NewReader("<html><script>alert(1)</script>")); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected ErrUnsupportedType, got %v", err)
+	}
+	if _, err := lib.Upload(ctx, bytes.NewReader(append(data, make([]byte, 1024)...))); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	lib := NewLibrary(NewMemoryStore(), 1024)
+	m, err := lib.Upload(ctx, bytes.NewReader(pngBytes(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := models.Media{Key: m.Key, Alt: "A square", ContentType: "text/html"}
+	if err := lib.Resolve(ctx, &ref); err != nil {
+		t.Fatal(err)
+	}
+	if ref.ContentType != "image/png" || ref.Alt != "A square" {
+		t.Fatalf("expected the content type to come from the key, got %+v", ref)
+	}
+
+	for key, want := range map[string]error{
+		"../../etc/passwd":               ErrInvalidKey,
+		strings.Repeat("a", 64) + ".png": ErrNotFound,
+	} {
+		if err := lib.Resolve(ctx, &models.Media{Key: key}); !errors.Is(err, want) {
+			t.Fatalf("expected %v for %q, got %v", want, key, err)
+		}
+	}
+}
+
+func TestDiskStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := strings.Repeat("ab", 32) + ".png"
+
+	if ok, err := store.Exists(ctx, key); err != nil || ok {
+		t.Fatalf("expected no file yet, got %v, %v", ok, err)
+	}
+	if _, err := store.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.Put(ctx, key, strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	// A key names its content, so storing it again keeps the file.
+	if err := store.Put(ctx, key, strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	if string(data) != "first" {
+		t.Fatalf("expected the first write to stay, got %q", data)
+	}
+	if ok, err := store.Exists(ctx, key); err != nil || !ok {
+		t.Fatalf("expected the file to exist, got %v, %v", ok, err)
+	}
+}
+
+func TestOpenVariant(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	lib := NewLibrary(store, 1<<20)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1000, 500))); err != nil {
+		t.Fatal(err)
+	}
+	m, err := lib.Upload(ctx, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Width != 1000 || m.Height != 500 {
+		t.Fatalf("expected the size of the image, got %dx%d", m.Width, m.Height)
+	}
+	// The variants are made with the upload.
+	for _, v := range Variants {
+		if ok, _ := store.Exists(ctx, variantKey(m.Key, v)); !ok {
+			t.Fatalf("%s: expected the variant to be stored on upload", v.Name)
+		}
+	}
+
+	for name, want := range map[string]image.Point{"thumb": {160, 80}, "card": {480, 240}, "full": {1000, 500}} {
+		f, key, err := lib.OpenVariant(ctx, m.Key, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		config, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Width != want.X || config.Height != want.Y {
+			t.Fatalf("%s: expected %v, got %dx%d", name, want, config.Width, config.Height)
+		}
+		if ok, _ := store.Exists(ctx, key); !ok || !ValidKey(key) {
+			t.Fatalf("%s: expected the variant to be stored under %q", name, key)
+		}
+	}
+
+	if _, _, err := lib.OpenVariant(ctx, m.Key, "huge"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an unknown variant, got %v", err)
+	}
+	thumbKey := variantKey(m.Key, Variants[0])
+	if _, _, err := lib.OpenVariant(ctx, thumbKey, "card"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected no variants of variants, got %v", err)
+	}
+	if err := lib.Resolve(ctx, &models.Media{Key: thumbKey}); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected posts not to refer to variants, got %v", err)
+	}
+
+	video := strings.Repeat("0", 64) + ".mp4"
+	if _, _, err := lib.OpenVariant(ctx, video, "thumb"); !errors.Is(err, ErrNoVariants) {
+		t.Fatalf("expected ErrNoVariants for a video, got %v", err)
+	}
+}
+
+func TestOpenVariantOfJPEG(t *testing.T) {
+	ctx := context.Background()
+	lib := NewLibrary(NewMemoryStore(), 1<<20)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 300)), nil); err != nil {
+		t.Fatal(err)
+	}
+	m, err := lib.Upload(ctx, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, key, err := lib.OpenVariant(ctx, m.Key, "thumb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if ContentType(key) != "image/jpeg" {
+		t.Fatalf("expected a JPEG variant, got %s", key)
+	}
+	if _, err := jpeg.Decode(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingStore counts the files written to a MemoryStore and the lookups
+// that missed.
+type countingStore struct {
+	*MemoryStore
+	mu     sync.Mutex
+	puts   map[string]int
+	misses int
+}
+
+func (s *countingStore) Put(ctx context.Context, key string, r io.Reader) error {
+	s.mu.Lock()
+	s.puts[key]++
+	s.mu.Unlock()
+	return s.MemoryStore.Put(ctx, key, r)
+}
+
+func (s *countingStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	f, err := s.MemoryStore.Open(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		s.mu.Lock()
+		s.misses++
+		s.mu.Unlock()
+	}
+	return f, err
+}
+
+func TestOpenVariantOfOlderUpload(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryStore: NewMemoryStore(), puts: make(map[string]int)}
+	lib := NewLibrary(store, 1<<20)
+
+	// An image stored before variants were made on upload.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1000, 500))); err != nil {
+		t.Fatal(err)
+	}
+	key := strings.Repeat("a", 64) + ".png"
+	if err := store.MemoryStore.Put(ctx, key, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// With every resize slot taken, a request waits only as long as its
+	// context allows.
+	for range maxResizes {
+		lib.resizes <- struct{}{}
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := lib.OpenVariant(cancelled, key, "thumb"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to give up, got %v", err)
+	}
+
+	// Requests arriving together share one resize, started once a slot is
+	// free.
+	const requests = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := range requests {
+		name := Variants[i%len(Variants)].Name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, _, err := lib.OpenVariant(ctx, key, name)
+			if err == nil {
+				_, err = png.DecodeConfig(f)
+				f.Close()
+			}
+			errs <- err
+		}()
+	}
+	for {
+		store.mu.Lock()
+		misses := store.misses
+		store.mu.Unlock()
+		if misses >= requests+1 {
+			break
+		}
+		runtime.Gosched()
+	}
+	for range maxResizes {
+		<-lib.resizes
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, v := range Variants {
+		if n := store.puts[variantKey(key, v)]; n != 1 {
+			t.Fatalf("%s: expected the variant to be made once, got %d", v.Name, n)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// MemoryStore keeps files in process memory, for tests and for running
+// without a disk to write to.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{files: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[key] = data
+	return nil
+}
+
+// nopCloser lets a bytes.Reader stand in for a file.
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+func (s *MemoryStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.files[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+func (s *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.files[key]
+	return ok, nil
+}
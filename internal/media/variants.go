@@ -0,0 +1,212 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	// Register the decoders of the accepted image formats.
+	_ "image/gif"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Variant is a resized copy of an uploaded image, made to fit a width.
+type Variant struct {
+	Name  string
+	Width int
+}
+
+// Variants are the sizes images are served in, smallest first.
+var Variants = []Variant{
+	{Name: "thumb", Width: 160},
+	{Name: "card", Width: 480},
+	{Name: "full", Width: 1200},
+}
+
+// maxPixels bounds the size of the images accepted, since resizing decodes
+// the whole image into memory.
+const maxPixels = 50_000_000
+
+// jpegQuality is the quality variants are encoded with.
+const jpegQuality = 85
+
+// maxResizes bounds how many images are resized at once, each of them held
+// decoded in memory while its variants are made.
+const maxResizes = 2
+
+// ErrNoVariants is returned for variants of a file that isn't an image.
+var ErrNoVariants = errors.New("media has no variants")
+
+func lookupVariant(name string) (Variant, bool) {
+	for _, v := range Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// variantKey names the variant of the image stored under key. Variants of
+// JPEG and WebP images are JPEG, the others PNG to keep transparency. Go
+// can decode WebP but not encode it, so no variant is WebP.
+func variantKey(key string, v Variant) string {
+	hash, ext, _ := strings.Cut(key, ".")
+	switch ext {
+	case "jpg", "webp":
+		ext = "jpg"
+	default:
+		ext = "png"
+	}
+	return hash + "-" + v.Name + "." + ext
+}
+
+// imageSize reads the dimensions of an image from its header, refusing
+// images too large to resize.
+func imageSize(data []byte) (int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, ErrUnsupportedType
+	}
+	if config.Width*config.Height > maxPixels {
+		return 0, 0, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, config.Width, config.Height)
+	}
+	return config.Width, config.Height, nil
+}
+
+// OpenVariant returns the named variant of the image stored under key, along
+// with the key it is stored under. Variants are made when an image is
+// uploaded; images stored before that are given theirs on first request,
+// once however many requests arrive together.
+func (l *Library) OpenVariant(ctx context.Context, key string, name string) (io.ReadSeekCloser, string, error) {
+	v, ok := lookupVariant(name)
+	// Variants are made of uploads, not of other variants.
+	if !ok || !ValidKey(key) || strings.Contains(key, "-") {
+		return nil, "", ErrNotFound
+	}
+	if !strings.HasPrefix(ContentType(key), "image/") {
+		return nil, "", ErrNoVariants
+	}
+
+	vkey := variantKey(key, v)
+	f, err := l.store.Open(ctx, vkey)
+	if !errors.Is(err, ErrNotFound) {
+		return f, vkey, err
+	}
+
+	// The variants are made for whoever asked first and shared with the
+	// others, so a request giving up doesn't fail the rest.
+	made := l.resizing.DoChan(key, func() (any, error) {
+		return l.fillVariants(context.WithoutCancel(ctx), key)
+	})
+	select {
+	case res := <-made:
+		if res.Err != nil {
+			return nil, "", res.Err
+		}
+		data := res.Val.(map[string][]byte)[vkey]
+		return nopCloser{bytes.NewReader(data)}, vkey, nil
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+// fillVariants makes and stores the variants of the image stored under key.
+func (l *Library) fillVariants(ctx context.Context, key string) (map[string][]byte, error) {
+	f, err := l.store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading media: %w", err)
+	}
+
+	variants, err := l.makeVariants(ctx, key, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.putVariants(ctx, variants); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// putVariants stores variants made by makeVariants.
+func (l *Library) putVariants(ctx context.Context, variants map[string][]byte) error {
+	for vkey, data := range variants {
+		if err := l.store.Put(ctx, vkey, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("error storing variant: %w", err)
+		}
+	}
+	return nil
+}
+
+// makeVariants makes every variant of the image data, to be stored under key,
+// decoding it once for all of them. It waits its turn, as only maxResizes
+// images are held decoded at a time. The variants are returned by key.
+func (l *Library) makeVariants(ctx context.Context, key string, data []byte) (map[string][]byte, error) {
+	select {
+	case l.resizes <- struct{}{}:
+		defer func() { <-l.resizes }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if _, _, err := imageSize(data); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding media: %w", err)
+	}
+
+	variants := make(map[string][]byte, len(Variants))
+	for _, v := range Variants {
+		vkey := variantKey(key, v)
+		if variants[vkey], err = resize(src, vkey, v); err != nil {
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+// resize makes the variant v of src, encoded as the extension of vkey says.
+// Images are never scaled up.
+func resize(src image.Image, vkey string, v Variant) ([]byte, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > v.Width {
+		height = max(1, height*v.Width/width)
+		width = v.Width
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if strings.HasSuffix(vkey, ".jpg") {
+		// JPEG has no transparency, so transparent parts turn white rather
+		// than black.
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding variant: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,156 @@
+// Package policy decides what the members of the newsroom and the API keys
+// may do, for the API and the web UI alike.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Principal is the signed-in member of the newsroom, or the API key, behind
+// a request.
+type Principal struct {
+	// ID is the ID of the user or of the API key.
+	ID   primitive.ObjectID
+	Name string
+	Role models.Role
+	// APIKey is set when the request was signed with an API key.
+	APIKey bool
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the caller of a request.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller carried by ctx, or nil when anonymous.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Action is something a signed-in caller may attempt. Reading needs no
+// action of its own, see Visible.
+type Action string
+
+const (
+	CreatePost Action = "create posts"
+	// EditPost covers updates and restoring revisions.
+	EditPost Action = "edit posts"
+	// ChangeStatus covers moving a post through the workflow, on top of
+	// which DecideTransition keeps some moves to reviewers.
+	ChangeStatus Action = "change the status of posts"
+	// DeletePost covers moving a post to the trash and back.
+	DeletePost Action = "delete posts"
+	// ReadHistory covers the revisions and status changes of a post, which
+	// hold its unpublished states.
+	ReadHistory Action = "read the history of posts"
+	ManageUsers Action = "manage users"
+	ManageKeys  Action = "manage API keys"
+)
+
+// Refusal is the policy saying no, with a reason meant for the caller.
+type Refusal struct {
+	Reason string
+}
+
+func (r *Refusal) Error() string {
+	return r.Reason
+}
+
+// Decide is the access policy. It returns nil when p may perform act on post,
+// which is nil for actions that don't concern a single post, and a *Refusal
+// otherwise:
+//
+//   - readers may not change anything or read the history of posts
+//   - writers may create posts, and change their own and read their history,
+//     but only edit them while they are drafts, so that nothing reaches the
+//     public without a review
+//   - editors may change any post
+//   - admins may also manage users and API keys
+func Decide(p *Principal, act Action, post *models.Post) error {
+	if p == nil {
+		return &Refusal{fmt.Sprintf("Sign in to %s", act)}
+	}
+
+	switch act {
+	case ManageUsers, ManageKeys:
+		if p.Role != models.RoleAdmin {
+			return &Refusal{fmt.Sprintf("Only admins may %s", act)}
+		}
+	case CreatePost, EditPost, ChangeStatus, DeletePost, ReadHistory:
+		switch p.Role {
+		case models.RoleReader:
+			return &Refusal{fmt.Sprintf("Readers may not %s", act)}
+		case models.RoleWriter:
+			if post != nil && post.AuthorID != p.ID {
+				return &Refusal{fmt.Sprintf("Writers may only %s they wrote themselves", act)}
+			}
+			if act == EditPost && post != nil && post.Status != models.StatusDraft {
+				return &Refusal{fmt.Sprintf("Writers may only edit drafts, and this post is %s", post.Status)}
+			}
+		}
+	}
+	return nil
+}
+
+// DecideTransition applies the policy to moving post along t: the caller must
+// be allowed to change the status of the post, and to review it when t is
+// ReviewerOnly.
+func DecideTransition(p *Principal, post *models.Post, t *database.Transition) error {
+	if err := Decide(p, ChangeStatus, post); err != nil {
+		return err
+	}
+	if t.ReviewerOnly && !p.Role.Reviewer() {
+		return &Refusal{fmt.Sprintf("Only editors may move a post from %s to %s", t.From, t.To)}
+	}
+	return nil
+}
+
+// Visible reports whether p may see post. Everyone sees published posts.
+// Unpublished ones, such as drafts and embargoed posts, are only seen by the
+// editors and admins who review them and by their own author, so readers and
+// read-only API keys get the public view.
+func Visible(p *Principal, post *models.Post) bool {
+	switch {
+	case post.Status == models.StatusPublished:
+		return true
+	case p == nil:
+		return false
+	default:
+		return p.Role.Reviewer() || !post.AuthorID.IsZero() && post.AuthorID == p.ID
+	}
+}
+
+// RestrictToVisible narrows filter to the posts p may see, applying Visible
+// to listings and searches.
+func RestrictToVisible(p *Principal, filter *database.PostFilter) {
+	switch {
+	case p != nil && p.Role.Reviewer():
+	case p != nil && !p.ID.IsZero():
+		filter.UnpublishedBy = p.ID
+	default:
+		filter.Status = []models.PostStatus{models.StatusPublished}
+	}
+}
+
+// Byline returns the name the posts of p are credited to, derived from the
+// account p.ID: the current name of the user, or the name of the API key.
+func Byline(ctx context.Context, db database.Service, p *Principal) (string, error) {
+	if p.APIKey {
+		// The key was just read to authenticate the request.
+		return p.Name, nil
+	}
+
+	user, err := db.GetUser(ctx, p.ID.Hex())
+	if err != nil {
+		return "", err
+	}
+	return user.Name, nil
+}
@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"test-news/internal/database"
+	"test-news/internal/database/memory"
+	"test-news/internal/database/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecide(t *testing.T) {
+	will := &Principal{ID: primitive.NewObjectID(), Name: "will", Role: models.RoleWriter}
+	own := &models.Post{AuthorID: will.ID, Status: models.StatusDraft}
+	other := &models.Post{AuthorID: primitive.NewObjectID(), Status: models.StatusDraft}
+	ownPublished := &models.Post{AuthorID: will.ID, Status: models.StatusPublished}
+
+	tests := []struct {
+		name    string
+		p       *Principal
+		act     Action
+		post    *models.Post
+		allowed bool
+	}{
+		{"anonymous", nil, CreatePost, nil, false},
+		{"reader creates", &Principal{Role: models.RoleReader}, CreatePost, nil, false},
+		{"reader edits", &Principal{Role: models.RoleReader}, EditPost, other, false},
+		{"writer creates", will, CreatePost, nil, true},
+		{"writer edits own", will, EditPost, own, true},
+		{"writer edits other", will, EditPost, other, false},
+		{"writer edits own published", will, EditPost, ownPublished, false},
+		{"writer edits own in review", will, EditPost, &models.Post{AuthorID: will.ID, Status: models.StatusInReview}, false},
+		{"writer edits own scheduled", will, EditPost, &models.Post{AuthorID: will.ID, Status: models.StatusScheduled}, false},
+		{"writer changes status of own published", will, ChangeStatus, ownPublished, true},
+		{"writer deletes own published", will, DeletePost, ownPublished, true},
+		{"writer deletes other", will, DeletePost, other, false},
+		{"writer edits unattributed", will, EditPost, &models.Post{}, false},
+		{"editor edits other", &Principal{Role: models.RoleEditor}, EditPost, other, true},
+		{"editor edits published", &Principal{Role: models.RoleEditor}, EditPost, ownPublished, true},
+		{"editor deletes other", &Principal{Role: models.RoleEditor}, DeletePost, other, true},
+		{"editor manages users", &Principal{Role: models.RoleEditor}, ManageUsers, nil, false},
+		{"admin manages users", &Principal{Role: models.RoleAdmin}, ManageUsers, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Decide(tt.p, tt.act, tt.post)
+			if allowed := err == nil; allowed != tt.allowed {
+				t.Fatalf("expected allowed=%v, got %v", tt.allowed, err)
+			}
+		})
+	}
+}
+
+func TestDecideTransition(t *testing.T) {
+	will := &Principal{ID: primitive.NewObjectID(), Name: "will", Role: models.RoleWriter}
+	own := &models.Post{AuthorID: will.ID}
+	submit := &database.Transition{From: models.StatusDraft, To: models.StatusInReview}
+	publish := &database.Transition{From: models.StatusInReview, To: models.StatusPublished, ReviewerOnly: true}
+
+	if err := DecideTransition(will, own, submit); err != nil {
+		t.Fatalf("expected a writer to submit their own post, got %v", err)
+	}
+	if err := DecideTransition(will, own, publish); err == nil {
+		t.Fatal("expected a writer not to publish")
+	}
+	if err := DecideTransition(&Principal{Role: models.RoleEditor}, own, publish); err != nil {
+		t.Fatalf("expected an editor to publish, got %v", err)
+	}
+}
+
+func TestVisible(t *testing.T) {
+	will := &Principal{ID: primitive.NewObjectID(), Name: "will", Role: models.RoleWriter}
+	draft := &models.Post{Status: models.StatusDraft, AuthorID: primitive.NewObjectID()}
+	own := &models.Post{Status: models.StatusScheduled, AuthorID: will.ID}
+	published := &models.Post{Status: models.StatusPublished}
+
+	tests := []struct {
+		name    string
+		p       *Principal
+		post    *models.Post
+		visible bool
+	}{
+		{"anonymous reads published", nil, published, true},
+		{"anonymous reads draft", nil, draft, false},
+		{"reader reads draft", &Principal{ID: primitive.NewObjectID(), Role: models.RoleReader}, draft, false},
+		{"read key reads draft", &Principal{ID: primitive.NewObjectID(), Role: models.RoleReader, APIKey: true}, draft, false},
+		{"writer reads another's draft", will, draft, false},
+		{"writer reads own scheduled", will, own, true},
+		{"unattributed writer", &Principal{Role: models.RoleWriter}, &models.Post{Status: models.StatusDraft}, false},
+		{"editor reads draft", &Principal{Role: models.RoleEditor}, draft, true},
+		{"admin reads draft", &Principal{Role: models.RoleAdmin}, draft, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Visible(tt.p, tt.post); got != tt.visible {
+				t.Fatalf("expected visible=%v, got %v", tt.visible, got)
+			}
+
+			// Listings agree with Visible.
+			var filter database.PostFilter
+			RestrictToVisible(tt.p, &filter)
+			if got := filter.Match(tt.post); got != tt.visible {
+				t.Fatalf("expected the filter to match=%v, got %v", tt.visible, got)
+			}
+		})
+	}
+}
+
+func TestByline(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	user := &models.User{Username: "will", Name: "Will Writer", Role: models.RoleWriter, PasswordHash: "hash"}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// The name comes from the account, whatever the principal carries.
+	name, err := Byline(ctx, db, &Principal{ID: user.ID, Name: "someone else", Role: models.RoleWriter})
+	if err != nil || name != "Will Writer" {
+		t.Fatalf("expected the name of the user, got %q, %v", name, err)
+	}
+	if name, _ := Byline(ctx, db, &Principal{ID: primitive.NewObjectID(), Name: "wire", APIKey: true}); name != "wire" {
+		t.Fatalf("expected the name of the API key, got %q", name)
+	}
+	if _, err := Byline(ctx, db, &Principal{ID: primitive.NewObjectID(), Name: "ghost"}); !errors.Is(err, database.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound for a deleted user, got %v", err)
+	}
+}
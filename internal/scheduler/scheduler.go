@@ -0,0 +1,219 @@
+// Package scheduler runs the background jobs of the news server: applying
+// post schedules and purging the trash. When several replicas share a
+// database, a lease makes sure only one of them runs the jobs at a time.
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"test-news/internal/database"
+	"test-news/internal/env"
+)
+
+const (
+	// leaseName is the lease the replicas compete for.
+	leaseName = "scheduler"
+	// Actor is credited with the status changes the scheduler makes.
+	Actor = "scheduler"
+	// batchSize bounds the posts moved on one tick, the rest wait for the
+	// next one.
+	batchSize = 100
+	// leaseTicks is how many ticks the lease lasts, and jobTicks how long a
+	// job may run, which is less so that it ends while the lease still holds.
+	leaseTicks = 3
+	jobTicks   = 2
+
+	defaultInterval       = 15 * time.Second
+	defaultPurgeInterval  = time.Hour
+	defaultTrashRetention = 30 * 24 * time.Hour
+)
+
+// Scheduler runs its jobs every interval while it holds the lease.
+type Scheduler struct {
+	db     database.Service
+	leaser database.Leaser
+	holder string
+
+	interval time.Duration
+	jobs     []*job
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type job struct {
+	name  string
+	every time.Duration
+	run   func(ctx context.Context, now time.Time) error
+	last  time.Time
+}
+
+// New creates a scheduler for db. BLUEPRINT_SCHEDULER_INTERVAL,
+// BLUEPRINT_TRASH_RETENTION and BLUEPRINT_TRASH_PURGE_INTERVAL override the
+// defaults with durations such as "30s" or "168h". Backends that aren't a
+// database.Leaser are taken to serve a single process, and the scheduler
+// always runs.
+func New(db database.Service) *Scheduler {
+	s := &Scheduler{
+		db:       db,
+		holder:   newHolder(),
+		interval: env.Duration("BLUEPRINT_SCHEDULER_INTERVAL", defaultInterval),
+	}
+	if leaser, ok := db.(database.Leaser); ok {
+		s.leaser = leaser
+	}
+
+	retention := env.Duration("BLUEPRINT_TRASH_RETENTION", defaultTrashRetention)
+	s.jobs = []*job{
+		{name: "post schedules", every: s.interval, run: s.applySchedules},
+		{name: "trash purge", every: env.Duration("BLUEPRINT_TRASH_PURGE_INTERVAL", defaultPurgeInterval), run: func(ctx context.Context, now time.Time) error {
+			return s.purgeTrash(ctx, now.Add(-retention))
+		}},
+	}
+
+	return s
+}
+
+// Start runs the scheduler in the background until Stop is called.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.tick(ctx, time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the running jobs to finish, or for ctx to be done, and
+// hands the lease over to the other replicas.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.cancel()
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if s.leaser != nil {
+		return s.leaser.ReleaseLease(ctx, leaseName, s.holder)
+	}
+	return nil
+}
+
+// tick runs the jobs that are due, provided this replica holds the lease.
+// The lease outlives a few ticks, so a replica that dies is replaced
+// shortly after. It is renewed after every job, and each job is cut off
+// before the lease could run out under it, so two replicas never run jobs
+// at the same time.
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	if !s.holdLease(ctx) {
+		return
+	}
+
+	for _, j := range s.jobs {
+		if !j.last.IsZero() && now.Sub(j.last) < j.every {
+			continue
+		}
+		j.last = now
+
+		jobCtx, cancel := context.WithTimeout(ctx, jobTicks*s.interval)
+		err := j.run(jobCtx, now)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Scheduler job %s failed: %v", j.name, err)
+		}
+
+		if !s.holdLease(ctx) {
+			return
+		}
+	}
+}
+
+// holdLease takes or renews the lease for leaseTicks ticks, reporting
+// whether this replica holds it.
+func (s *Scheduler) holdLease(ctx context.Context) bool {
+	if s.leaser == nil {
+		return true
+	}
+
+	ok, err := s.leaser.AcquireLease(ctx, leaseName, s.holder, leaseTicks*s.interval)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Scheduler failed to acquire its lease: %v", err)
+		}
+		return false
+	}
+	return ok
+}
+
+// applySchedules publishes the scheduled posts and archives the published
+// ones whose time has come.
+func (s *Scheduler) applySchedules(ctx context.Context, now time.Time) error {
+	ctx = database.WithEditor(ctx, Actor)
+
+	posts, err := s.db.DuePosts(ctx, now, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		to, due := database.Due(post, now)
+		if !due {
+			continue
+		}
+
+		_, err := s.db.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: post.Status, To: to, Comment: "as scheduled"})
+		// Someone else moved or deleted the post in the meantime.
+		if errors.Is(err, database.ErrStatusChanged) || errors.Is(err, database.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("post %s: %w", post.ID.Hex(), err)
+		}
+		log.Printf("Scheduler moved post %s to %s", post.ID.Hex(), to)
+	}
+
+	return nil
+}
+
+// purgeTrash removes the posts that have been in the trash since before.
+func (s *Scheduler) purgeTrash(ctx context.Context, before time.Time) error {
+	n, err := s.db.PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Purged %d posts from the trash", n)
+	}
+	return nil
+}
+
+// newHolder names this replica in the lease.
+func newHolder() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -0,0 +1,181 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"test-news/internal/database"
+	"test-news/internal/database/memory"
+	"test-news/internal/database/models"
+	"testing"
+	"time"
+)
+
+func schedule(t *testing.T, db database.Service, publishAt time.Time, unpublishAt time.Time) *models.Post {
+	t.Helper()
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Embargoed", Content: "body", Author: "jane"}
+	if err := db.CreatePost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	scheduled, err := db.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{
+		From:        models.StatusDraft,
+		To:          models.StatusScheduled,
+		PublishAt:   &publishAt,
+		UnpublishAt: &unpublishAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheduled
+}
+
+func status(t *testing.T, db database.Service, id string) models.PostStatus {
+	t.Helper()
+	post, err := db.GetPost(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post.Status
+}
+
+func TestApplySchedules(t *testing.T) {
+	db := memory.New()
+	s := New(db)
+	now := time.Now()
+
+	post := schedule(t, db, now.Add(time.Hour), now.Add(2*time.Hour))
+
+	s.tick(context.Background(), now)
+	if got := status(t, db, post.ID.Hex()); got != models.StatusScheduled {
+		t.Fatalf("expected the post to wait for its time, got %q", got)
+	}
+
+	s.tick(context.Background(), now.Add(time.Hour))
+	if got := status(t, db, post.ID.Hex()); got != models.StatusPublished {
+		t.Fatalf("expected the post to be published, got %q", got)
+	}
+
+	s.tick(context.Background(), now.Add(2*time.Hour))
+	if got := status(t, db, post.ID.Hex()); got != models.StatusArchived {
+		t.Fatalf("expected the post to be archived, got %q", got)
+	}
+
+	changes, err := db.ListStatusChanges(context.Background(), post.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 || changes[0].Actor != Actor || changes[1].Actor != Actor {
+		t.Fatalf("expected the scheduler to be credited, got %+v", changes)
+	}
+}
+
+func TestLease(t *testing.T) {
+	db := memory.New()
+	first, second := New(db), New(db)
+	now := time.Now()
+
+	// The first replica takes the lease on its first tick.
+	first.tick(context.Background(), now)
+
+	post := schedule(t, db, now.Add(-time.Minute), now.Add(time.Hour))
+	second.tick(context.Background(), now)
+	if got := status(t, db, post.ID.Hex()); got != models.StatusScheduled {
+		t.Fatalf("expected the second replica to wait for the lease, got %q", got)
+	}
+
+	if err := db.(database.Leaser).ReleaseLease(context.Background(), leaseName, first.holder); err != nil {
+		t.Fatal(err)
+	}
+	second.tick(context.Background(), now)
+	if got := status(t, db, post.ID.Hex()); got != models.StatusPublished {
+		t.Fatalf("expected the second replica to take over, got %q", got)
+	}
+}
+
+func TestLeaseBetweenJobs(t *testing.T) {
+	db := memory.New()
+	s := New(db)
+	leaser := db.(database.Leaser)
+
+	var ran []string
+	var deadline time.Time
+	s.jobs = []*job{
+		{name: "first", run: func(ctx context.Context, now time.Time) error {
+			ran = append(ran, "first")
+			deadline, _ = ctx.Deadline()
+			// Another replica takes over while the job runs, as if the
+			// lease had run out.
+			if err := leaser.ReleaseLease(ctx, leaseName, s.holder); err != nil {
+				return err
+			}
+			_, err := leaser.AcquireLease(ctx, leaseName, "other", time.Minute)
+			return err
+		}},
+		{name: "second", run: func(ctx context.Context, now time.Time) error {
+			ran = append(ran, "second")
+			return nil
+		}},
+	}
+
+	start := time.Now()
+	s.tick(context.Background(), start)
+	if len(ran) != 1 {
+		t.Fatalf("expected the jobs to stop once the lease was lost, ran %v", ran)
+	}
+	// Jobs end before the lease taken for them could run out.
+	if deadline.IsZero() || deadline.After(start.Add(leaseTicks*s.interval)) {
+		t.Fatalf("expected the job to be cut off within the lease, got deadline %v", deadline)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := memory.New()
+	s := New(db)
+	ctx := context.Background()
+
+	post := &models.Post{Title: "Old news", Content: "body", Author: "jane"}
+	if err := db.CreatePost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeletePost(ctx, post.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the retention period the post stays restorable.
+	s.tick(ctx, time.Now())
+	if page, _ := db.ListPosts(ctx, database.ListOptions{Trashed: true}); len(page.Posts) != 1 {
+		t.Fatalf("expected the post to stay in the trash, got %d posts", len(page.Posts))
+	}
+
+	s.tick(ctx, time.Now().Add(defaultTrashRetention+time.Hour))
+	if _, err := db.RestorePost(ctx, post.ID.Hex()); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected the post to be purged, got %v", err)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	db := memory.New()
+	s := New(db)
+
+	post := schedule(t, db, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+
+	s.Start()
+	deadline := time.Now().Add(time.Second)
+	for status(t, db, post.ID.Hex()) != models.StatusPublished {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the first tick to publish the post")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stopping hands the lease over straight away.
+	ok, err := db.(database.Leaser).AcquireLease(context.Background(), leaseName, "other", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected the lease to be free after Stop, got %v, %v", ok, err)
+	}
+}
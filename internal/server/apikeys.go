@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"test-news/internal/auth"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"test-news/internal/policy"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAPIKeyRequest is the body of POST /api/keys.
+type newAPIKeyRequest struct {
+	Name      string         `json:"name" binding:"required"`
+	Scopes    []models.Scope `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time     `json:"expires_at"`
+	RateLimit int            `json:"rate_limit"`
+}
+
+// apiKeyResponse carries a key together with its secret, which is only ever
+// shown right after creating or rotating the key.
+type apiKeyResponse struct {
+	Key    *models.APIKey `json:"key"`
+	Secret string         `json:"secret"`
+}
+
+// ListAPIKeysHandler returns every API key, newest first, without secrets.
+func (s *Server) ListAPIKeysHandler(c *gin.Context) {
+	if !authorize(c, "Failed to list API keys", policy.ManageKeys, nil) {
+		return
+	}
+
+	keys, err := s.db.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		abortWithError(c, "Failed to list API keys", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys, "count": len(keys)})
+}
+
+// CreateAPIKeyHandler issues a new API key and returns its secret.
+func (s *Server) CreateAPIKeyHandler(c *gin.Context) {
+	if !authorize(c, "Failed to create API key", policy.ManageKeys, nil) {
+		return
+	}
+
+	var req newAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		abortWithError(c, "Failed to create API key", &database.ValidationError{Field: "expires_at", Message: "must be in the future"})
+		return
+	}
+
+	secret, prefix, hash := auth.NewAPIKey()
+	key := &models.APIKey{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		Prefix:    prefix,
+		Hash:      hash,
+		RateLimit: req.RateLimit,
+		CreatedBy: principalFrom(c).ID,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.db.CreateAPIKey(c.Request.Context(), key); err != nil {
+		abortWithError(c, "Failed to create API key", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, apiKeyResponse{Key: key, Secret: secret})
+}
+
+// RotateAPIKeyHandler gives a key a new secret. The old secret stops working
+// at once, while the name, scopes and expiry of the key are kept.
+func (s *Server) RotateAPIKeyHandler(c *gin.Context) {
+	if !authorize(c, "Failed to rotate API key", policy.ManageKeys, nil) {
+		return
+	}
+
+	secret, prefix, hash := auth.NewAPIKey()
+	key, err := s.db.RotateAPIKey(c.Request.Context(), c.Param("id"), prefix, hash)
+	if err != nil {
+		abortWithError(c, "Failed to rotate API key", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, apiKeyResponse{Key: key, Secret: secret})
+}
+
+// DeleteAPIKeyHandler revokes a key for good.
+func (s *Server) DeleteAPIKeyHandler(c *gin.Context) {
+	if !authorize(c, "Failed to revoke API key", policy.ManageKeys, nil) {
+		return
+	}
+
+	if err := s.db.DeleteAPIKey(c.Request.Context(), c.Param("id")); err != nil {
+		abortWithError(c, "Failed to revoke API key", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
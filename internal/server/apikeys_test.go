@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-news/internal/auth"
+	"test-news/internal/database/models"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyHandlers(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	create := func(token, body string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(body)), token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	newPost := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{"title":"Wire","content":"From the wire"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := create(tk.editor, `{"name":"wire","scopes":["posts:write"]}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an editor, got %d", rr.Code)
+	}
+	if rr := create(tk.admin, `{"name":"wire","scopes":["posts:delete"]}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unknown scope, got %d", rr.Code)
+	}
+
+	rr := create(tk.admin, `{"name":"wire","scopes":["posts:read","posts:write"]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var created apiKeyResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsAPIKey(created.Secret) || !strings.HasPrefix(created.Secret, created.Key.Prefix) {
+		t.Fatalf("unexpected key: %+v", created)
+	}
+	if strings.Contains(rr.Body.String(), auth.HashAPIKey(created.Secret)) {
+		t.Fatal("the hash of the key leaked")
+	}
+
+	// Both headers work, and the key is the author of its posts.
+	rr = newPost(apiKeyHeader, created.Secret)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create post returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var post models.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Author != "wire" || post.AuthorID != created.Key.ID {
+		t.Fatalf("expected the key to be the author, got %q (%s)", post.Author, post.AuthorID.Hex())
+	}
+	if rr := newPost("Authorization", "Bearer "+created.Secret); rr.Code != http.StatusCreated {
+		t.Fatalf("expected a bearer key to work, got %d", rr.Code)
+	}
+
+	key, err := s.db.GetAPIKeyByHash(context.Background(), auth.HashAPIKey(created.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.LastUsedAt == nil {
+		t.Fatal("expected the use of the key to be recorded")
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodPost, "/api/keys/"+created.Key.ID.Hex()+"/rotate", nil), tk.admin))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("rotate returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var rotated apiKeyResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &rotated); err != nil {
+		t.Fatal(err)
+	}
+	if rr := newPost(apiKeyHeader, created.Secret); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the old secret to stop working, got %d", rr.Code)
+	}
+	if rr := newPost(apiKeyHeader, rotated.Secret); rr.Code != http.StatusCreated {
+		t.Fatalf("expected the new secret to work, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodDelete, "/api/keys/"+created.Key.ID.Hex(), nil), tk.admin))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete returned %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := newPost(apiKeyHeader, rotated.Secret); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a revoked key to stop working, got %d", rr.Code)
+	}
+}
+
+func TestAPIKeyScopesAndExpiry(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	issue := func(key *models.APIKey) string {
+		secret, prefix, hash := auth.NewAPIKey()
+		key.Prefix, key.Hash = prefix, hash
+		if err := s.db.CreateAPIKey(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+	yesterday := time.Now().Add(-24 * time.Hour)
+	reader := issue(&models.APIKey{Name: "feed", Scopes: []models.Scope{models.ScopePostsRead}})
+	expired := issue(&models.APIKey{Name: "old", Scopes: []models.Scope{models.ScopePostsWrite}, ExpiresAt: &yesterday})
+
+	draft := &models.Post{Title: "Draft", Content: "body"}
+	if err := s.db.CreatePost(context.Background(), draft); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, url, secret string) int {
+		req := httptest.NewRequest(method, url, strings.NewReader(`{"title":"t","content":"c"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(apiKeyHeader, secret)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Reading keys get the public view, drafts are for the newsroom.
+	if code := do(http.MethodGet, "/api/posts/"+draft.ID.Hex(), reader); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a posts:read key reading a draft, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/posts?status=draft", reader); code != http.StatusOK {
+		t.Fatalf("expected a posts:read key to list posts, got %d", code)
+	}
+	if code := do(http.MethodPost, "/api/posts", reader); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a posts:read key creating a post, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/posts", expired); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an expired key, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/posts", "tn_unknown"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown key, got %d", code)
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	secret, prefix, hash := auth.NewAPIKey()
+	key := &models.APIKey{Name: "bot", Scopes: []models.Scope{models.ScopePostsRead}, Prefix: prefix, Hash: hash, RateLimit: 2}
+	if err := s.db.CreateAPIKey(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	var rr *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+		req.Header.Set(apiKeyHeader, secret)
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+	}
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 past the limit, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+	var p Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeRateLimited {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+}
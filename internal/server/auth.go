@@ -0,0 +1,213 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-news/internal/auth"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"test-news/internal/policy"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// apiKeyHeader carries an API key, as an alternative to sending it in the
+// Authorization header.
+const apiKeyHeader = "X-API-Key"
+
+// authenticate identifies the caller from an "Authorization: Bearer" header
+// carrying an access token or an API key, from an X-API-Key header, or from
+// the session cookie of the web UI. Requests without credentials carry on
+// anonymously, while invalid or expired ones in a header are refused so that
+// they never silently downgrade to the public view.
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p *policy.Principal
+		var ok bool
+
+		if key := c.GetHeader(apiKeyHeader); key != "" {
+			p, ok = s.keyPrincipal(c, key)
+		} else if header := c.GetHeader("Authorization"); header != "" {
+			token, bearer := strings.CutPrefix(header, "Bearer ")
+			switch {
+			case !bearer:
+				abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Unauthorized", "The credentials are not valid"))
+			case auth.IsAPIKey(token):
+				p, ok = s.keyPrincipal(c, token)
+			default:
+				p, ok = s.tokenPrincipal(c, token)
+			}
+		} else if cookie, err := c.Cookie(sessionCookie); err == nil && cookie != "" {
+			p, ok = s.sessionPrincipal(c, cookie)
+		} else {
+			c.Next()
+			return
+		}
+		if !ok {
+			return
+		}
+		if p == nil {
+			c.Next()
+			return
+		}
+
+		ctx := policy.WithPrincipal(c.Request.Context(), p)
+		c.Request = c.Request.WithContext(database.WithEditor(ctx, p.Name))
+		c.Next()
+	}
+}
+
+// tokenPrincipal verifies an access token, aborting the request when it is
+// not valid.
+func (s *Server) tokenPrincipal(c *gin.Context, token string) (*policy.Principal, bool) {
+	claims, err := s.tokens.Verify(token, auth.AccessToken)
+	var id primitive.ObjectID
+	if err == nil {
+		id, err = primitive.ObjectIDFromHex(claims.Subject)
+	}
+	if err != nil {
+		abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Unauthorized", "The credentials are not valid or have expired"))
+		return nil, false
+	}
+
+	return &policy.Principal{ID: id, Name: claims.Name, Role: claims.Role}, true
+}
+
+// keyPrincipal looks up an API key and charges the request to its rate
+// limit, aborting the request when the key is unknown, expired or over its
+// limit. A key with the posts:write scope acts as a writer, and one that may
+// only read as a reader.
+func (s *Server) keyPrincipal(c *gin.Context, secret string) (*policy.Principal, bool) {
+	key, err := s.db.GetAPIKeyByHash(c.Request.Context(), auth.HashAPIKey(secret))
+	if errors.Is(err, database.ErrAPIKeyNotFound) {
+		abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Unauthorized", "The API key is not valid"))
+		return nil, false
+	}
+	if err != nil {
+		abortWithError(c, "Unauthorized", err)
+		return nil, false
+	}
+
+	now := time.Now()
+	if key.Expired(now) {
+		abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Unauthorized", "The API key has expired"))
+		return nil, false
+	}
+
+	if ok, wait := s.limits.allow(key, now); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		abortWithProblem(c, newProblem(http.StatusTooManyRequests, codeRateLimited, "Too many requests",
+			"The API key is over its rate limit, retry later"))
+		return nil, false
+	}
+
+	if err := s.db.TouchAPIKey(c.Request.Context(), key.ID, now); err != nil {
+		log.Printf("Failed to record the use of API key %s: %v", key.ID.Hex(), err)
+	}
+
+	role := models.RoleReader
+	if key.HasScope(models.ScopePostsWrite) {
+		role = models.RoleWriter
+	}
+	return &policy.Principal{ID: key.ID, Name: key.Name, Role: role, APIKey: true}, true
+}
+
+// requireAuth refuses anonymous requests.
+func requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principalFrom(c) == nil {
+			abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Unauthorized", "Sign in to use this endpoint"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// principalFrom returns the caller of the request, or nil when anonymous.
+func principalFrom(c *gin.Context) *policy.Principal {
+	return policy.PrincipalFrom(c.Request.Context())
+}
+
+// loginRequest is the body of POST /api/auth/login.
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginHandler trades a username and password for a pair of tokens.
+func (s *Server) LoginHandler(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	user, err := s.db.GetUserByUsername(c.Request.Context(), req.Username)
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		abortWithError(c, "Failed to log in", err)
+		return
+	}
+
+	// An unknown user is checked against no hash at all, which costs as
+	// much as a wrong password and so doesn't give the username away.
+	var hash string
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if !auth.CheckPassword(hash, req.Password) {
+		abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Failed to log in", "The username or password is not valid"))
+		return
+	}
+
+	s.issueTokens(c, user)
+}
+
+// refreshRequest is the body of POST /api/auth/refresh.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshHandler trades a refresh token for a new pair of tokens. The user
+// is read again, so a changed name or role takes effect here.
+func (s *Server) RefreshHandler(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	claims, err := s.tokens.Verify(req.RefreshToken, auth.RefreshToken)
+	if err != nil {
+		abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Failed to refresh", "The refresh token is not valid or has expired"))
+		return
+	}
+
+	user, err := s.db.GetUser(c.Request.Context(), claims.Subject)
+	if errors.Is(err, database.ErrUserNotFound) {
+		abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Failed to refresh", "The user no longer exists"))
+		return
+	}
+	if err != nil {
+		abortWithError(c, "Failed to refresh", err)
+		return
+	}
+
+	s.issueTokens(c, user)
+}
+
+func (s *Server) issueTokens(c *gin.Context, user *models.User) {
+	tokens, err := s.tokens.Issue(user)
+	if err != nil {
+		abortWithError(c, "Failed to issue tokens", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-news/internal/auth"
+	"test-news/internal/database/models"
+	"testing"
+	"time"
+)
+
+func TestLoginAndRefreshHandlers(t *testing.T) {
+	_, h, _ := newTestServer()
+
+	post := func(url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, body := range []string{
+		`{"username":"will","password":"wrong password"}`,
+		`{"username":"nobody","password":"` + testPassword + `"}`,
+	} {
+		if rr := post("/api/auth/login", body); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for %s, got %d", body, rr.Code)
+		}
+	}
+
+	// Usernames are not case sensitive.
+	rr := post("/api/auth/login", `{"username":"Will","password":"`+testPassword+`"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var tokens auth.TokenPair
+	if err := json.Unmarshal(rr.Body.Bytes(), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.TokenType != "Bearer" || tokens.ExpiresIn != 60 {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, "/api/auth/me", nil), tokens.AccessToken))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("me returned %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "password") {
+		t.Fatalf("the password hash leaked: %s", rr.Body.String())
+	}
+	var me models.User
+	if err := json.Unmarshal(rr.Body.Bytes(), &me); err != nil {
+		t.Fatal(err)
+	}
+	if me.Username != "will" || me.Role != models.RoleWriter {
+		t.Fatalf("unexpected user: %+v", me)
+	}
+
+	// A refresh token doesn't sign requests in, and vice versa.
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, "/api/auth/me", nil), tokens.RefreshToken))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a refresh token, got %d", rr.Code)
+	}
+	if rr := post("/api/auth/refresh", `{"refresh_token":"`+tokens.AccessToken+`"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for refreshing with an access token, got %d", rr.Code)
+	}
+
+	rr = post("/api/auth/refresh", `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("refresh returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var refreshed auth.TokenPair
+	if err := json.Unmarshal(rr.Body.Bytes(), &refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.AccessToken == "" {
+		t.Fatalf("unexpected tokens: %+v", refreshed)
+	}
+}
+
+func TestAuthenticateRejectsBadTokens(t *testing.T) {
+	_, h, _ := newTestServer()
+
+	forged := auth.NewIssuer([]byte("another-secret"), time.Minute, time.Hour)
+	token, err := forged.Issue(&models.User{Name: "mallory", Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, header := range []string{"Bearer not-a-token", "Basic d2lsbDp3aWxs", "Bearer " + token.AccessToken} {
+		req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+		req.Header.Set("Authorization", header)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for %q, got %d", header, rr.Code)
+		}
+	}
+}
+
+func TestCreateUserHandler(t *testing.T) {
+	_, h, tk := newTestServer()
+
+	create := func(token, body string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(body)), token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	body := `{"username":"Nina","name":"Nina Simone","password":"feeling good"}`
+	if rr := create(tk.editor, body); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an editor, got %d", rr.Code)
+	}
+
+	rr := create(tk.admin, body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var user models.User
+	if err := json.Unmarshal(rr.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "nina" || user.Role != models.RoleWriter {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	if rr := create(tk.admin, body); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken username, got %d", rr.Code)
+	}
+	if rr := create(tk.admin, `{"username":"short","name":"Short","password":"short"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a short password, got %d", rr.Code)
+	}
+	if rr := create(tk.admin, `{"username":"boss","name":"Boss","password":"feeling good","role":"owner"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unknown role, got %d", rr.Code)
+	}
+}
@@ -2,8 +2,9 @@ package server
 
 import (
 	"net/http"
+	"test-news/internal/database"
 	"test-news/internal/database/models"
-	"time"
+	"test-news/internal/policy"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,47 +17,140 @@ func (s *Server) HelloWorldHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// healthHandler reports the database status, answering 503 when it is down.
 func (s *Server) healthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, s.db.Health())
+	stats := s.db.Health(c.Request.Context())
+	if stats["status"] == "down" {
+		c.JSON(http.StatusServiceUnavailable, stats)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
 }
 
+// GetPostsHandler returns one page of posts, newest first unless ?sort= says
+// otherwise. The page size is set with ?limit= and further pages are reached
+// by passing back the next_cursor or prev_cursor of a response as ?cursor=.
+// Adding ?count=true includes the total number of matching posts. See
+// listOptionsFromQuery for the filters.
 func (s *Server) GetPostsHandler(c *gin.Context) {
-	posts, err := s.db.GetPosts()
+	s.listPosts(c, false)
+}
+
+// GetTrashHandler lists the posts in the trash, with the same paging,
+// filters and sorting as GetPostsHandler.
+func (s *Server) GetTrashHandler(c *gin.Context) {
+	s.listPosts(c, true)
+}
+
+func (s *Server) listPosts(c *gin.Context, trashed bool) {
+	opts, err := listOptionsFromQuery(c.Request.URL.Query())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch posts",
-			"details": err.Error(),
-		})
+		abortWithQueryError(c, "Invalid query", err)
+		return
+	}
+	opts.Trashed = trashed
+	if !restrictToVisible(c, &opts.Filter) {
+		return
+	}
+
+	page, err := s.db.ListPosts(c.Request.Context(), opts)
+	if err != nil {
+		abortWithQueryError(c, "Failed to fetch posts", err)
+		return
+	}
+
+	resp := gin.H{
+		"data":        page.Posts,
+		"count":       len(page.Posts),
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	}
+	if page.Total != nil {
+		resp["total"] = *page.Total
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SearchPostsHandler runs a full-text search over titles and content with
+// ?q=, returning the best matches first together with their relevance score
+// and a highlighted snippet.
+func (s *Server) SearchPostsHandler(c *gin.Context) {
+	query, limit, err := searchFromQuery(c.Request.URL.Query())
+	if err != nil {
+		abortWithQueryError(c, "Invalid query", err)
+		return
+	}
+
+	var filter database.PostFilter
+	if !restrictToVisible(c, &filter) {
 		return
 	}
 
+	results, err := s.db.SearchPosts(c.Request.Context(), query, limit, filter)
+	if err != nil {
+		abortWithQueryError(c, "Failed to search posts", err)
+		return
+	}
+
+	data := make([]gin.H, 0, len(results))
+	for _, r := range results {
+		data = append(data, gin.H{
+			"post":    r.Post,
+			"score":   r.Score,
+			"snippet": r.Snippet,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"data":  posts,
-		"count": len(posts),
+		"data":  data,
+		"count": len(data),
 	})
 }
 
+// newPostRequest is the body of POST /api/posts. It has no author, since a
+// new post is always credited to the signed-in user.
+type newPostRequest struct {
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content" binding:"required"`
+	// HeroImage and Media refer to files uploaded through POST /api/media.
+	HeroImage *models.Media  `json:"hero_image"`
+	Media     []models.Media `json:"media"`
+}
+
 func (s *Server) CreatePostHandler(c *gin.Context) {
-	var post models.Post
-	if err := c.ShouldBindJSON(&post); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid input",
-			"details": err.Error(),
-		})
+	if !authorize(c, "Failed to create post", policy.CreatePost, nil) {
 		return
 	}
 
-	// Set default values
-	now := time.Now()
-	post.CreatedAt = now
-	post.UpdatedAt = now
+	var req newPostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
 
-	err := s.db.CreatePost(&post)
+	if err := s.resolvePostMedia(c.Request.Context(), req.HeroImage, req.Media); err != nil {
+		abortWithError(c, "Failed to create post", err)
+		return
+	}
+
+	author := principalFrom(c)
+	byline, err := policy.Byline(c.Request.Context(), s.db, author)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to create post",
-			"details": err.Error(),
-		})
+		abortWithError(c, "Failed to create post", err)
+		return
+	}
+	post := models.Post{
+		Title:     req.Title,
+		Content:   req.Content,
+		Author:    byline,
+		AuthorID:  author.ID,
+		HeroImage: req.HeroImage,
+		Media:     req.Media,
+	}
+
+	if err := s.db.CreatePost(c.Request.Context(), &post); err != nil {
+		abortWithError(c, "Failed to create post", err)
 		return
 	}
 
@@ -68,98 +162,163 @@ func (s *Server) GetPostHandler(c *gin.Context) {
 
 	// Validate ObjectID format
 	if !isValidObjectID(id) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID format"})
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidID, "Invalid post ID format", "The ID is not a valid post ID"))
 		return
 	}
 
-	post, err := s.db.GetPost(id)
+	post, err := s.db.GetPost(c.Request.Context(), id)
+	if err == nil && !policy.Visible(principalFrom(c), post) {
+		err = database.ErrPostNotFound
+	}
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "post not found" {
-			status = http.StatusNotFound
-		}
+		abortWithError(c, "Failed to retrieve post", err)
+		return
+	}
 
-		c.JSON(status, gin.H{
-			"error":   "Failed to retrieve post",
-			"details": err.Error(),
-		})
+	etag := postETag(post)
+	c.Header("ETag", etag)
+	if notModified(c, etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
 	c.JSON(http.StatusOK, post)
 }
 
+// updatePostRequest is the body of PUT /api/posts/:id. Like newPostRequest it
+// has no author, which stays the account that created the post.
+type updatePostRequest struct {
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content" binding:"required"`
+}
 
+// UpdatePostHandler replaces the title and content of a post. The ID, author
+// and created_at are server managed and always kept.
 func (s *Server) UpdatePostHandler(c *gin.Context) {
-	id := c.Param("id")
+	current, ok := s.authorizePost(c, "Failed to update post", policy.EditPost)
+	if !ok {
+		return
+	}
 
-	// Validate ObjectID format
-	if !isValidObjectID(id) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID format"})
+	version, ok := requireIfMatch(c)
+	if !ok {
 		return
 	}
 
-	var post models.Post
-	if err := c.ShouldBindJSON(&post); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid input",
-			"details": err.Error(),
-		})
+	var req updatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
 		return
 	}
 
-	// Update modification time
-	post.UpdatedAt = time.Now()
+	updatedPost, err := s.db.UpdatePost(c.Request.Context(), current.ID.Hex(), version, &models.Post{
+		Title:   req.Title,
+		Content: req.Content,
+	})
+	if err != nil {
+		abortWithError(c, "Failed to update post", err)
+		return
+	}
 
-	err := s.db.UpdatePost(id, &post)
+	c.Header("ETag", postETag(updatedPost))
+	c.JSON(http.StatusOK, updatedPost)
+}
+
+// PatchPostHandler applies a JSON Merge Patch (RFC 7396) to a post, changing
+// only the fields present in the body.
+func (s *Server) PatchPostHandler(c *gin.Context) {
+	current, ok := s.authorizePost(c, "Failed to update post", policy.EditPost)
+	if !ok {
+		return
+	}
+
+	if c.ContentType() != mergePatchContentType {
+		abortWithProblem(c, newProblem(http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Unsupported media type",
+			"PATCH requests must use "+mergePatchContentType))
+		return
+	}
+
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	patch, err := decodeMergePatch(c.Request.Body)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "post not found" {
-			status = http.StatusNotFound
-		}
+		abortWithPatchError(c, err)
+		return
+	}
 
-		c.JSON(status, gin.H{
-			"error":   "Failed to update post",
-			"details": err.Error(),
-		})
+	var inline []models.Media
+	if patch.Media != nil {
+		inline = *patch.Media
+	}
+	if err := s.resolvePostMedia(c.Request.Context(), patch.HeroImage, inline); err != nil {
+		abortWithError(c, "Failed to update post", err)
 		return
 	}
 
-	// Fetch the updated post to return the complete object
-	updatedPost, err := s.db.GetPost(id)
+	var updatedPost *models.Post
+	if patch.IsEmpty() {
+		// An empty merge patch is a valid no-op, but still honours If-Match.
+		updatedPost = current
+		if version != database.AnyVersion && current.Version != version {
+			err = database.ErrVersionMismatch
+		}
+	} else {
+		updatedPost, err = s.db.PatchPost(c.Request.Context(), current.ID.Hex(), version, patch)
+	}
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"message": "Post updated successfully but couldn't retrieve updated data"})
+		abortWithError(c, "Failed to update post", err)
 		return
 	}
 
+	c.Header("ETag", postETag(updatedPost))
 	c.JSON(http.StatusOK, updatedPost)
 }
 
-
 func (s *Server) DeletePostHandler(c *gin.Context) {
+	post, ok := s.authorizePost(c, "Failed to delete post", policy.DeletePost)
+	if !ok {
+		return
+	}
+
+	err := s.db.DeletePost(c.Request.Context(), post.ID.Hex())
+	if err != nil {
+		abortWithError(c, "Failed to delete post", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post moved to trash"})
+}
+
+// RestorePostHandler takes a post out of the trash.
+func (s *Server) RestorePostHandler(c *gin.Context) {
 	id := c.Param("id")
 
 	// Validate ObjectID format
 	if !isValidObjectID(id) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID format"})
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidID, "Invalid post ID format", "The ID is not a valid post ID"))
 		return
 	}
 
-	err := s.db.DeletePost(id)
+	trashed, err := s.db.GetTrashedPost(c.Request.Context(), id)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "post not found" {
-			status = http.StatusNotFound
-		}
+		abortWithError(c, "Failed to restore post", err)
+		return
+	}
+	if !authorize(c, "Failed to restore post", policy.DeletePost, trashed) {
+		return
+	}
 
-		c.JSON(status, gin.H{
-			"error":   "Failed to delete post",
-			"details": err.Error(),
-		})
+	post, err := s.db.RestorePost(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, "Failed to restore post", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
+	c.Header("ETag", postETag(post))
+	c.JSON(http.StatusOK, post)
 }
 
 // Helper function to validate MongoDB ObjectID
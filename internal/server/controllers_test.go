@@ -1,11 +1,23 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"test-news/internal/auth"
+	"test-news/internal/database"
+	"test-news/internal/database/memory"
+	"test-news/internal/database/models"
+	"test-news/internal/markdown"
+	"test-news/internal/media"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHelloWorldHandler(t *testing.T) {
@@ -32,4 +44,502 @@ func TestHelloWorldHandler(t *testing.T) {
 	}
 }
 
+func TestHealthHandler(t *testing.T) {
+	_, h, _ := newTestServer()
 
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	s, h, _ := newTestServer()
+	s.db = downDB{s.db}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a database that is down, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"status":"down"`) {
+		t.Fatalf("expected a down status, got %s", rr.Body.String())
+	}
+}
+
+// downDB is a database that reports itself down.
+type downDB struct {
+	database.Service
+}
+
+func (downDB) Health(ctx context.Context) map[string]string {
+	return map[string]string{"status": "down", "message": "It's not healthy"}
+}
+
+// testTokens are the access tokens of the users of a test server, see
+// newTestServer.
+type testTokens struct {
+	reader string
+	writer string
+	editor string
+	admin  string
+}
+
+// testPassword is the password of every user of the test server.
+const testPassword = "correct horse"
+
+// newTestServer returns a server on the memory backend with a user of every
+// role: rita the reader, will the writer, erin the editor and ada the admin,
+// along with their access tokens.
+func newTestServer() (*Server, http.Handler, testTokens) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{
+		db:     memory.New(),
+		tokens: auth.NewIssuer([]byte("test-secret"), time.Minute, time.Hour),
+		limits: newKeyLimiter(60),
+
+		sessionTTL: time.Hour,
+		media:      media.NewLibrary(media.NewMemoryStore(), 1<<20),
+		renderings: markdown.NewCache(100),
+	}
+
+	// A cheap hash, since the real cost would dominate the tests.
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+	var tk testTokens
+	for _, u := range []struct {
+		token *string
+		user  models.User
+	}{
+		{&tk.reader, models.User{Username: "rita", Name: "rita", Role: models.RoleReader}},
+		{&tk.writer, models.User{Username: "will", Name: "will", Role: models.RoleWriter}},
+		{&tk.editor, models.User{Username: "erin", Name: "erin", Role: models.RoleEditor}},
+		{&tk.admin, models.User{Username: "ada", Name: "ada", Role: models.RoleAdmin}},
+	} {
+		u.user.PasswordHash = string(hash)
+		if err := s.db.CreateUser(context.Background(), &u.user); err != nil {
+			panic(err)
+		}
+		tokens, err := s.tokens.Issue(&u.user)
+		if err != nil {
+			panic(err)
+		}
+		*u.token = tokens.AccessToken
+	}
+
+	return s, s.RegisterRoutes(), tk
+}
+
+// userID returns the ID of one of the users of the test server.
+func userID(t *testing.T, s *Server, username string) primitive.ObjectID {
+	t.Helper()
+	user, err := s.db.GetUserByUsername(context.Background(), username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// withToken signs req in with one of the test server's tokens.
+func withToken(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// publish creates post and takes it straight to published, so that it is
+// visible to anonymous requests.
+func publish(t *testing.T, s *Server, post *models.Post) {
+	t.Helper()
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	published, err := s.db.TransitionPost(context.Background(), post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusPublished})
+	if err != nil {
+		t.Fatal(err)
+	}
+	*post = *published
+}
+
+func TestCreateAndGetPostHandler(t *testing.T) {
+	_, h, tk := newTestServer()
+
+	body := `{"title":"Hello","content":"World","author":"Jane"}`
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body)))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an anonymous create, got %d", rr.Code)
+	}
+
+	req := withToken(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body)), tk.writer)
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var created models.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Status != models.StatusDraft {
+		t.Fatalf("expected a new post to be a draft, got %q", created.Status)
+	}
+	// The author comes from the token, not from the body.
+	if created.Author != "will" || created.AuthorID.IsZero() {
+		t.Fatalf("expected will to be the author, got %q (%s)", created.Author, created.AuthorID.Hex())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, "/api/posts/"+created.ID.Hex(), nil), tk.editor))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, "/api/posts", nil), tk.editor))
+	var list struct {
+		Count int `json:"count"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Count != 1 {
+		t.Fatalf("expected 1 post, got %d", list.Count)
+	}
+}
+
+func TestGetPostHandlerNotFound(t *testing.T) {
+	_, h, tk := newTestServer()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts/000000000000000000000000", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("expected application/problem+json, got %s", ct)
+	}
+
+	var p Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeNotFound || p.Status != http.StatusNotFound {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodDelete, "/api/posts/000000000000000000000000", nil), tk.editor))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestCreatePostHandlerValidation(t *testing.T) {
+	_, h, tk := newTestServer()
+
+	req := withToken(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{"title":"Hello"}`)), tk.editor)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var p Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeValidationFailed || len(p.Errors) == 0 {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	req = withToken(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{not json`)), tk.editor)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	long := `{"title":"Long","content":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+	req = withToken(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(long)), tk.editor)
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for an oversized body, got %d", rr.Code)
+	}
+}
+
+func TestGetPostsHandlerPagination(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	for i := 0; i < 3; i++ {
+		publish(t, s, &models.Post{Title: "t", Content: "c", Author: "a"})
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts?limit=2&count=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var page struct {
+		Count      int    `json:"count"`
+		Total      int    `json:"total"`
+		NextCursor string `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Count != 2 || page.Total != 3 || page.NextCursor == "" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts?limit=2&cursor="+page.NextCursor, nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Count != 1 || page.NextCursor != "" {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+
+	for _, query := range []string{"limit=abc", "limit=0", "limit=101", "cursor=nope", "count=maybe"} {
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestSearchPostsHandler(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	publish(t, s, &models.Post{Title: "Election night", Content: "Votes are counted", Author: "a"})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts/search?q=election", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Data []struct {
+			Post  models.Post `json:"post"`
+			Score float64     `json:"score"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Post.Title != "Election night" || resp.Data[0].Score == 0 {
+		t.Fatalf("unexpected results: %+v", resp.Data)
+	}
+
+	for _, query := range []string{"", "q=", "q=a&sort=title"} {
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/posts/search?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestPatchPostHandler(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	post := &models.Post{Title: "Original", Content: "body", Author: "jane"}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPatch, "/api/posts/"+post.ID.Hex(), strings.NewReader(body)), tk.editor)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := patch(mergePatchContentType, `{"title":"Patched"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var updated models.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "Patched" || updated.Content != "body" || !updated.CreatedAt.Equal(post.CreatedAt) {
+		t.Fatalf("unexpected patched post: %+v", updated)
+	}
+
+	if rr := patch("application/json", `{"title":"x"}`); rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for application/json, got %d", rr.Code)
+	}
+	if rr := patch(mergePatchContentType, `[1,2]`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-object body, got %d", rr.Code)
+	}
+	for _, body := range []string{`{"title":null}`, `{"created_at":"2020-01-01T00:00:00Z"}`, `{"views":3}`, `{"title":5}`, `{"content":" "}`, `{"author":"someone else"}`, `{"author_id":"000000000000000000000000"}`} {
+		if rr := patch(mergePatchContentType, body); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422, got %d", body, rr.Code)
+		}
+	}
+	if rr := patch(mergePatchContentType, `{}`); rr.Code != http.StatusOK {
+		t.Errorf("expected an empty patch to succeed, got %d", rr.Code)
+	}
+}
+
+func TestUpdatePostHandlerKeepsServerFields(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	post := &models.Post{Title: "Original", Content: "body", Author: "jane"}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	req := withToken(httptest.NewRequest(http.MethodPut, "/api/posts/"+post.ID.Hex(),
+		strings.NewReader(`{"title":"New","content":"new body","author":"john","created_at":"2001-01-01T00:00:00Z"}`)), tk.editor)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", postETag(post))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var updated models.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if !updated.CreatedAt.Equal(post.CreatedAt) || updated.Author != "jane" || updated.Title != "New" {
+		t.Fatalf("unexpected updated post: %+v", updated)
+	}
+}
+
+func TestConditionalUpdates(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	post := &models.Post{Title: "Original", Content: "body", Author: "jane"}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	url := "/api/posts/" + post.ID.Hex()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, url, nil), tk.editor))
+	etag := rr.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	req := withToken(httptest.NewRequest(http.MethodGet, url, nil), tk.editor)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rr.Code)
+	}
+
+	patch := func(ifMatch string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPatch, url, strings.NewReader(`{"title":"Edited"}`)), tk.editor)
+		req.Header.Set("Content-Type", mergePatchContentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := patch(""); rr.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without If-Match, got %d", rr.Code)
+	}
+
+	// The first editor wins and moves the version on.
+	rr = patch(etag)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected the new ETag \"2\", got %q", rr.Header().Get("ETag"))
+	}
+
+	// The second editor still holds the old ETag.
+	rr = patch(etag)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale ETag, got %d", rr.Code)
+	}
+	var p Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codePreconditionFailed {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	if rr := patch(`W/"2"`); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a weak ETag, got %d", rr.Code)
+	}
+	if rr := patch(`"2", "3"`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a list of ETags, got %d", rr.Code)
+	}
+}
+
+func TestTrashHandlers(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	post := &models.Post{Title: "Doomed", Content: "body", Author: "jane"}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	url := "/api/posts/" + post.ID.Hex()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodDelete, url, nil), tk.editor))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a trashed post, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, "/api/trash", nil), tk.editor))
+	var trash struct {
+		Data []models.Post `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &trash); err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.Data) != 1 || trash.Data[0].ID != post.ID || trash.Data[0].DeletedAt == nil {
+		t.Fatalf("unexpected trash: %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodPost, url+"/restore", nil), tk.editor))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("restore returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodPost, url+"/restore", nil), tk.editor))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when restoring a live post, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, url, nil), tk.editor))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the restored post, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postETag is the strong entity tag of a post, derived from its version.
+func postETag(post *models.Post) string {
+	return fmt.Sprintf(`"%d"`, post.Version)
+}
+
+// requireIfMatch reads the post version a conditional request expects from
+// the If-Match header. It aborts with 428 when the header is missing. A tag
+// that cannot name a version, such as a weak one, yields a version no post
+// has so the update fails its precondition.
+func requireIfMatch(c *gin.Context) (int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		abortWithProblem(c, newProblem(http.StatusPreconditionRequired, codePreconditionRequired, "Precondition required",
+			"Send the ETag of the post you edited in an If-Match header"))
+		return 0, false
+	}
+
+	if header == "*" {
+		return database.AnyVersion, true
+	}
+
+	if strings.Contains(header, ",") {
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidInput, "Invalid If-Match header",
+			"If-Match must name a single ETag"))
+		return 0, false
+	}
+
+	unquoted, err := strconv.Unquote(header)
+	if err != nil {
+		return -1, true
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 1 {
+		return -1, true
+	}
+
+	return version, true
+}
+
+// notModified reports whether the If-None-Match header of a GET already
+// names etag, in which case the caller should answer 304.
+func notModified(c *gin.Context, etag string) bool {
+	for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"test-news/internal/database/models"
+	"test-news/internal/feed"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// siteTitle names the site in its feeds.
+const siteTitle = "Test News"
+
+// feedMaxAge is how long clients may reuse a feed without asking again.
+const feedMaxAge = 5 * time.Minute
+
+// RSSFeedHandler serves the latest published posts as RSS 2.0, of a single
+// author when the author_id query parameter names one.
+func (s *Server) RSSFeedHandler(c *gin.Context) {
+	s.serveFeed(c, feed.RSSContentType, (*feed.Feed).RSS)
+}
+
+// AtomFeedHandler serves the latest published posts as Atom.
+func (s *Server) AtomFeedHandler(c *gin.Context) {
+	s.serveFeed(c, feed.AtomContentType, (*feed.Feed).Atom)
+}
+
+// JSONFeedHandler serves the latest published posts as JSON Feed 1.1.
+func (s *Server) JSONFeedHandler(c *gin.Context) {
+	s.serveFeed(c, feed.JSONContentType, (*feed.Feed).JSON)
+}
+
+// serveFeed builds the feed asked for and writes it with encode. The feed
+// only changes with its posts, so a client that has the current one gets a
+// 304 through If-None-Match or If-Modified-Since.
+func (s *Server) serveFeed(c *gin.Context, contentType string, encode func(*feed.Feed) ([]byte, error)) {
+	var authorID primitive.ObjectID
+	if id := c.Query("author_id"); id != "" {
+		var err error
+		if authorID, err = primitive.ObjectIDFromHex(id); err != nil {
+			abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidID, "Invalid author ID format", "The author_id is not a valid ID"))
+			return
+		}
+	}
+
+	posts, err := feed.Select(c.Request.Context(), s.db, authorID)
+	if err != nil {
+		abortWithError(c, "Failed to build feed", err)
+		return
+	}
+
+	title, description := siteTitle, "The latest posts of "+siteTitle
+	base := s.siteURL(c)
+	self := base + c.Request.URL.Path
+	var author string
+	if !authorID.IsZero() {
+		if author, err = s.feedAuthor(c, authorID, posts); err != nil {
+			abortWithError(c, "Failed to build feed", err)
+			return
+		}
+		title, description = siteTitle+": "+author, "The latest posts by "+author+" on "+siteTitle
+		self += "?author_id=" + authorID.Hex()
+	}
+	f, err := feed.New(title, description, base, self, posts, s.renderings)
+	if err != nil {
+		abortWithError(c, "Failed to build feed", err)
+		return
+	}
+	f.Author = author
+
+	etag := feedETag(contentType, f)
+	c.Header("ETag", etag)
+	s.cacheFor(c, feedMaxAge)
+	if !f.Updated.IsZero() {
+		c.Header("Last-Modified", f.Updated.Format(http.TimeFormat))
+	}
+	if feedNotModified(c, etag, f.Updated) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	body, err := encode(f)
+	if err != nil {
+		abortWithError(c, "Failed to build feed", err)
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// feedAuthor names the author of a per-author feed. The posts carry the name
+// set by the server, and an author without published posts is looked up
+// among the users.
+func (s *Server) feedAuthor(c *gin.Context, id primitive.ObjectID, posts []*models.Post) (string, error) {
+	if len(posts) > 0 {
+		return posts[0].Author, nil
+	}
+
+	user, err := s.db.GetUser(c.Request.Context(), id.Hex())
+	if err != nil {
+		return "", err
+	}
+	return user.Name, nil
+}
+
+// feedETag derives the entity tag of a feed from what it shows, so it
+// changes whenever a post is published, edited or withdrawn.
+func feedETag(contentType string, f *feed.Feed) string {
+	h := sha256.New()
+	fmt.Fprintln(h, contentType, f.Title, f.FeedURL)
+	for _, item := range f.Items {
+		fmt.Fprintln(h, item.ID, item.Updated.UnixNano())
+	}
+	return strconv.Quote(hex.EncodeToString(h.Sum(nil))[:32])
+}
+
+// feedNotModified applies the conditional headers of a GET. As RFC 9110
+// asks, If-Modified-Since only counts when If-None-Match is absent.
+func feedNotModified(c *gin.Context, etag string, updated time.Time) bool {
+	if c.GetHeader("If-None-Match") != "" {
+		return notModified(c, etag)
+	}
+
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	if err != nil || updated.IsZero() {
+		return false
+	}
+	return !updated.Truncate(time.Second).After(since)
+}
+
+// siteURL is the public address of the site, from BLUEPRINT_BASE_URL or else
+// from the request. Responses that use it are cached through cacheFor.
+func (s *Server) siteURL(c *gin.Context) string {
+	if s.baseURL != "" {
+		return s.baseURL
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// cacheFor lets a response holding links built by siteURL be reused for
+// maxAge. Without BLUEPRINT_BASE_URL the links come from the Host header,
+// which the client chooses, so a shared cache must not hand them to anyone
+// else: the response is private to the client and varies by Host.
+func (s *Server) cacheFor(c *gin.Context, maxAge time.Duration) {
+	if s.baseURL == "" {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+		c.Header("Vary", "Host")
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+}
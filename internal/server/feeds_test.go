@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-news/internal/database/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFeedHandlers(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	publish(t, s, &models.Post{Title: "By will", Content: "body", Author: "will", AuthorID: userID(t, s, "will")})
+	publish(t, s, &models.Post{Title: "By erin", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")})
+	draft := &models.Post{Title: "Unpublished", Content: "body", Author: "will"}
+	if err := s.db.CreatePost(context.Background(), draft); err != nil {
+		t.Fatal(err)
+	}
+
+	for target, contentType := range map[string]string{
+		"/feed.rss":  "application/rss+xml",
+		"/feed.atom": "application/atom+xml",
+		"/feed.json": "application/feed+json",
+	} {
+		rr := getPage(h, target, nil)
+		if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), contentType) {
+			t.Fatalf("%s: expected a feed, got %d %q", target, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		body := rr.Body.String()
+		if !strings.Contains(body, "By will") || !strings.Contains(body, "By erin") || strings.Contains(body, "Unpublished") {
+			t.Fatalf("%s: expected the published posts only: %s", target, body)
+		}
+		if !strings.Contains(body, "http://example.com/web/posts/") {
+			t.Fatalf("%s: expected absolute links: %s", target, body)
+		}
+
+		// A client holding the current feed is told it hasn't changed.
+		for header, value := range map[string]string{
+			"If-None-Match":     rr.Header().Get("ETag"),
+			"If-Modified-Since": rr.Header().Get("Last-Modified"),
+		} {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set(header, value)
+			cached := httptest.NewRecorder()
+			h.ServeHTTP(cached, req)
+			if cached.Code != http.StatusNotModified {
+				t.Fatalf("%s: expected 304 for %s, got %d", target, header, cached.Code)
+			}
+		}
+	}
+
+	// Per-author feeds follow the account, not the name on a post.
+	erin := userID(t, s, "erin").Hex()
+	publish(t, s, &models.Post{Title: "Named after erin", Content: "body", Author: "erin"})
+	for _, target := range []string{"/feed.atom?author_id=" + erin, "/feed.json?author_id=" + erin} {
+		rr := getPage(h, target, nil)
+		body := rr.Body.String()
+		if !strings.Contains(body, "By erin") || strings.Contains(body, "By will") || strings.Contains(body, "Named after erin") {
+			t.Fatalf("%s: expected the posts of erin only: %s", target, body)
+		}
+	}
+	if rr := getPage(h, "/feed.rss?author_id=erin", nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid author_id, got %d", rr.Code)
+	}
+	if rr := getPage(h, "/feed.rss?author_id="+userID(t, s, "rita").Hex(), nil); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Test News: rita") {
+		t.Fatalf("expected an empty feed named after rita, got %d", rr.Code)
+	}
+	if rr := getPage(h, "/feed.rss?author_id="+primitive.NewObjectID().Hex(), nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown author, got %d", rr.Code)
+	}
+
+	// The feed changes with its posts, and so does its tag.
+	etag := getPage(h, "/feed.rss", nil).Header().Get("ETag")
+	publish(t, s, &models.Post{Title: "Breaking", Content: "body", Author: "will"})
+	req := httptest.NewRequest(http.MethodGet, "/feed.rss", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Breaking") {
+		t.Fatalf("expected the new feed, got %d", rr.Code)
+	}
+
+	page := getPage(h, "/web/posts", nil).Body.String()
+	if !strings.Contains(page, `rel="alternate" type="application/atom+xml"`) || !strings.Contains(page, `href="/feed.json"`) {
+		t.Fatalf("expected the feeds to be linked from the page: %s", page)
+	}
+}
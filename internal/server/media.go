@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"test-news/internal/media"
+	"test-news/internal/policy"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadFiles is how many files one request may upload, which the web UI
+// does when a post is created with its hero image and inline media.
+const maxUploadFiles = 10
+
+// multipartOverhead leaves room for the form fields and boundaries around the
+// files of a multipart body.
+const multipartOverhead = 1 << 20
+
+// mediaResponse is the answer of POST /api/media.
+type mediaResponse struct {
+	models.Media
+	URL string `json:"url"`
+}
+
+// maxBodyBytes bounds the body of the requests that don't upload files.
+const maxBodyBytes = 1 << 20
+
+// limitBody caps the size of every request body before any middleware reads
+// it. Most routes take at most maxBodyBytes, and the ones that upload files
+// have their own limit, looked up by route.
+func (s *Server) limitBody() gin.HandlerFunc {
+	limits := map[string]int64{
+		"/api/media":         s.media.MaxBytes() + multipartOverhead,
+		"/web/upload/submit": s.media.MaxBytes()*maxUploadFiles + multipartOverhead,
+	}
+	return func(c *gin.Context) {
+		if c.Request.Body != nil {
+			limit, ok := limits[c.FullPath()]
+			if !ok {
+				limit = maxBodyBytes
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
+
+// UploadMediaHandler stores the file sent in the "file" field of a multipart
+// form. The returned key is what posts use to refer to it.
+func (s *Server) UploadMediaHandler(c *gin.Context) {
+	if !authorize(c, "Failed to upload media", policy.CreatePost, nil) {
+		return
+	}
+
+	// The body is limited to a single upload by limitBody.
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, "Failed to upload media", media.ErrTooLarge)
+			return
+		}
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidInput, "Invalid input",
+			"The request must be a multipart form with the file in the \"file\" field"))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		abortWithError(c, "Failed to upload media", err)
+		return
+	}
+	defer file.Close()
+
+	m, err := s.media.Upload(c.Request.Context(), file)
+	if err != nil {
+		abortWithError(c, "Failed to upload media", err)
+		return
+	}
+	m.Alt = c.PostForm("alt")
+	m.Caption = c.PostForm("caption")
+
+	c.JSON(http.StatusCreated, mediaResponse{Media: m, URL: m.URL()})
+}
+
+// ServeMediaHandler serves an uploaded file.
+func (s *Server) ServeMediaHandler(c *gin.Context) {
+	key := c.Param("key")
+	file, err := s.media.Open(c.Request.Context(), key)
+	if err != nil {
+		abortWithError(c, "Failed to retrieve media", err)
+		return
+	}
+	defer file.Close()
+
+	serveMedia(c, key, file)
+}
+
+// ServeMediaVariantHandler serves a resized variant of an uploaded image,
+// making it on the first request.
+func (s *Server) ServeMediaVariantHandler(c *gin.Context) {
+	file, key, err := s.media.OpenVariant(c.Request.Context(), c.Param("key"), c.Param("variant"))
+	if errors.Is(err, media.ErrNoVariants) {
+		err = media.ErrNotFound
+	}
+	if err != nil {
+		abortWithError(c, "Failed to retrieve media", err)
+		return
+	}
+	defer file.Close()
+
+	serveMedia(c, key, file)
+}
+
+// serveMedia writes the file stored under key. A key names the bytes of its
+// file, so the response never changes and caches may keep it for good.
+func serveMedia(c *gin.Context, key string, file io.ReadSeeker) {
+	c.Header("Content-Type", media.ContentType(key))
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", strconv.Quote(key))
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, file)
+}
+
+// resolvePostMedia checks that the media a client refers to were uploaded,
+// reporting the field that names one that wasn't.
+func (s *Server) resolvePostMedia(ctx context.Context, hero *models.Media, inline []models.Media) error {
+	if hero != nil {
+		if err := s.resolveMedia(ctx, "hero_image", hero); err != nil {
+			return err
+		}
+	}
+	for i := range inline {
+		if err := s.resolveMedia(ctx, "media", &inline[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) resolveMedia(ctx context.Context, field string, m *models.Media) error {
+	err := s.media.Resolve(ctx, m)
+	if errors.Is(err, media.ErrInvalidKey) || errors.Is(err, media.ErrNotFound) {
+		return &database.ValidationError{Field: field, Message: "must name an uploaded file"}
+	}
+	return err
+}
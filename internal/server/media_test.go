@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// multipartBody returns a form holding each file under its field, and the
+// content type to send it with.
+func multipartBody(t *testing.T, fields map[string]string, files map[string][]byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	for field, data := range files {
+		part, err := w.CreateFormFile(field, field+".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, w.FormDataContentType()
+}
+
+func uploadMedia(t *testing.T, h http.Handler, token string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	body, contentType := multipartBody(t, map[string]string{"alt": "A square"}, map[string][]byte{"file": data})
+	req := httptest.NewRequest(http.MethodPost, "/api/media", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(req, token))
+	return rr
+}
+
+func TestMediaHandlers(t *testing.T) {
+	_, h, tk := newTestServer()
+	data := testPNG(t)
+
+	rr := uploadMedia(t, h, tk.writer, data)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var uploaded mediaResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.ContentType != "image/png" || uploaded.Alt != "A square" || uploaded.URL != "/media/"+uploaded.Key {
+		t.Fatalf("unexpected upload %+v", uploaded)
+	}
+
+	for name, tc := range map[string]struct {
+		token string
+		data  []byte
+		want  int
+	}{
+		"reader":    {tk.reader, data, http.StatusForbidden},
+		"html":      {tk.writer, []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType},
+		"too large": {tk.writer, append(data, make([]byte, 1<<20)...), http.StatusRequestEntityTooLarge},
+	} {
+		if rr := uploadMedia(t, h, tc.token, tc.data); rr.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", name, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = getPage(h, uploaded.URL, nil)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Fatalf("expected the uploaded file, got %d", rr.Code)
+	}
+	if rr.Header().Get("Content-Type") != "image/png" || !strings.Contains(rr.Header().Get("Cache-Control"), "immutable") {
+		t.Fatalf("unexpected headers %v", rr.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, uploaded.URL, nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for a cached file, got %d", rr.Code)
+	}
+
+	for _, target := range []string{"/media/" + strings.Repeat("0", 64) + ".png", "/media/..%2f..%2fgo.mod"} {
+		if rr := getPage(h, target, nil); rr.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestMediaVariantHandler(t *testing.T) {
+	_, h, tk := newTestServer()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 640, 320))); err != nil {
+		t.Fatal(err)
+	}
+	var uploaded mediaResponse
+	if err := json.Unmarshal(uploadMedia(t, h, tk.writer, buf.Bytes()).Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.Width != 640 || uploaded.Height != 320 {
+		t.Fatalf("expected the size of the image, got %dx%d", uploaded.Width, uploaded.Height)
+	}
+
+	for i := 0; i < 2; i++ {
+		rr := getPage(h, uploaded.VariantURL("thumb"), nil)
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" {
+			t.Fatalf("expected the thumbnail, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(rr.Header().Get("Cache-Control"), "immutable") {
+			t.Fatalf("expected the thumbnail to be cached for good, got %q", rr.Header().Get("Cache-Control"))
+		}
+		thumb, err := png.DecodeConfig(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if thumb.Width != 160 || thumb.Height != 80 {
+			t.Fatalf("expected a 160x80 thumbnail, got %dx%d", thumb.Width, thumb.Height)
+		}
+	}
+
+	for _, target := range []string{uploaded.VariantURL("huge"), uploaded.URL + "/../thumb"} {
+		if rr := getPage(h, target, nil); rr.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestPostMediaHandlers(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	rr := uploadMedia(t, h, tk.writer, testPNG(t))
+	var uploaded mediaResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"title": "Pictured", "content": "body", "hero_image": {"key": "` + uploaded.Key + `", "alt": "The harbour"}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(req, tk.writer))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	page, err := s.db.ListPosts(context.Background(), database.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := page.Posts[0]
+	if post.HeroImage == nil || post.HeroImage.ContentType != "image/png" || post.HeroImage.Alt != "The harbour" {
+		t.Fatalf("expected the hero image to be stored, got %+v", post.HeroImage)
+	}
+
+	body = `{"title": "Pictured", "content": "body", "media": [{"key": "` + strings.Repeat("0", 64) + `.png"}]}`
+	req = httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(req, tk.writer))
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), `"field":"media"`) {
+		t.Fatalf("expected 422 for media that was never uploaded, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	patch := `{"hero_image": null, "media": [{"key": "` + uploaded.Key + `", "caption": "Again"}]}`
+	req = httptest.NewRequest(http.MethodPatch, "/api/posts/"+post.ID.Hex(), strings.NewReader(patch))
+	req.Header.Set("Content-Type", mergePatchContentType)
+	req.Header.Set("If-Match", postETag(post))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(req, tk.writer))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	patched, err := s.db.GetPost(context.Background(), post.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.HeroImage != nil || len(patched.Media) != 1 || patched.Media[0].Caption != "Again" {
+		t.Fatalf("expected the patch to replace the media, got %+v", patched)
+	}
+
+	if _, err := s.db.TransitionPost(context.Background(), post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusPublished}); err != nil {
+		t.Fatal(err)
+	}
+	rr = getPage(h, "/web/posts/"+post.ID.Hex(), nil)
+	if !strings.Contains(rr.Body.String(), uploaded.URL+"/thumb 8w") || !strings.Contains(rr.Body.String(), "Again") {
+		t.Fatalf("expected the post page to show the media: %s", rr.Body.String())
+	}
+}
+
+func TestWebUploadWithHeroImage(t *testing.T) {
+	s, h, _ := newTestServer()
+	cookie := login(t, h, "will")
+	token := csrfFrom(t, h, cookie)
+
+	fields := map[string]string{"title": "Pictured", "content": "body", "hero_alt": "The harbour"}
+	upload := func(csrfHeader string) *httptest.ResponseRecorder {
+		body, contentType := multipartBody(t, fields, map[string][]byte{"hero_image": testPNG(t)})
+		req := httptest.NewRequest(http.MethodPost, "/web/upload/submit", body)
+		req.Header.Set("Content-Type", contentType)
+		if csrfHeader != "" {
+			req.Header.Set("X-CSRF-Token", csrfHeader)
+		}
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// A multipart body isn't parsed for the token, htmx sends it in the
+	// header.
+	fields["csrf_token"] = token
+	if rr := upload(""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for the token in a multipart field, got %d", rr.Code)
+	}
+	delete(fields, "csrf_token")
+
+	rr := upload(token)
+	if !strings.Contains(rr.Body.String(), "Draft saved!") {
+		t.Fatalf("expected the post to be saved: %s", rr.Body.String())
+	}
+
+	page, err := s.db.ListPosts(context.Background(), database.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := page.Posts[0]
+	if post.HeroImage == nil || post.HeroImage.Alt != "The harbour" {
+		t.Fatalf("expected a hero image, got %+v", post.HeroImage)
+	}
+
+	if _, err := s.db.TransitionPost(context.Background(), post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusPublished}); err != nil {
+		t.Fatal(err)
+	}
+	rr = getPage(h, "/web/posts/"+post.ID.Hex(), nil)
+	if !strings.Contains(rr.Body.String(), `src="`+post.HeroImage.VariantURL("card")+`"`) || !strings.Contains(rr.Body.String(), `alt="The harbour"`) {
+		t.Fatalf("expected the post page to show the hero image: %s", rr.Body.String())
+	}
+
+	body, contentType := multipartBody(t,
+		map[string]string{"title": "Scripted", "content": "body"},
+		map[string][]byte{"media": []byte("<script>alert(1)</script>")})
+	req := httptest.NewRequest(http.MethodPost, "/web/upload/submit", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-CSRF-Token", token)
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "can be uploaded") {
+		t.Fatalf("expected the file to be refused: %s", rr.Body.String())
+	}
+}
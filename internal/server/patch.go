@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// errMalformedPatch is returned for bodies that are not a JSON object.
+var errMalformedPatch = errors.New("merge patch must be a JSON object")
+
+// readOnlyFields are part of a post but managed by the server. The author
+// always comes from the account that created the post.
+var readOnlyFields = map[string]bool{
+	"id": true, "created_at": true, "updated_at": true, "version": true, "status": true,
+	"author": true, "author_id": true,
+}
+
+// decodeMergePatch reads a JSON Merge Patch document for a post. The title
+// and content are required, so removing one with null is rejected,
+// as are read-only and unknown fields. The media of a post are replaced as
+// a whole rather than merged.
+func decodeMergePatch(body io.Reader) (database.PostPatch, error) {
+	var patch database.PostPatch
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&doc); err != nil || doc == nil {
+		return patch, errMalformedPatch
+	}
+
+	for field, raw := range doc {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		// The media of a post are optional, so null removes them.
+		switch field {
+		case "hero_image":
+			if isNull {
+				patch.RemoveHeroImage = true
+				continue
+			}
+			var hero models.Media
+			if err := json.Unmarshal(raw, &hero); err != nil {
+				return patch, &database.ValidationError{Field: field, Message: "must be an object"}
+			}
+			patch.HeroImage = &hero
+			continue
+		case "media":
+			media := []models.Media{}
+			if !isNull {
+				if err := json.Unmarshal(raw, &media); err != nil {
+					return patch, &database.ValidationError{Field: field, Message: "must be an array of objects"}
+				}
+			}
+			patch.Media = &media
+			continue
+		}
+
+		var target **string
+		switch field {
+		case "title":
+			target = &patch.Title
+		case "content":
+			target = &patch.Content
+		default:
+			if readOnlyFields[field] {
+				return patch, &database.ValidationError{Field: field, Message: "is read-only"}
+			}
+			return patch, &database.ValidationError{Field: field, Message: "is not a known field"}
+		}
+
+		if isNull {
+			return patch, &database.ValidationError{Field: field, Message: "is required and cannot be removed"}
+		}
+
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return patch, &database.ValidationError{Field: field, Message: "must be a string"}
+		}
+		*target = &value
+	}
+
+	return patch, nil
+}
+
+// abortWithPatchError reports a merge patch that could not be decoded.
+func abortWithPatchError(c *gin.Context, err error) {
+	if errors.Is(err, errMalformedPatch) {
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidInput, "Invalid input", "The request body must be a JSON object"))
+		return
+	}
+	abortWithError(c, "Invalid input", err)
+}
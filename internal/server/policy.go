@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"test-news/internal/database/models"
+	"test-news/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorize checks the policy for act, aborting with a 403 that carries the
+// reason when it refuses.
+func authorize(c *gin.Context, title string, act policy.Action, post *models.Post) bool {
+	return enforce(c, title, policy.Decide(principalFrom(c), act, post))
+}
+
+// enforce aborts with a 403 when err is a refusal of the policy.
+func enforce(c *gin.Context, title string, err error) bool {
+	if err != nil {
+		abortWithProblem(c, newProblem(http.StatusForbidden, codeForbidden, title, err.Error()))
+		return false
+	}
+	return true
+}
+
+// authorizePost loads the post named by the :id parameter and checks that
+// the caller may perform act on it.
+func (s *Server) authorizePost(c *gin.Context, title string, act policy.Action) (*models.Post, bool) {
+	post, ok := s.postFromParam(c, title)
+	if !ok || !authorize(c, title, act, post) {
+		return nil, false
+	}
+	return post, true
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-news/internal/database/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPostPolicy(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	own := &models.Post{Title: "Mine", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	if err := s.db.CreatePost(context.Background(), own); err != nil {
+		t.Fatal(err)
+	}
+	other := &models.Post{Title: "Theirs", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")}
+	publish(t, s, other)
+	live := &models.Post{Title: "Mine and out", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	publish(t, s, live)
+
+	patch := func(post *models.Post, token string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPatch, "/api/posts/"+post.ID.Hex(), strings.NewReader(`{"title":"Edited"}`)), token)
+		req.Header.Set("Content-Type", mergePatchContentType)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := patch(other, tk.writer)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a writer editing another's post, got %d", rr.Code)
+	}
+	var p Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeForbidden || p.Detail != "Writers may only edit posts they wrote themselves" {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	if rr := patch(own, tk.writer); rr.Code != http.StatusOK {
+		t.Fatalf("expected a writer to edit their own draft, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// What is public changes only through a review, so a writer can't edit
+	// their post once it is out, by PATCH or by PUT.
+	if rr := patch(live, tk.writer); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "Writers may only edit drafts") {
+		t.Fatalf("expected 403 for a writer patching their published post, got %d: %s", rr.Code, rr.Body.String())
+	}
+	req := withToken(httptest.NewRequest(http.MethodPut, "/api/posts/"+live.ID.Hex(), strings.NewReader(`{"title":"Edited","content":"body"}`)), tk.writer)
+	req.Header.Set("If-Match", "*")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a writer replacing their published post, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := patch(live, tk.editor); rr.Code != http.StatusOK {
+		t.Fatalf("expected an editor to edit a published post, got %d", rr.Code)
+	}
+	if rr := patch(live, tk.reader); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a reader, got %d", rr.Code)
+	}
+	if rr := patch(own, tk.editor); rr.Code != http.StatusOK {
+		t.Fatalf("expected an editor to edit anyone's post, got %d", rr.Code)
+	}
+
+	req = withToken(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{"title":"t","content":"c"}`)), tk.reader)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a reader creating a post, got %d", rr.Code)
+	}
+
+	// A writer may take their own post out of the trash, but not another's.
+	do := func(method, url, token string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, withToken(httptest.NewRequest(method, url, nil), token))
+		return rr.Code
+	}
+	if code := do(http.MethodDelete, "/api/posts/"+other.ID.Hex(), tk.writer); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for deleting another's post, got %d", code)
+	}
+	for _, post := range []*models.Post{own, other} {
+		if code := do(http.MethodDelete, "/api/posts/"+post.ID.Hex(), tk.editor); code != http.StatusOK {
+			t.Fatalf("delete returned %d", code)
+		}
+	}
+	if code := do(http.MethodPost, "/api/posts/"+other.ID.Hex()+"/restore", tk.writer); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for restoring another's post, got %d", code)
+	}
+	if code := do(http.MethodPost, "/api/posts/"+own.ID.Hex()+"/restore", tk.writer); code != http.StatusOK {
+		t.Fatalf("expected a writer to restore their own post, got %d", code)
+	}
+}
+
+func TestPostVisibility(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	own := &models.Post{Title: "Will's draft", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	other := &models.Post{Title: "Erin's draft", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")}
+	for _, post := range []*models.Post{own, other} {
+		if err := s.db.CreatePost(context.Background(), post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(t, s, &models.Post{Title: "Out now", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")})
+
+	get := func(url, token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, url, nil), token))
+		return rr
+	}
+
+	// Readers get the public view, writers also see their own drafts and
+	// editors see everything.
+	for token, want := range map[string][]string{
+		tk.reader: {"Out now"},
+		tk.writer: {"Out now", "Will's draft"},
+		tk.editor: {"Out now", "Will's draft", "Erin's draft"},
+	} {
+		body := get("/api/posts", token).Body.String()
+		if n := strings.Count(body, `"title"`); n != len(want) {
+			t.Fatalf("expected %d posts, got %d: %s", len(want), n, body)
+		}
+		for _, title := range want {
+			if !strings.Contains(body, title) {
+				t.Fatalf("expected %q in the list: %s", title, body)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		post  *models.Post
+		token string
+		code  int
+	}{
+		{other, tk.reader, http.StatusNotFound},
+		{other, tk.writer, http.StatusNotFound},
+		{own, tk.writer, http.StatusOK},
+		{other, tk.editor, http.StatusOK},
+	} {
+		if rr := get("/api/posts/"+tt.post.ID.Hex(), tt.token); rr.Code != tt.code {
+			t.Fatalf("%s: expected %d, got %d", tt.post.Title, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestSetUserRoleHandler(t *testing.T) {
+	s, h, tk := newTestServer()
+	will := userID(t, s, "will").Hex()
+	ada := userID(t, s, "ada").Hex()
+
+	setRole := func(id string, token, role string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPut, "/api/users/"+id+"/role", strings.NewReader(`{"role":"`+role+`"}`)), token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := setRole(will, tk.editor, "editor"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an editor, got %d", rr.Code)
+	}
+	if rr := setRole(ada, tk.admin, "writer"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an admin demoting themselves, got %d", rr.Code)
+	}
+	if rr := setRole(strings.ToUpper(ada), tk.admin, "writer"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an admin demoting themselves by an uppercase ID, got %d", rr.Code)
+	}
+	if rr := setRole("nope", tk.admin, "editor"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid ID, got %d", rr.Code)
+	}
+	if rr := setRole(will, tk.admin, "chief"); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unknown role, got %d", rr.Code)
+	}
+	if rr := setRole(primitive.NewObjectID().Hex(), tk.admin, "editor"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown user, got %d", rr.Code)
+	}
+
+	rr := setRole(will, tk.admin, "editor")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("set role returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var user models.User
+	if err := json.Unmarshal(rr.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "will" || user.Role != models.RoleEditor {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, "/api/users", nil), tk.admin))
+	var list struct {
+		Data  []models.User `json:"data"`
+		Count int           `json:"count"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Count != 4 || list.Data[0].Username != "ada" {
+		t.Fatalf("unexpected users: %+v", list)
+	}
+}
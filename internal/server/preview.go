@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"test-news/cmd/web"
+	"test-news/internal/markdown"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewRequest is the body of POST /api/preview, sent as JSON or as the
+// fields of the form being written.
+type previewRequest struct {
+	Content string `json:"content" form:"content"`
+}
+
+// previewResponse is the JSON answer of POST /api/preview.
+type previewResponse struct {
+	HTML string `json:"html"`
+}
+
+// PreviewHandler renders Markdown the way a post would show it, without
+// storing anything, for the signed-in members writing posts. Its body is
+// limited like any other, see limitBody. htmx gets an HTML fragment to swap into the page, other
+// clients get the sanitized HTML as JSON.
+func (s *Server) PreviewHandler(c *gin.Context) {
+	var req previewRequest
+	if err := c.ShouldBind(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithProblem(c, newProblem(http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Failed to render preview",
+				"The content is too long to preview"))
+			return
+		}
+		abortWithBindError(c, err)
+		return
+	}
+
+	html, err := markdown.Render(req.Content)
+	if err != nil {
+		abortWithError(c, "Failed to render preview", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		web.Preview(html).Render(c.Request.Context(), c.Writer)
+		return
+	}
+	c.JSON(http.StatusOK, previewResponse{HTML: html})
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+func TestPreviewHandler(t *testing.T) {
+	_, h, tk := newTestServer()
+
+	body := `{"content": "# Title\n\nSome **bold** text <script>alert(1)</script>"}`
+	preview := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/preview", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			withToken(req, token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Only those writing posts need a preview.
+	if rr := preview(""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an anonymous preview, got %d", rr.Code)
+	}
+
+	rr := preview(tk.writer)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected the preview not to be cached, got %q", rr.Header().Get("Cache-Control"))
+	}
+	var res previewResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res.HTML, "<h1>Title</h1>") || !strings.Contains(res.HTML, "<strong>bold</strong>") {
+		t.Fatalf("expected rendered Markdown, got %q", res.HTML)
+	}
+	if strings.Contains(res.HTML, "<script") {
+		t.Fatalf("expected the script to be stripped, got %q", res.HTML)
+	}
+
+	// The pages send their form through htmx and get a fragment back, which
+	// needs the CSRF token of the session like any other form.
+	cookie := login(t, h, "will")
+	token := csrfFrom(t, h, cookie)
+	form := url.Values{"csrf_token": {token}, "content": {"_draft_"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/preview", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "<em>draft</em>") {
+		t.Fatalf("expected a preview fragment, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "<html") {
+		t.Fatalf("expected a fragment rather than a page: %s", rr.Body.String())
+	}
+
+	form.Del("csrf_token")
+	if rr := postForm(h, "/api/preview", form, cookie); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected a preview without the CSRF token to be refused, got %d", rr.Code)
+	}
+
+	// The body is limited like any other, before the CSRF token is checked.
+	long := url.Values{"content": {strings.Repeat("a", maxBodyBytes)}}
+	req = httptest.NewRequest(http.MethodPost, "/api/preview", strings.NewReader(long.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-CSRF-Token", token)
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for an oversized preview of a session, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWebPostRendersMarkdown(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	post := &models.Post{
+		Title:    "Formatted",
+		Content:  "Read [the source](https://example.com) *now*.\n\n<img src=x onerror=alert(1)>",
+		Author:   "will",
+		AuthorID: userID(t, s, "will"),
+	}
+	publish(t, s, post)
+
+	rr := getPage(h, "/web/posts/"+post.ID.Hex(), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the post page, got %d", rr.Code)
+	}
+	page := rr.Body.String()
+	if !strings.Contains(page, "<em>now</em>") || !strings.Contains(page, `href="https://example.com"`) {
+		t.Fatalf("expected the content rendered as HTML: %s", page)
+	}
+	if strings.Contains(page, "onerror") || strings.Contains(page, "<img") {
+		t.Fatalf("expected raw HTML in the content to be stripped: %s", page)
+	}
+
+	// The list shows an excerpt of the text without the markup.
+	rr = getPage(h, "/api/posts/list", nil)
+	if !strings.Contains(rr.Body.String(), "Read the source now.") {
+		t.Fatalf("expected a plain text excerpt in the list: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/media"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Stable, machine readable error codes. Clients should switch on these
+// rather than on the human readable title or detail.
+const (
+	codeInvalidInput         = "invalid_input"
+	codeInvalidQuery         = "invalid_query"
+	codeValidationFailed     = "validation_failed"
+	codeInvalidID            = "invalid_id"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codeInvalidTransition    = "invalid_transition"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codePayloadTooLarge      = "payload_too_large"
+	codeRateLimited          = "rate_limited"
+	codeInternal             = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details document. Every error returned by
+// the JSON API uses this shape with the application/problem+json media type.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Code     string       `json:"code"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError points at a single invalid field of the request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func newProblem(status int, code string, title string, detail string) Problem {
+	return Problem{
+		Type:   "/problems/" + code,
+		Title:  title,
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// abortWithProblem writes p as the response body and stops the handler chain.
+func abortWithProblem(c *gin.Context, p Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// abortWithError maps an error coming out of database.Service onto a problem.
+// Anything that is not one of the documented database errors is logged and
+// reported as a generic internal error, so driver messages never leak.
+func abortWithError(c *gin.Context, title string, err error) {
+	var verr *database.ValidationError
+
+	switch {
+	case errors.Is(err, database.ErrInvalidID):
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidID, title, "The ID is not a valid post ID"))
+	case errors.Is(err, database.ErrNotFound):
+		abortWithProblem(c, newProblem(http.StatusNotFound, codeNotFound, title, notFoundDetail(err)))
+	case errors.Is(err, database.ErrVersionMismatch):
+		abortWithProblem(c, newProblem(http.StatusPreconditionFailed, codePreconditionFailed, title,
+			"The post was changed since you read it, fetch it again and reapply your changes"))
+	case errors.Is(err, database.ErrUsernameTaken):
+		abortWithProblem(c, newProblem(http.StatusConflict, codeConflict, title, "The username is already taken"))
+	case errors.Is(err, database.ErrInvalidTransition):
+		abortWithProblem(c, newProblem(http.StatusConflict, codeInvalidTransition, title, "The workflow doesn't allow this status change from the current status"))
+	case errors.Is(err, database.ErrConflict):
+		abortWithProblem(c, newProblem(http.StatusConflict, codeConflict, title, "The request conflicts with the current state of the post"))
+	case errors.As(err, &verr):
+		p := newProblem(http.StatusUnprocessableEntity, codeValidationFailed, title, "One or more fields are invalid")
+		p.Errors = []FieldError{{Field: verr.Field, Message: verr.Message}}
+		abortWithProblem(c, p)
+	case errors.Is(err, media.ErrNotFound), errors.Is(err, media.ErrInvalidKey):
+		abortWithProblem(c, newProblem(http.StatusNotFound, codeNotFound, title, "The file does not exist"))
+	case errors.Is(err, media.ErrTooLarge):
+		abortWithProblem(c, newProblem(http.StatusRequestEntityTooLarge, codePayloadTooLarge, title, "The file is larger than the upload limit"))
+	case errors.Is(err, media.ErrUnsupportedType):
+		abortWithProblem(c, newProblem(http.StatusUnsupportedMediaType, codeUnsupportedMediaType, title,
+			"Only JPEG, PNG, GIF and WebP images and MP4 and WebM videos can be uploaded"))
+	default:
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		abortWithProblem(c, newProblem(http.StatusInternalServerError, codeInternal, title, "An unexpected error occurred"))
+	}
+}
+
+// notFoundDetail names what was not found for a database.ErrNotFound.
+func notFoundDetail(err error) string {
+	if errors.Is(err, database.ErrRevisionNotFound) {
+		return "The revision does not exist"
+	}
+	if errors.Is(err, database.ErrUserNotFound) {
+		return "The user does not exist"
+	}
+	if errors.Is(err, database.ErrAPIKeyNotFound) {
+		return "The API key does not exist"
+	}
+	return "The post does not exist"
+}
+
+// abortWithQueryError is abortWithError for list endpoints, where a failed
+// validation means the query string was wrong and is reported as a 400.
+func abortWithQueryError(c *gin.Context, title string, err error) {
+	var verr *database.ValidationError
+	if errors.As(err, &verr) {
+		p := newProblem(http.StatusBadRequest, codeInvalidQuery, title, "One or more query parameters are invalid")
+		p.Errors = []FieldError{{Field: verr.Field, Message: verr.Message}}
+		abortWithProblem(c, p)
+		return
+	}
+
+	abortWithError(c, title, err)
+}
+
+// abortWithBindError reports a request body that could not be bound, listing
+// the offending fields when the failure came from binding tags.
+func abortWithBindError(c *gin.Context, err error) {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		p := newProblem(http.StatusUnprocessableEntity, codeValidationFailed, "Invalid input", "One or more fields are invalid")
+		for _, fe := range verrs {
+			p.Errors = append(p.Errors, FieldError{Field: jsonFieldName(fe.Field()), Message: "failed on the '" + fe.Tag() + "' rule"})
+		}
+		abortWithProblem(c, p)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortWithProblem(c, newProblem(http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Invalid input", "The request body is larger than this endpoint accepts"))
+		return
+	}
+
+	abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidInput, "Invalid input", "The request body is not valid JSON for this resource"))
+}
+
+// jsonFieldName turns a Go struct field name such as CreatedAt into the
+// snake_case name used in the JSON body.
+func jsonFieldName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
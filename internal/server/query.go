@@ -0,0 +1,178 @@
+package server
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"time"
+)
+
+// listOptionsFromQuery parses the query language of GET /api/posts:
+//
+//	limit=20                       page size
+//	cursor=...                     cursor from a previous page
+//	count=true                     include the total number of matches
+//	sort=-created_at               created_at, updated_at or title; a leading
+//	                               "-" sorts descending
+//	author=Jane                    exact author, also author[eq]=
+//	title[prefix]=Break            title prefix, ignoring case
+//	created_at[gte]=2024-01-01     gt, gte, lt or lte against an RFC 3339
+//	updated_at[lt]=2024-02-01T...  timestamp or a plain date
+//	status=draft                   exact status, also status[in]=draft,in_review
+//
+// Unknown parameters, unknown operators and repeated parameters are rejected.
+func listOptionsFromQuery(values url.Values) (database.ListOptions, error) {
+	var opts database.ListOptions
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if len(values[key]) > 1 {
+			return opts, &database.ValidationError{Field: key, Message: "must be given at most once"}
+		}
+		value := values[key][0]
+
+		field, op, err := splitQueryKey(key)
+		if err != nil {
+			return opts, err
+		}
+
+		switch field {
+		case "limit":
+			if op != "" {
+				return opts, unknownOperator(key)
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return opts, &database.ValidationError{Field: key, Message: "must be a positive integer"}
+			}
+			opts.Limit = n
+		case "cursor":
+			if op != "" {
+				return opts, unknownOperator(key)
+			}
+			opts.Cursor = value
+		case "count":
+			if op != "" {
+				return opts, unknownOperator(key)
+			}
+			withTotal, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, &database.ValidationError{Field: key, Message: "must be true or false"}
+			}
+			opts.WithTotal = withTotal
+		case "sort":
+			if op != "" {
+				return opts, unknownOperator(key)
+			}
+			opts.Sort = database.Sort{Field: database.SortField(strings.TrimPrefix(value, "-")), Asc: !strings.HasPrefix(value, "-")}
+			if err := opts.Sort.Validate(); err != nil {
+				return opts, err
+			}
+		case "author":
+			if op != "" && op != "eq" {
+				return opts, unknownOperator(key)
+			}
+			opts.Filter.Author = value
+		case "title":
+			if op != "prefix" {
+				return opts, unknownOperator(key)
+			}
+			opts.Filter.TitlePrefix = value
+		case "status":
+			switch op {
+			case "", "eq":
+				opts.Filter.Status = []models.PostStatus{models.PostStatus(value)}
+			case "in":
+				for _, status := range strings.Split(value, ",") {
+					opts.Filter.Status = append(opts.Filter.Status, models.PostStatus(status))
+				}
+			default:
+				return opts, unknownOperator(key)
+			}
+			if err := opts.Filter.Validate(); err != nil {
+				return opts, err
+			}
+		case "created_at", "updated_at":
+			bound, err := timeBound(key, op, value)
+			if err != nil {
+				return opts, err
+			}
+			if field == "created_at" {
+				opts.Filter.Created = append(opts.Filter.Created, bound)
+			} else {
+				opts.Filter.Updated = append(opts.Filter.Updated, bound)
+			}
+		default:
+			return opts, &database.ValidationError{Field: key, Message: "is not a known parameter"}
+		}
+	}
+
+	return opts, nil
+}
+
+// searchFromQuery parses the q and limit parameters of the search endpoint.
+func searchFromQuery(values url.Values) (string, int, error) {
+	var limit int
+	for key, vals := range values {
+		if len(vals) > 1 {
+			return "", 0, &database.ValidationError{Field: key, Message: "must be given at most once"}
+		}
+		switch key {
+		case "q":
+		case "limit":
+			n, err := strconv.Atoi(vals[0])
+			if err != nil || n < 1 {
+				return "", 0, &database.ValidationError{Field: key, Message: "must be a positive integer"}
+			}
+			limit = n
+		default:
+			return "", 0, &database.ValidationError{Field: key, Message: "is not a known parameter"}
+		}
+	}
+
+	return values.Get("q"), limit, nil
+}
+
+// splitQueryKey splits "created_at[gte]" into its field and operator.
+func splitQueryKey(key string) (field string, op string, err error) {
+	open := strings.IndexByte(key, '[')
+	if open < 0 {
+		return key, "", nil
+	}
+	if !strings.HasSuffix(key, "]") || open == 0 {
+		return "", "", &database.ValidationError{Field: key, Message: "is not a known parameter"}
+	}
+	return key[:open], key[open+1 : len(key)-1], nil
+}
+
+func timeBound(key string, op string, value string) (database.TimeBound, error) {
+	bound := database.TimeBound{Op: database.RangeOp(op)}
+	switch bound.Op {
+	case database.OpGT, database.OpGTE, database.OpLT, database.OpLTE:
+	default:
+		return bound, unknownOperator(key)
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+	}
+	if err != nil {
+		return bound, &database.ValidationError{Field: key, Message: "must be an RFC 3339 timestamp or a YYYY-MM-DD date"}
+	}
+	bound.Value = t
+
+	return bound, nil
+}
+
+func unknownOperator(key string) error {
+	return &database.ValidationError{Field: key, Message: "uses an unknown operator"}
+}
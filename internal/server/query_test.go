@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"testing"
+	"time"
+)
+
+func TestListOptionsFromQuery(t *testing.T) {
+	values, _ := url.ParseQuery("author=Jane&title[prefix]=Break&created_at[gte]=2024-01-01&updated_at[lt]=2024-02-01T10:00:00Z&sort=-title&limit=5&count=true")
+
+	opts, err := listOptionsFromQuery(values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.Filter.Author != "Jane" || opts.Filter.TitlePrefix != "Break" {
+		t.Fatalf("unexpected filter: %+v", opts.Filter)
+	}
+	if len(opts.Filter.Created) != 1 || opts.Filter.Created[0].Op != database.OpGTE ||
+		!opts.Filter.Created[0].Value.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected created_at bounds: %+v", opts.Filter.Created)
+	}
+	if len(opts.Filter.Updated) != 1 || opts.Filter.Updated[0].Op != database.OpLT {
+		t.Fatalf("unexpected updated_at bounds: %+v", opts.Filter.Updated)
+	}
+	if opts.Sort != (database.Sort{Field: database.SortTitle}) {
+		t.Fatalf("unexpected sort: %+v", opts.Sort)
+	}
+	if opts.Limit != 5 || !opts.WithTotal {
+		t.Fatalf("unexpected paging: %+v", opts)
+	}
+
+	values, _ = url.ParseQuery("status[in]=draft,in_review")
+	opts, err = listOptionsFromQuery(values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts.Filter.Status) != 2 || opts.Filter.Status[0] != models.StatusDraft || opts.Filter.Status[1] != models.StatusInReview {
+		t.Fatalf("unexpected status filter: %+v", opts.Filter.Status)
+	}
+}
+
+func TestListOptionsFromQueryRejects(t *testing.T) {
+	for _, query := range []string{
+		"colour=red",
+		"author[like]=Jane",
+		"title=Breaking",
+		"title[suffix]=news",
+		"created_at[between]=2024-01-01",
+		"created_at[gte]=yesterday",
+		"sort=-views",
+		"author=a&author=b",
+		"limit[gt]=5",
+		"[gte]=1",
+		"status=live",
+		"status[in]=draft,live",
+		"status[prefix]=dr",
+	} {
+		values, _ := url.ParseQuery(query)
+		_, err := listOptionsFromQuery(values)
+
+		var verr *database.ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: expected a validation error, got %v", query, err)
+		}
+	}
+}
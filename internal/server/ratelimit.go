@@ -0,0 +1,51 @@
+package server
+
+import (
+	"sync"
+	"test-news/internal/database/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/time/rate"
+)
+
+// keyLimiter enforces the rate limit of every API key with a token bucket
+// per key. Buckets live in process, so each server instance counts on its
+// own.
+type keyLimiter struct {
+	mu sync.Mutex
+	// perMinute applies to keys without a rate limit of their own.
+	perMinute int
+	buckets   map[primitive.ObjectID]*rate.Limiter
+}
+
+func newKeyLimiter(perMinute int) *keyLimiter {
+	return &keyLimiter{
+		perMinute: perMinute,
+		buckets:   make(map[primitive.ObjectID]*rate.Limiter),
+	}
+}
+
+// allow takes a request from the bucket of key at now. When the bucket is
+// empty it reports false and how long until the next request is allowed.
+func (l *keyLimiter) allow(key *models.APIKey, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	bucket, ok := l.buckets[key.ID]
+	if !ok {
+		perMinute := key.RateLimit
+		if perMinute == 0 {
+			perMinute = l.perMinute
+		}
+		// A full minute's worth of requests may come in a burst.
+		bucket = rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), perMinute)
+		l.buckets[key.ID] = bucket
+	}
+	l.mu.Unlock()
+
+	r := bucket.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
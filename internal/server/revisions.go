@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"test-news/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRevisionsHandler returns the saved revisions of a post, newest first.
+// Revisions hold the drafts a post went through, so like the other history
+// endpoints it is limited to those who may read its history, see
+// policy.ReadHistory.
+func (s *Server) ListRevisionsHandler(c *gin.Context) {
+	post, ok := s.authorizePost(c, "Failed to list revisions", policy.ReadHistory)
+	if !ok {
+		return
+	}
+
+	revisions, err := s.db.ListRevisions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		abortWithError(c, "Failed to list revisions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":            revisions,
+		"count":           len(revisions),
+		"current_version": post.Version,
+	})
+}
+
+// GetRevisionHandler returns one saved revision of a post.
+func (s *Server) GetRevisionHandler(c *gin.Context) {
+	version, ok := versionParam(c, c.Param("rev"), "rev")
+	if !ok {
+		return
+	}
+
+	if _, ok := s.authorizePost(c, "Failed to retrieve revision", policy.ReadHistory); !ok {
+		return
+	}
+
+	revision, err := s.db.GetRevision(c.Request.Context(), c.Param("id"), version)
+	if err != nil {
+		abortWithError(c, "Failed to retrieve revision", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffRevisionsHandler returns a unified diff between two versions of a post
+// given as ?from= and ?to=. Either may be the current version.
+func (s *Server) DiffRevisionsHandler(c *gin.Context) {
+	from, ok := versionParam(c, c.Query("from"), "from")
+	if !ok {
+		return
+	}
+	to, ok := versionParam(c, c.Query("to"), "to")
+	if !ok {
+		return
+	}
+
+	post, ok := s.authorizePost(c, "Failed to diff revisions", policy.ReadHistory)
+	if !ok {
+		return
+	}
+
+	diff, err := database.DiffVersions(c.Request.Context(), s.db, post, from, to)
+	if err != nil {
+		abortWithError(c, "Failed to diff revisions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from": from,
+		"to":   to,
+		"diff": diff,
+	})
+}
+
+// RestoreRevisionHandler makes an old revision the current state of a post,
+// its media included. The state it replaces is saved as a revision like with any other update.
+func (s *Server) RestoreRevisionHandler(c *gin.Context) {
+	post, ok := s.authorizePost(c, "Failed to restore revision", policy.EditPost)
+	if !ok {
+		return
+	}
+
+	version, ok := versionParam(c, c.Param("rev"), "rev")
+	if !ok {
+		return
+	}
+
+	current, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	revision, err := s.db.GetRevision(c.Request.Context(), post.ID.Hex(), version)
+	if err != nil {
+		abortWithError(c, "Failed to restore revision", err)
+		return
+	}
+
+	restored, err := s.db.PatchPost(c.Request.Context(), post.ID.Hex(), current, database.PatchFromRevision(revision))
+	if err != nil {
+		abortWithError(c, "Failed to restore revision", err)
+		return
+	}
+
+	c.Header("ETag", postETag(restored))
+	c.JSON(http.StatusOK, restored)
+}
+
+// postFromParam loads the post named by the :id parameter, aborting the
+// request when it can't.
+func (s *Server) postFromParam(c *gin.Context, title string) (*models.Post, bool) {
+	id := c.Param("id")
+
+	// Validate ObjectID format
+	if !isValidObjectID(id) {
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidID, "Invalid post ID format", "The ID is not a valid post ID"))
+		return nil, false
+	}
+
+	post, err := s.db.GetPost(c.Request.Context(), id)
+	if err == nil && !policy.Visible(principalFrom(c), post) {
+		err = database.ErrPostNotFound
+	}
+	if err != nil {
+		abortWithError(c, title, err)
+		return nil, false
+	}
+
+	return post, true
+}
+
+// versionParam parses a post version out of a path or query parameter.
+func versionParam(c *gin.Context, value string, name string) (int64, bool) {
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 1 {
+		abortWithQueryError(c, "Invalid version", &database.ValidationError{Field: name, Message: "must be a positive version number"})
+		return 0, false
+	}
+	return version, true
+}
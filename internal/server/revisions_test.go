@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+func TestRevisionHandlers(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	hero := models.Media{Key: "hero.png", ContentType: "image/png", Alt: "A storm"}
+	post := &models.Post{Title: "Original", Content: "first body", Author: "jane", HeroImage: &hero}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	title := "Edited"
+	media := []models.Media{{Key: "inline.png", ContentType: "image/png", Caption: "Later"}}
+	patch := database.PostPatch{Title: &title, RemoveHeroImage: true, Media: &media}
+	if _, err := s.db.PatchPost(context.Background(), post.ID.Hex(), database.AnyVersion, patch); err != nil {
+		t.Fatal(err)
+	}
+	url := "/api/posts/" + post.ID.Hex() + "/revisions"
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, url, nil), tk.editor))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("list returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var list struct {
+		Data           []models.Revision `json:"data"`
+		CurrentVersion int64             `json:"current_version"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 || list.Data[0].Title != "Original" || list.CurrentVersion != 2 {
+		t.Fatalf("unexpected revisions: %+v", list)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, url+"/diff?from=1&to=2", nil), tk.editor))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("diff returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var diff struct {
+		Diff string `json:"diff"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff.Diff, "-Title: Original\n") || !strings.Contains(diff.Diff, "+Title: Edited\n") {
+		t.Fatalf("unexpected diff:\n%s", diff.Diff)
+	}
+	if !strings.Contains(diff.Diff, "-Hero image: hero.png alt=\"A storm\"\n") || !strings.Contains(diff.Diff, "+Media: inline.png caption=\"Later\"\n") {
+		t.Fatalf("expected the media changes in the diff:\n%s", diff.Diff)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, url+"/diff?from=1&to=x", nil), tk.editor))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad version, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, withToken(httptest.NewRequest(http.MethodGet, url+"/7", nil), tk.editor))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing revision, got %d", rr.Code)
+	}
+
+	restore := func(ifMatch string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPost, url+"/1/restore", nil), tk.editor)
+		req.Header.Set("If-Match", ifMatch)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := restore(`"1"`); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale ETag, got %d", rr.Code)
+	}
+
+	rr = restore(`"2"`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("restore returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var restored models.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "Original" || restored.Version != 3 || rr.Header().Get("ETag") != `"3"` {
+		t.Fatalf("unexpected restored post: %+v", restored)
+	}
+	if restored.HeroImage == nil || *restored.HeroImage != hero || len(restored.Media) != 0 {
+		t.Fatalf("expected the media of the revision back, got %+v", restored)
+	}
+
+	// Restoring is itself an update, so the edited state is kept.
+	revision, err := s.db.GetRevision(context.Background(), post.ID.Hex(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.Title != "Edited" || revision.Editor != "erin" || revision.HeroImage != nil || len(revision.Media) != 1 {
+		t.Fatalf("unexpected revision: %+v", revision)
+	}
+}
+
+func TestRevisionAccess(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	// A published post keeps the drafts it went through in its history.
+	post := &models.Post{Title: "Draft title", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	publish(t, s, post)
+	other := &models.Post{Title: "Theirs", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")}
+	publish(t, s, other)
+
+	get := func(target, token string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			withToken(req, token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	for _, tc := range []struct {
+		name  string
+		post  *models.Post
+		token string
+		want  int
+	}{
+		{"anonymous", post, "", http.StatusUnauthorized},
+		{"reader", post, tk.reader, http.StatusForbidden},
+		{"author", post, tk.writer, http.StatusOK},
+		{"other writer", other, tk.writer, http.StatusForbidden},
+		{"editor", post, tk.editor, http.StatusOK},
+	} {
+		prefix := "/api/posts/" + tc.post.ID.Hex()
+		for _, target := range []string{prefix + "/revisions", prefix + "/revisions/1", prefix + "/revisions/diff?from=1&to=2", prefix + "/transitions"} {
+			if code := get(target, tc.token); code != tc.want {
+				t.Errorf("%s: expected %d for %s, got %d", tc.name, tc.want, target, code)
+			}
+		}
+	}
+
+	// The history pages follow the same rules.
+	history := "/web/posts/" + post.ID.Hex() + "/history"
+	if rr := getPage(h, history, nil); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected anonymous visitors to be sent to sign in, got %d", rr.Code)
+	}
+	for username, want := range map[string]int{"rita": http.StatusForbidden, "will": http.StatusOK, "erin": http.StatusOK} {
+		cookie := login(t, h, username)
+		for _, target := range []string{history, history + "/diff?from=1&to=2"} {
+			if rr := getPage(h, target, cookie); rr.Code != want {
+				t.Errorf("%s: expected %d for %s, got %d", username, want, target, rr.Code)
+			}
+		}
+	}
+}
@@ -18,20 +18,61 @@ func (s *Server) RegisterRoutes() http.Handler {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"}, // Add your frontend URL
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type"},
+		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "If-Match", "If-None-Match", apiKeyHeader, web.CSRFHeader},
+		ExposeHeaders:    []string{"ETag", "Retry-After"},
 		AllowCredentials: true, // Enable cookies/auth
 	}))
 
+	r.Use(s.limitBody(), s.authenticate(), csrfProtect())
+
 	// this is not a concern of duplication
 	// API routes that return JSON
 
 	r.GET("/health", s.healthHandler)
 
+	r.POST("/api/auth/login", s.LoginHandler)
+	r.POST("/api/auth/refresh", s.RefreshHandler)
+	r.GET("/api/auth/me", requireAuth(), s.MeHandler)
+	r.GET("/api/users", requireAuth(), s.ListUsersHandler)
+	r.POST("/api/users", requireAuth(), s.CreateUserHandler)
+	r.PUT("/api/users/:id/role", requireAuth(), s.SetUserRoleHandler)
+
+	r.GET("/api/keys", requireAuth(), s.ListAPIKeysHandler)
+	r.POST("/api/keys", requireAuth(), s.CreateAPIKeyHandler)
+	r.POST("/api/keys/:id/rotate", requireAuth(), s.RotateAPIKeyHandler)
+	r.DELETE("/api/keys/:id", requireAuth(), s.DeleteAPIKeyHandler)
+
 	r.GET("/api/posts", s.GetPostsHandler)
-	r.POST("/api/posts", s.CreatePostHandler)
+	r.GET("/api/posts/search", s.SearchPostsHandler)
+	r.POST("/api/posts", requireAuth(), s.CreatePostHandler)
 	r.GET("/api/posts/:id", s.GetPostHandler)
-	r.PUT("/api/posts/:id", s.UpdatePostHandler)
-	r.DELETE("/api/posts/:id", s.DeletePostHandler)
+	r.PUT("/api/posts/:id", requireAuth(), s.UpdatePostHandler)
+	r.PATCH("/api/posts/:id", requireAuth(), s.PatchPostHandler)
+	r.DELETE("/api/posts/:id", requireAuth(), s.DeletePostHandler)
+	r.POST("/api/posts/:id/restore", requireAuth(), s.RestorePostHandler)
+	r.GET("/api/trash", requireAuth(), s.GetTrashHandler)
+
+	r.POST("/api/posts/:id/status", requireAuth(), s.TransitionPostHandler)
+	r.GET("/api/posts/:id/transitions", requireAuth(), s.ListTransitionsHandler)
+
+	r.POST("/api/preview", requireAuth(), s.PreviewHandler)
+
+	r.POST("/api/media", requireAuth(), s.UploadMediaHandler)
+	r.GET("/media/:key", s.ServeMediaHandler)
+	r.GET("/media/:key/:variant", s.ServeMediaVariantHandler)
+
+	r.GET("/feed.rss", s.RSSFeedHandler)
+	r.GET("/feed.atom", s.AtomFeedHandler)
+	r.GET("/feed.json", s.JSONFeedHandler)
+
+	r.GET("/sitemap.xml", s.SitemapHandler)
+	r.GET("/sitemap-posts.xml", s.SitemapPartHandler)
+	r.GET("/robots.txt", s.RobotsHandler)
+
+	r.GET("/api/posts/:id/revisions", requireAuth(), s.ListRevisionsHandler)
+	r.GET("/api/posts/:id/revisions/diff", requireAuth(), s.DiffRevisionsHandler)
+	r.GET("/api/posts/:id/revisions/:rev", requireAuth(), s.GetRevisionHandler)
+	r.POST("/api/posts/:id/revisions/:rev/restore", requireAuth(), s.RestoreRevisionHandler)
 
 	staticFiles, _ := fs.Sub(web.Files, "assets")
 	r.StaticFS("/assets", http.FS(staticFiles))
@@ -40,43 +81,74 @@ func (s *Server) RegisterRoutes() http.Handler {
 		templ.Handler(web.HelloForm()).ServeHTTP(c.Writer, c.Request)
 	})
 
-	// Web routes that return HTML
+	// Web routes that return HTML, served straight from the database
+	pages := web.NewHandlers(s.db, s.media, s.renderings)
+
 	// Serve the HTML page for posts
 	r.GET("/web/posts", func(c *gin.Context) {
-		web.PostsPageHandler(c.Writer, c.Request)
+		pages.PostsPageHandler(c.Writer, c.Request)
 	})
 
 	r.GET("/api/posts/list", func(c *gin.Context) {
-		web.PostsListHandler(c.Writer, c.Request)
+		pages.PostsListHandler(c.Writer, c.Request)
 	})
 
-	r.GET("/web/upload", func(c *gin.Context) {
-		web.UploadPageHandler(c.Writer, c.Request)
+	r.GET("/web/login", s.LoginPageHandler)
+	r.POST("/web/login", s.LoginSubmitHandler)
+	r.POST("/web/logout", requireSession(), s.LogoutHandler)
+
+	r.GET("/web/upload", requireSession(), func(c *gin.Context) {
+		pages.UploadPageHandler(c.Writer, c.Request)
 	})
 
-	r.POST("/web/upload/submit", func(c *gin.Context) {
-		web.UploadSubmitHandler(c.Writer, c.Request)
+	r.POST("/web/upload/submit", requireSession(), func(c *gin.Context) {
+		pages.UploadSubmitHandler(c.Writer, c.Request)
 	})
 
-	r.GET("/web/update", func(c *gin.Context) {
-		web.UpdatePageHandler(c.Writer, c.Request)
+	r.GET("/web/update", requireSession(), func(c *gin.Context) {
+		pages.UpdatePageHandler(c.Writer, c.Request)
 	})
 
 	//Delete page routes + handlers
-	r.GET("/web/delete", func(c *gin.Context) {
-		web.DeletePageHandler(c.Writer, c.Request)
+	r.GET("/web/delete", requireSession(), func(c *gin.Context) {
+		pages.DeletePageHandler(c.Writer, c.Request)
 	})
 
-	r.POST("/web/delete/confirm", func(c *gin.Context) {
-		web.DeleteConfirmHandler(c.Writer, c.Request)
+	r.POST("/web/delete/confirm", requireSession(), func(c *gin.Context) {
+		pages.DeleteConfirmHandler(c.Writer, c.Request)
 	})
 
-	r.POST("/web/delete/execute/:id", func(c *gin.Context) {
-		web.DeleteExecuteHandler(c.Writer, c.Request)
+	r.POST("/web/delete/execute/:id", requireSession(), func(c *gin.Context) {
+		pages.DeleteExecuteHandler(c.Writer, c.Request)
+	})
+
+	r.POST("/web/delete/undo/:id", requireSession(), func(c *gin.Context) {
+		pages.DeleteUndoHandler(c.Writer, c.Request)
 	})
 
 	r.GET("/web/posts/:id", func(c *gin.Context) {
-		web.PostDetailPageHandler(c.Writer, c.Request)
+		pages.PostDetailPageHandler(c.Writer, c.Request)
+	})
+
+	r.GET("/web/posts/:id/edit", requireSession(), func(c *gin.Context) {
+		pages.EditPageHandler(c.Writer, c.Request)
+	})
+
+	r.POST("/web/posts/:id/edit", requireSession(), func(c *gin.Context) {
+		pages.EditSubmitHandler(c.Writer, c.Request)
+	})
+
+	// Revision history routes + handlers
+	r.GET("/web/posts/:id/history", requireSession(), func(c *gin.Context) {
+		pages.HistoryPageHandler(c.Writer, c.Request)
+	})
+
+	r.GET("/web/posts/:id/history/diff", requireSession(), func(c *gin.Context) {
+		pages.RevisionDiffHandler(c.Writer, c.Request)
+	})
+
+	r.POST("/web/posts/:id/history/:rev/restore", requireSession(), func(c *gin.Context) {
+		pages.RestoreRevisionHandler(c.Writer, c.Request)
 	})
 	return r
 }
@@ -1,29 +1,85 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
+	"test-news/internal/auth"
 	"test-news/internal/database"
+	"test-news/internal/database/memory"
+	"test-news/internal/database/models"
+	"test-news/internal/env"
+	"test-news/internal/markdown"
+	"test-news/internal/media"
 )
 
+// renderingCacheSize is the number of post versions whose rendered HTML
+// the server keeps.
+const renderingCacheSize = 1000
+
 type Server struct {
 	port int
 
 	db database.Service
+	// tokens signs the access and refresh tokens handed out at login.
+	tokens *auth.Issuer
+	// limits enforces the rate limits of API keys.
+	limits *keyLimiter
+	// sessionTTL is how long a session of the web UI lasts.
+	sessionTTL time.Duration
+	// secureCookies marks the session cookie Secure, so browsers only send
+	// it over HTTPS.
+	secureCookies bool
+	// media keeps the files uploaded for posts.
+	media *media.Library
+	// renderings caches the HTML of post content for the pages and feeds.
+	renderings *markdown.Cache
+	// baseURL is the public address of the site, used for the absolute
+	// links of feeds and sitemaps. Empty means the address of each request.
+	baseURL string
+	// sitemapSize is how many URLs a sitemap lists, sitemap.MaxURLs when
+	// zero.
+	sitemapSize int
+	// robotsDisallow are the paths robots.txt asks crawlers to skip.
+	robotsDisallow []string
 }
 
-func NewServer() *http.Server {
+// NewServer creates the HTTP server for the API and the web UI on top of db,
+// see OpenDatabase.
+func NewServer(db database.Service) *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	baseURL := strings.TrimSuffix(os.Getenv("BLUEPRINT_BASE_URL"), "/")
+	if baseURL == "" {
+		log.Printf("BLUEPRINT_BASE_URL is not set, so feeds and sitemaps take their links from each request and are not cached publicly")
+	}
+
 	NewServer := &Server{
 		port: port,
 
-		db: database.New(),
+		db:     db,
+		tokens: newIssuer(),
+		limits: newKeyLimiter(env.Int("BLUEPRINT_API_KEY_RATE_LIMIT", 60)),
+
+		sessionTTL: env.Duration("BLUEPRINT_SESSION_TTL", 12*time.Hour),
+		media:      newMediaLibrary(),
+		renderings: markdown.NewCache(renderingCacheSize),
+		baseURL:    baseURL,
+
+		// Sessions only travel over HTTPS unless the site says it is served
+		// over plain HTTP, as during local development.
+		secureCookies: env.Bool("BLUEPRINT_SECURE_COOKIES", !strings.HasPrefix(baseURL, "http://")),
+
+		robotsDisallow: env.List("BLUEPRINT_ROBOTS_DISALLOW", defaultRobotsDisallow),
 	}
 
 	// Declare Server config
@@ -37,3 +93,116 @@ func NewServer() *http.Server {
 
 	return server
 }
+
+// OpenDatabase connects to the configured storage backend and prepares it
+// for use.
+func OpenDatabase() database.Service {
+	db := newDatabase()
+	prepareDatabase(db)
+	bootstrapAdmin(db)
+	return db
+}
+
+// newDatabase picks the storage backend from BLUEPRINT_DB_DRIVER. MongoDB is
+// the default; "memory" keeps everything in process and needs no database.
+func newDatabase() database.Service {
+	switch driver := os.Getenv("BLUEPRINT_DB_DRIVER"); driver {
+	case "", "mongo":
+		return database.New()
+	case "memory":
+		log.Println("Using in-memory database, data will be lost on restart")
+		return memory.New()
+	default:
+		log.Fatalf("unknown BLUEPRINT_DB_DRIVER %q, expected \"mongo\" or \"memory\"", driver)
+		return nil
+	}
+}
+
+// prepareDatabase runs pending migrations unless BLUEPRINT_DB_AUTO_MIGRATE is
+// false, for backends that have a schema. Search and listings need the
+// indexes, so the server refuses to start while any is missing or outdated.
+func prepareDatabase(db database.Service) {
+	migrator, ok := db.(database.Migrator)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if env.Bool("BLUEPRINT_DB_AUTO_MIGRATE", true) {
+		if _, err := migrator.Migrate(ctx); err != nil {
+			log.Fatalf("Failed to migrate the database: %v", err)
+		}
+	}
+
+	if err := migrator.CheckIndexes(ctx); err != nil {
+		log.Fatalf("Database is not ready: %v", err)
+	}
+}
+
+// newIssuer signs tokens with BLUEPRINT_JWT_SECRET. Without a secret a random
+// one is used, which logs everyone out whenever the server restarts.
+func newIssuer() *auth.Issuer {
+	secret := []byte(os.Getenv("BLUEPRINT_JWT_SECRET"))
+	if len(secret) == 0 {
+		log.Println("WARNING: BLUEPRINT_JWT_SECRET is not set, using a random secret")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	} else if len(secret) < 32 {
+		log.Fatal("BLUEPRINT_JWT_SECRET must be at least 32 bytes long")
+	}
+
+	return auth.NewIssuer(secret,
+		env.Duration("BLUEPRINT_JWT_ACCESS_TTL", 15*time.Minute),
+		env.Duration("BLUEPRINT_JWT_REFRESH_TTL", 7*24*time.Hour),
+	)
+}
+
+// newMediaLibrary keeps uploads in BLUEPRINT_MEDIA_DIR on the local disk,
+// accepting files of up to BLUEPRINT_MEDIA_MAX_BYTES.
+func newMediaLibrary() *media.Library {
+	dir := os.Getenv("BLUEPRINT_MEDIA_DIR")
+	if dir == "" {
+		dir = "media"
+	}
+
+	store, err := media.NewDiskStore(dir)
+	if err != nil {
+		log.Fatalf("Failed to open the media store: %v", err)
+	}
+
+	return media.NewLibrary(store, int64(env.Int("BLUEPRINT_MEDIA_MAX_BYTES", 10<<20)))
+}
+
+// bootstrapAdmin creates the admin account named by BLUEPRINT_ADMIN_USERNAME
+// with BLUEPRINT_ADMIN_PASSWORD, unless a user of that name already exists.
+// It is how the first user comes to be, since only admins create users.
+func bootstrapAdmin(db database.Service) {
+	username := os.Getenv("BLUEPRINT_ADMIN_USERNAME")
+	if username == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.GetUserByUsername(ctx, username)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, database.ErrUserNotFound) {
+		log.Fatalf("Failed to look up the admin user: %v", err)
+	}
+
+	hash, err := auth.HashPassword(os.Getenv("BLUEPRINT_ADMIN_PASSWORD"))
+	if err != nil {
+		log.Fatalf("Invalid BLUEPRINT_ADMIN_PASSWORD: %v", err)
+	}
+
+	admin := &models.User{Username: username, Name: username, Role: models.RoleAdmin, PasswordHash: hash}
+	if err := db.CreateUser(ctx, admin); err != nil {
+		log.Fatalf("Failed to create the admin user: %v", err)
+	}
+	log.Printf("Created admin user %s", admin.Username)
+}
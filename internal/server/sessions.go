@@ -0,0 +1,271 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"test-news/cmd/web"
+	"test-news/internal/auth"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"test-news/internal/policy"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// sessionCookie holds the session token of the web UI.
+const sessionCookie = "tn_session"
+
+// loginCSRFCookie holds the CSRF token of the login form, which is sent
+// before there is a session to keep it in.
+const loginCSRFCookie = "tn_login_csrf"
+
+// loginCSRFTTL is how long a login form may be left open.
+const loginCSRFTTL = time.Hour
+
+// sessionKey stores the *models.Session of a request in the gin context.
+const sessionKey = "session"
+
+// sessionPrincipal looks up the session named by the cookie token. Unlike
+// bad credentials in a header, a session that expired or was logged out
+// elsewhere is an everyday sight, so the request carries on anonymously and
+// the stale cookie is cleared.
+func (s *Server) sessionPrincipal(c *gin.Context, token string) (*policy.Principal, bool) {
+	session, err := s.db.GetSessionByHash(c.Request.Context(), auth.HashSessionToken(token))
+	if err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		abortWithError(c, "Unauthorized", err)
+		return nil, false
+	}
+	if session == nil || session.Expired(time.Now()) {
+		s.clearSessionCookie(c)
+		return nil, true
+	}
+
+	// The user is read on every request, so that a changed role applies
+	// straight away.
+	user, err := s.db.GetUser(c.Request.Context(), session.UserID.Hex())
+	if errors.Is(err, database.ErrUserNotFound) {
+		s.clearSessionCookie(c)
+		return nil, true
+	}
+	if err != nil {
+		abortWithError(c, "Unauthorized", err)
+		return nil, false
+	}
+
+	c.Set(sessionKey, session)
+	c.Request = c.Request.WithContext(web.WithViewer(c.Request.Context(), &web.Viewer{
+		Name:      user.Name,
+		Username:  user.Username,
+		Role:      user.Role,
+		CSRFToken: session.CSRFToken,
+	}))
+	return &policy.Principal{ID: user.ID, Name: user.Name, Role: user.Role}, true
+}
+
+// sessionFrom returns the web UI session of the request, or nil.
+func sessionFrom(c *gin.Context) *models.Session {
+	session, _ := c.Get(sessionKey)
+	ss, _ := session.(*models.Session)
+	return ss
+}
+
+// csrfProtect refuses requests signed in by a session cookie that change data
+// without the CSRF token of the session, in the X-CSRF-Token header or the
+// csrf_token form field. Browsers send the cookie along with requests that
+// other sites make, but those sites can't read the token.
+//
+// htmx sends the header with every request of the pages, so the form field is
+// only read from the small URL-encoded bodies of plain forms, never from
+// multipart uploads, which would otherwise be parsed in full before their
+// handler runs.
+func csrfProtect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessionFrom(c)
+		if session == nil || isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		token := c.GetHeader(web.CSRFHeader)
+		if token == "" && c.ContentType() == binding.MIMEPOSTForm {
+			token = c.PostForm(web.CSRFField)
+		}
+		if !auth.CheckCSRFToken(session.CSRFToken, token) {
+			abortWithProblem(c, newProblem(http.StatusForbidden, codeForbidden, "Forbidden",
+				"The CSRF token is missing or not valid, reload the page and try again"))
+			return
+		}
+		c.Next()
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// requireSession sends visitors of the web UI without a session to the login
+// page, and back to the page they asked for once they logged in.
+func requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sessionFrom(c) != nil {
+			c.Next()
+			return
+		}
+
+		location := "/web/login"
+		if c.Request.Method == http.MethodGet {
+			location += "?next=" + url.QueryEscape(c.Request.URL.RequestURI())
+		}
+		// htmx follows redirects itself and would swap the login page into
+		// the target, so it is told to navigate instead.
+		if c.GetHeader("HX-Request") == "true" {
+			c.Header("HX-Redirect", location)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Redirect(http.StatusSeeOther, location)
+		c.Abort()
+	}
+}
+
+// safeNext returns next when it is a path on this site, so that the login
+// page can't be used to send people elsewhere. Browsers drop control
+// characters from a Location, which would turn "/\t/evil.example" into a
+// link to another site, so next may hold none.
+func safeNext(next string) string {
+	const home = "/web/posts"
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") ||
+		strings.ContainsFunc(next, unicode.IsControl) {
+		return home
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return home
+	}
+	return next
+}
+
+// loginCSRFToken returns the CSRF token of the login form, from the cookie of
+// an earlier visit or else a new one set in the cookie. Checking that the
+// form sends the token of the cookie keeps other sites from signing a
+// visitor in to an account of theirs.
+func (s *Server) loginCSRFToken(c *gin.Context) string {
+	if token, err := c.Cookie(loginCSRFCookie); err == nil && token != "" {
+		return token
+	}
+	token := auth.NewCSRFToken()
+	s.setLoginCSRFCookie(c, token, int(loginCSRFTTL/time.Second))
+	return token
+}
+
+func (s *Server) setLoginCSRFCookie(c *gin.Context, token string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     loginCSRFCookie,
+		Value:    token,
+		Path:     "/web/login",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// LoginPageHandler renders the login form of the web UI.
+func (s *Server) LoginPageHandler(c *gin.Context) {
+	next := safeNext(c.Query("next"))
+	if sessionFrom(c) != nil {
+		c.Redirect(http.StatusSeeOther, next)
+		return
+	}
+
+	web.LoginPage(next, s.loginCSRFToken(c), "").Render(c.Request.Context(), c.Writer)
+}
+
+// LoginSubmitHandler checks the username and password of the login form and
+// starts a session.
+func (s *Server) LoginSubmitHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	next := safeNext(c.PostForm("next"))
+
+	if token, err := c.Cookie(loginCSRFCookie); err != nil || !auth.CheckCSRFToken(token, c.PostForm(web.CSRFField)) {
+		c.Status(http.StatusForbidden)
+		web.LoginPage(next, s.loginCSRFToken(c), "The login form expired, please try again.").Render(ctx, c.Writer)
+		return
+	}
+	csrfToken := s.loginCSRFToken(c)
+
+	user, err := s.db.GetUserByUsername(ctx, c.PostForm("username"))
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		c.Status(http.StatusInternalServerError)
+		web.LoginPage(next, csrfToken, "Failed to log in, please try again.").Render(ctx, c.Writer)
+		return
+	}
+
+	// As for the API, an unknown user costs as much as a wrong password.
+	var hash string
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if !auth.CheckPassword(hash, c.PostForm("password")) {
+		c.Status(http.StatusUnauthorized)
+		web.LoginPage(next, csrfToken, "The username or password is not valid.").Render(ctx, c.Writer)
+		return
+	}
+
+	// Logging in again replaces the session rather than reusing it.
+	if old := sessionFrom(c); old != nil {
+		s.endSession(c, old)
+	}
+
+	token, hash := auth.NewSessionToken()
+	session := &models.Session{
+		UserID:    user.ID,
+		Hash:      hash,
+		CSRFToken: auth.NewCSRFToken(),
+		ExpiresAt: time.Now().Add(s.sessionTTL),
+	}
+	if err := s.db.CreateSession(ctx, session); err != nil {
+		c.Status(http.StatusInternalServerError)
+		web.LoginPage(next, csrfToken, "Failed to log in, please try again.").Render(ctx, c.Writer)
+		return
+	}
+
+	s.setSessionCookie(c, token, int(s.sessionTTL/time.Second))
+	s.setLoginCSRFCookie(c, "", -1)
+	c.Redirect(http.StatusSeeOther, next)
+}
+
+// LogoutHandler ends the session of the web UI.
+func (s *Server) LogoutHandler(c *gin.Context) {
+	s.endSession(c, sessionFrom(c))
+	c.Redirect(http.StatusSeeOther, "/web/posts")
+}
+
+func (s *Server) endSession(c *gin.Context, session *models.Session) {
+	if err := s.db.DeleteSession(c.Request.Context(), session.ID); err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		log.Printf("Failed to delete session %s: %v", session.ID.Hex(), err)
+	}
+	s.clearSessionCookie(c)
+}
+
+func (s *Server) setSessionCookie(c *gin.Context, token string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) clearSessionCookie(c *gin.Context) {
+	s.setSessionCookie(c, "", -1)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+var csrfPattern = regexp.MustCompile(`name="csrf_token" value="([0-9a-f]+)"`)
+
+// login signs username in to the web UI and returns the session cookie.
+func login(t *testing.T, h http.Handler, username string) *http.Cookie {
+	t.Helper()
+	form := url.Values{"username": {username}, "password": {testPassword}}
+	rr := submitLogin(t, h, form)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("login returned %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == sessionCookie && cookie.Value != "" {
+			return cookie
+		}
+	}
+	t.Fatal("login set no session cookie")
+	return nil
+}
+
+// submitLogin sends the login form with form filled in, as a browser that
+// was shown the form first, with its CSRF cookie and token.
+func submitLogin(t *testing.T, h http.Handler, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	page := getPage(h, "/web/login", nil)
+	m := csrfPattern.FindStringSubmatch(page.Body.String())
+	if m == nil {
+		t.Fatalf("no CSRF token in the login form: %s", page.Body.String())
+	}
+	form.Set("csrf_token", m[1])
+	return postForm(h, "/web/login", form, page.Result().Cookies()[0])
+}
+
+func postForm(h http.Handler, target string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// csrfFrom returns the CSRF token embedded in a page of the session.
+func csrfFrom(t *testing.T, h http.Handler, cookie *http.Cookie) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/web/posts", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	m := csrfPattern.FindStringSubmatch(rr.Body.String())
+	if m == nil {
+		t.Fatalf("no CSRF token in the page: %s", rr.Body.String())
+	}
+	return m[1]
+}
+
+func TestWebLogin(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	if rr := submitLogin(t, h, url.Values{"username": {"will"}, "password": {"wrong password"}}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", rr.Code)
+	}
+
+	rr := submitLogin(t, h, url.Values{"username": {"will"}, "password": {testPassword}, "next": {"/web/upload"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/web/upload" {
+		t.Fatalf("expected a redirect to /web/upload, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	cookie := rr.Result().Cookies()[0]
+	if cookie.Name != sessionCookie || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Secure {
+		t.Fatalf("unexpected cookie: %+v", cookie)
+	}
+
+	// Only paths on this site are followed after logging in.
+	rr = submitLogin(t, h, url.Values{"username": {"will"}, "password": {testPassword}, "next": {"//evil.example"}})
+	if location := rr.Header().Get("Location"); location != "/web/posts" {
+		t.Fatalf("expected a redirect to /web/posts, got %q", location)
+	}
+	for _, next := range []string{"/%09/evil.example", "/%0a/evil.example", "/%5Cevil.example"} {
+		if rr := getPage(h, "/web/login?next="+next, cookie); rr.Header().Get("Location") != "/web/posts" {
+			t.Fatalf("%s: expected a redirect to /web/posts, got %q", next, rr.Header().Get("Location"))
+		}
+	}
+
+	// The login form carries a token of its own, so another site can't sign
+	// a visitor in to an account of its choosing.
+	if rr := postForm(h, "/web/login", url.Values{"username": {"will"}, "password": {testPassword}}, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a login without the form's token, got %d", rr.Code)
+	}
+	forged := url.Values{"username": {"will"}, "password": {testPassword}, "csrf_token": {"0000"}}
+	if rr := postForm(h, "/web/login", forged, &http.Cookie{Name: loginCSRFCookie, Value: "1111"}); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a token not matching the cookie, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/web/posts", nil)
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "Signed in as") || !strings.Contains(rr.Body.String(), ">will<") {
+		t.Fatalf("expected the nav to show the signed-in user: %s", rr.Body.String())
+	}
+
+	// Served over HTTPS, the cookie is only sent back over HTTPS, even
+	// behind a proxy that ends TLS.
+	s.secureCookies = true
+	rr = submitLogin(t, h, url.Values{"username": {"will"}, "password": {testPassword}})
+	if cookie := rr.Result().Cookies()[0]; !cookie.Secure {
+		t.Fatalf("expected a Secure cookie, got %+v", cookie)
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	for next, want := range map[string]string{
+		"/web/upload":          "/web/upload",
+		"/web/posts?q=storm":   "/web/posts?q=storm",
+		"":                     "/web/posts",
+		"web/upload":           "/web/posts",
+		"//evil.example":       "/web/posts",
+		"/\\evil.example":      "/web/posts",
+		"/\t/evil.example":     "/web/posts",
+		"/\n/evil.example":     "/web/posts",
+		"/\r\n/evil.example":   "/web/posts",
+		"https://evil.example": "/web/posts",
+	} {
+		if got := safeNext(next); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	_, h, _ := newTestServer()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/web/upload", nil))
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/web/login?next=%2Fweb%2Fupload" {
+		t.Fatalf("expected a redirect to the login page, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if rr := postForm(h, "/web/delete/execute/abc", nil, nil); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect for an anonymous POST, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/web/delete/confirm", strings.NewReader("postId=abc"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Header().Get("HX-Redirect") != "/web/login" {
+		t.Fatalf("expected htmx to be told to navigate to the login page, got %d %v", rr.Code, rr.Header())
+	}
+
+	// A cookie of an unknown session is cleared and treated as anonymous.
+	req = httptest.NewRequest(http.MethodGet, "/web/upload", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: "stale"})
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || !strings.Contains(rr.Header().Get("Set-Cookie"), "Max-Age=0") {
+		t.Fatalf("expected the stale cookie to be cleared, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestCSRFProtection(t *testing.T) {
+	s, h, _ := newTestServer()
+	cookie := login(t, h, "will")
+	token := csrfFrom(t, h, cookie)
+
+	post := &models.Post{Title: "Mine", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pages have htmx send the token with every request.
+	if rr := getPage(h, "/web/posts", cookie); !strings.Contains(rr.Body.String(), `hx-headers="{&#34;X-CSRF-Token&#34;:&#34;`+token+`&#34;}"`) {
+		t.Fatalf("expected the page to set the CSRF header for htmx: %s", rr.Body.String())
+	}
+
+	// The session signs API requests in too, but changing data needs the
+	// token as well.
+	update := func(csrf string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/posts/"+post.ID.Hex(), strings.NewReader(`{"title":"Ours","content":"body","author":"will"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", postETag(post))
+		req.AddCookie(cookie)
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := update(""); code != http.StatusForbidden {
+		t.Fatalf("expected 403 without a CSRF token, got %d", code)
+	}
+	if code := update("0000"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a wrong CSRF token, got %d", code)
+	}
+	if code := update(token); code != http.StatusOK {
+		t.Fatalf("expected 200 with the CSRF token, got %d", code)
+	}
+	updated, _ := s.db.GetPost(context.Background(), post.ID.Hex())
+	if updated.Title != "Ours" {
+		t.Fatalf("unexpected post: %+v", updated)
+	}
+
+	// Forms send the token in a field.
+	if rr := postForm(h, "/web/logout", nil, cookie); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for logging out without a CSRF token, got %d", rr.Code)
+	}
+	if rr := postForm(h, "/web/logout", url.Values{"csrf_token": {token}}, cookie); rr.Code != http.StatusSeeOther {
+		t.Fatalf("logout returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The session is gone once logged out.
+	req := httptest.NewRequest(http.MethodGet, "/web/upload", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after logging out, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"test-news/internal/sitemap"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sitemapMaxAge is how long crawlers may reuse a sitemap. An index points at
+// its sitemaps by the post each starts after, and publishing an older draft
+// moves those starts, so an index and sitemaps fetched at different times
+// only agree again once both are fetched anew.
+const sitemapMaxAge = 5 * time.Minute
+
+// robotsMaxAge is how long crawlers may reuse robots.txt, which only changes
+// with the configuration.
+const robotsMaxAge = time.Hour
+
+// defaultRobotsDisallow keeps crawlers out of the API and of the pages only
+// the newsroom uses.
+var defaultRobotsDisallow = []string{"/api/", "/web/login", "/web/upload", "/web/update", "/web/delete"}
+
+// SitemapHandler lists every public post for search engines, as a sitemap
+// index once there are too many for a single sitemap.
+func (s *Server) SitemapHandler(c *gin.Context) {
+	s.writeSitemap(c, func(g *sitemap.Generator) error {
+		return g.Write(c.Request.Context(), c.Writer, s.siteURL(c))
+	})
+}
+
+// SitemapPartHandler serves one of the sitemaps a sitemap index points at,
+// starting after the post named by the from cursor.
+func (s *Server) SitemapPartHandler(c *gin.Context) {
+	s.writeSitemap(c, func(g *sitemap.Generator) error {
+		return g.WritePart(c.Request.Context(), c.Writer, s.siteURL(c), c.Query("from"))
+	})
+}
+
+// writeSitemap streams a sitemap as write produces it. Errors found before
+// the first byte are reported as a problem. Past that point the status is
+// sent, so the document is left unfinished, which crawlers reject as
+// malformed and fetch again later.
+func (s *Server) writeSitemap(c *gin.Context, write func(*sitemap.Generator) error) {
+	c.Header("Content-Type", sitemap.ContentType)
+	s.cacheFor(c, sitemapMaxAge)
+
+	err := write(sitemap.New(s.db, s.sitemapSize))
+	if err == nil {
+		return
+	}
+	if !c.Writer.Written() {
+		c.Header("Cache-Control", "no-store")
+		abortWithQueryError(c, "Failed to build sitemap", err)
+		return
+	}
+	log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+}
+
+// RobotsHandler tells crawlers what to leave alone and where the sitemap is.
+func (s *Server) RobotsHandler(c *gin.Context) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if len(s.robotsDisallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	for _, path := range s.robotsDisallow {
+		b.WriteString("Disallow: " + path + "\n")
+	}
+	b.WriteString("\nSitemap: " + s.siteURL(c) + "/sitemap.xml\n")
+
+	s.cacheFor(c, robotsMaxAge)
+	c.String(http.StatusOK, b.String())
+}
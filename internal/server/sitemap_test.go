@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+func TestSitemapHandlers(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	published := &models.Post{Title: "Out now", Content: "body", Author: "will"}
+	publish(t, s, published)
+	draft := &models.Post{Title: "Not yet", Content: "body", Author: "will"}
+	if err := s.db.CreatePost(context.Background(), draft); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := getPage(h, "/sitemap.xml", nil)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/xml") {
+		t.Fatalf("expected a sitemap, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "<urlset") || !strings.Contains(body, "http://example.com/web/posts/"+published.ID.Hex()) {
+		t.Fatalf("expected the published post in the sitemap: %s", body)
+	}
+	if strings.Contains(body, draft.ID.Hex()) {
+		t.Fatalf("expected drafts to be left out: %s", body)
+	}
+	if cc := rr.Header().Get("Cache-Control"); !strings.HasSuffix(cc, "max-age=300") {
+		t.Fatalf("expected the sitemap to be cached briefly, got %q", cc)
+	}
+
+	// Past the size of a sitemap, the site is described by an index.
+	publish(t, s, &models.Post{Title: "Also out", Content: "body", Author: "will"})
+	s.sitemapSize = 2
+	body = getPage(h, "/sitemap.xml", nil).Body.String()
+	if !strings.Contains(body, "<sitemapindex") || !strings.Contains(body, "http://example.com/sitemap-posts.xml?from=") {
+		t.Fatalf("expected a sitemap index: %s", body)
+	}
+	if rr := getPage(h, "/sitemap-posts.xml", nil); rr.Code != http.StatusOK || strings.Count(rr.Body.String(), "<url>") != 2 {
+		t.Fatalf("expected the first sitemap of the index: %s", rr.Body.String())
+	}
+
+	if rr := getPage(h, "/sitemap-posts.xml?from=bogus", nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad cursor, got %d", rr.Code)
+	}
+}
+
+func TestRobotsHandler(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	rr := getPage(h, "/robots.txt", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Disallow:\n") {
+		t.Fatalf("expected robots.txt to allow everything by default, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	s.robotsDisallow = defaultRobotsDisallow
+	s.baseURL = "https://news.example"
+	body := getPage(h, "/robots.txt", nil).Body.String()
+	if !strings.Contains(body, "Disallow: /api/\n") || !strings.Contains(body, "Sitemap: https://news.example/sitemap.xml\n") {
+		t.Fatalf("unexpected robots.txt: %s", body)
+	}
+}
+
+func TestSiteURLCaching(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	// Links taken from the Host header of a request are never handed to
+	// other clients by a shared cache.
+	for _, target := range []string{"/robots.txt", "/sitemap.xml", "/feed.atom"} {
+		rr := getPage(h, target, nil)
+		if cc := rr.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "private,") || rr.Header().Get("Vary") != "Host" {
+			t.Fatalf("%s: expected a private response varying by Host, got %q %q", target, cc, rr.Header().Get("Vary"))
+		}
+	}
+
+	s.baseURL = "https://news.example"
+	for _, target := range []string{"/robots.txt", "/sitemap.xml", "/feed.atom"} {
+		rr := getPage(h, target, nil)
+		if cc := rr.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public,") {
+			t.Fatalf("%s: expected a public response with a configured address, got %q", target, cc)
+		}
+	}
+}
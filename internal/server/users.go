@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+	"test-news/internal/auth"
+	"test-news/internal/database/models"
+	"test-news/internal/policy"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newUserRequest is the body of POST /api/users.
+type newUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	// Role defaults to writer.
+	Role models.Role `json:"role"`
+}
+
+// CreateUserHandler lets an admin open an account for a new member of the
+// newsroom.
+func (s *Server) CreateUserHandler(c *gin.Context) {
+	if !authorize(c, "Failed to create user", policy.ManageUsers, nil) {
+		return
+	}
+
+	var req newUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleWriter
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		abortWithError(c, "Failed to create user", err)
+		return
+	}
+
+	user := &models.User{
+		Username:     req.Username,
+		Name:         req.Name,
+		Role:         req.Role,
+		PasswordHash: hash,
+	}
+	if err := s.db.CreateUser(c.Request.Context(), user); err != nil {
+		abortWithError(c, "Failed to create user", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// ListUsersHandler returns every user, for admins.
+func (s *Server) ListUsersHandler(c *gin.Context) {
+	if !authorize(c, "Failed to list users", policy.ManageUsers, nil) {
+		return
+	}
+
+	users, err := s.db.ListUsers(c.Request.Context())
+	if err != nil {
+		abortWithError(c, "Failed to list users", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": users, "count": len(users)})
+}
+
+// roleRequest is the body of PUT /api/users/:id/role.
+type roleRequest struct {
+	Role models.Role `json:"role" binding:"required"`
+}
+
+// SetUserRoleHandler lets an admin change the role of a user. Access tokens
+// already issued keep the old role until they expire, the next refresh picks
+// up the new one.
+func (s *Server) SetUserRoleHandler(c *gin.Context) {
+	if !authorize(c, "Failed to change role", policy.ManageUsers, nil) {
+		return
+	}
+
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		abortWithProblem(c, newProblem(http.StatusBadRequest, codeInvalidID, "Invalid user ID format", "The ID is not a valid user ID"))
+		return
+	}
+
+	// An admin demoting themselves could leave nobody to manage users. IDs
+	// are compared parsed, as hex may come in either case.
+	if id == principalFrom(c).ID {
+		abortWithProblem(c, newProblem(http.StatusForbidden, codeForbidden, "Failed to change role",
+			"Admins may not change their own role, ask another admin"))
+		return
+	}
+
+	user, err := s.db.SetUserRole(c.Request.Context(), id.Hex(), req.Role)
+	if err != nil {
+		abortWithError(c, "Failed to change role", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// MeHandler returns the signed-in user.
+func (s *Server) MeHandler(c *gin.Context) {
+	user, err := s.db.GetUser(c.Request.Context(), principalFrom(c).ID.Hex())
+	if err != nil {
+		abortWithError(c, "Failed to retrieve user", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
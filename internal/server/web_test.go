@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+// getPage requests target, signed in with cookie unless it is nil.
+func getPage(h http.Handler, target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestWebPostPages(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	published := &models.Post{Title: "Out now", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	publish(t, s, published)
+	draft := &models.Post{Title: "Not yet", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	if err := s.db.CreatePost(context.Background(), draft); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := getPage(h, "/api/posts/list", nil)
+	if !strings.Contains(rr.Body.String(), "Out now") || strings.Contains(rr.Body.String(), "Not yet") {
+		t.Fatalf("expected the public list to hold published posts only: %s", rr.Body.String())
+	}
+	if rr := getPage(h, "/api/posts/list", login(t, h, "rita")); strings.Contains(rr.Body.String(), "Not yet") {
+		t.Fatalf("expected readers to see published posts only: %s", rr.Body.String())
+	}
+	for _, username := range []string{"will", "erin"} {
+		if rr := getPage(h, "/api/posts/list", login(t, h, username)); !strings.Contains(rr.Body.String(), "Not yet") {
+			t.Fatalf("expected %s to see the draft: %s", username, rr.Body.String())
+		}
+	}
+
+	if rr := getPage(h, "/web/posts/"+published.ID.Hex(), nil); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Out now") {
+		t.Fatalf("expected the post page, got %d", rr.Code)
+	}
+
+	// Errors are rendered as pages rather than plain text.
+	for target, status := range map[string]int{
+		"/web/posts/" + draft.ID.Hex(): http.StatusNotFound,
+		"/web/posts/not-an-id":         http.StatusBadRequest,
+	} {
+		rr := getPage(h, target, nil)
+		if rr.Code != status || !strings.Contains(rr.Body.String(), "<!doctype html>") {
+			t.Fatalf("expected an error page with status %d for %s, got %d: %s", status, target, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestWebSearch(t *testing.T) {
+	s, h, _ := newTestServer()
+
+	publish(t, s, &models.Post{Title: "Harbour news", Content: "The <b>storm</b> closed the harbour.", Author: "will", AuthorID: userID(t, s, "will")})
+	publish(t, s, &models.Post{Title: "Weather", Content: "Sunny all week.", Author: "will", AuthorID: userID(t, s, "will")})
+
+	body := getPage(h, "/api/posts/list?q=storm", nil).Body.String()
+	if !strings.Contains(body, "Harbour news") || strings.Contains(body, "Weather") {
+		t.Fatalf("expected the matching post only: %s", body)
+	}
+	if !strings.Contains(body, "&lt;b&gt;<mark>storm</mark>&lt;/b&gt;") {
+		t.Fatalf("expected the escaped snippet with the match highlighted: %s", body)
+	}
+}
+
+func TestWebUploadAndDelete(t *testing.T) {
+	s, h, _ := newTestServer()
+	cookie := login(t, h, "will")
+	token := csrfFrom(t, h, cookie)
+
+	rr := postForm(h, "/web/upload/submit", url.Values{"csrf_token": {token}, "title": {"From the form"}, "content": {"body"}}, cookie)
+	if !strings.Contains(rr.Body.String(), "Draft saved!") {
+		t.Fatalf("expected the post to be saved: %s", rr.Body.String())
+	}
+	page, err := s.db.ListPosts(context.Background(), database.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].Author != "will" || page.Posts[0].AuthorID != userID(t, s, "will") {
+		t.Fatalf("expected one post by will, got %+v", page.Posts)
+	}
+	own := page.Posts[0]
+
+	other := &models.Post{Title: "Theirs", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")}
+	publish(t, s, other)
+
+	// The policy applies to the pages as to the API.
+	rr = postForm(h, "/web/delete/execute/"+other.ID.Hex(), url.Values{"csrf_token": {token}}, cookie)
+	if !strings.Contains(rr.Body.String(), "Writers may only delete posts they wrote themselves") {
+		t.Fatalf("expected the delete to be refused: %s", rr.Body.String())
+	}
+
+	rr = postForm(h, "/web/delete/execute/"+own.ID.Hex(), url.Values{"csrf_token": {token}}, cookie)
+	if !strings.Contains(rr.Body.String(), "Post moved to the trash.") {
+		t.Fatalf("expected the post to be deleted: %s", rr.Body.String())
+	}
+	if _, err := s.db.GetTrashedPost(context.Background(), own.ID.Hex()); err != nil {
+		t.Fatalf("expected the post in the trash, got %v", err)
+	}
+
+	rr = postForm(h, "/web/delete/undo/"+own.ID.Hex(), url.Values{"csrf_token": {token}}, cookie)
+	if !strings.Contains(rr.Body.String(), "Post restored successfully!") {
+		t.Fatalf("expected the post to be restored: %s", rr.Body.String())
+	}
+}
+
+func TestWebRestoreRevision(t *testing.T) {
+	s, h, _ := newTestServer()
+	cookie := login(t, h, "erin")
+	token := csrfFrom(t, h, cookie)
+
+	post := &models.Post{Title: "First", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.UpdatePost(context.Background(), post.ID.Hex(), database.AnyVersion, &models.Post{Title: "Second", Content: "body", Author: "erin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := getPage(h, fmt.Sprintf("/web/posts/%s/history/diff?from=1&to=2", post.ID.Hex()), cookie)
+	if !strings.Contains(rr.Body.String(), "+Title: Second") {
+		t.Fatalf("expected a diff of the versions: %s", rr.Body.String())
+	}
+
+	restore := func(version string) string {
+		target := fmt.Sprintf("/web/posts/%s/history/1/restore", post.ID.Hex())
+		return postForm(h, target, url.Values{"csrf_token": {token}, "version": {version}}, cookie).Body.String()
+	}
+	if body := restore("1"); !strings.Contains(body, "changed by someone else") {
+		t.Fatalf("expected a conflict for a stale version: %s", body)
+	}
+	if body := restore("2"); !strings.Contains(body, "Version 1 restored successfully!") {
+		t.Fatalf("expected the revision to be restored: %s", body)
+	}
+
+	restored, _ := s.db.GetPost(context.Background(), post.ID.Hex())
+	revisions, _ := s.db.ListRevisions(context.Background(), post.ID.Hex())
+	if restored.Title != "First" || len(revisions) != 2 || revisions[0].Editor != "erin" {
+		t.Fatalf("unexpected post %+v and revisions %+v", restored, revisions)
+	}
+}
+
+func TestWebEditPost(t *testing.T) {
+	s, h, _ := newTestServer()
+	cookie := login(t, h, "will")
+	token := csrfFrom(t, h, cookie)
+
+	post := &models.Post{Title: "Original", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	editURL := "/web/posts/" + post.ID.Hex() + "/edit"
+
+	if rr := getPage(h, "/web/posts/"+post.ID.Hex(), cookie); !strings.Contains(rr.Body.String(), `href="`+editURL+`"`) {
+		t.Fatalf("expected the post page to link to the edit page: %s", rr.Body.String())
+	}
+	if rr := getPage(h, "/web/update?postId="+post.ID.Hex(), cookie); rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != editURL {
+		t.Fatalf("expected /web/update to redirect to the edit page, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr := getPage(h, editURL, cookie)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `value="Original"`) || !strings.Contains(rr.Body.String(), `name="version" value="1"`) {
+		t.Fatalf("expected the form to hold the post: %d %s", rr.Code, rr.Body.String())
+	}
+
+	edit := func(form url.Values) string {
+		form.Set("csrf_token", token)
+		return postForm(h, editURL, form, cookie).Body.String()
+	}
+
+	// Invalid fields are reported next to the field, keeping what was typed.
+	body := edit(url.Values{"title": {" "}, "content": {"typed"}, "version": {"1"}})
+	for _, want := range []string{"Title is required", ">typed</textarea>"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in the page: %s", want, body)
+		}
+	}
+
+	// The author isn't part of the form, and one slipped in is ignored.
+	body = edit(url.Values{"title": {"Edited"}, "author": {"erin"}, "content": {"new body"}, "version": {"1"}})
+	if !strings.Contains(body, "Post updated successfully!") || !strings.Contains(body, `name="version" value="2"`) {
+		t.Fatalf("expected the post to be updated: %s", body)
+	}
+
+	// A form filled from an older version doesn't overwrite silently.
+	body = edit(url.Values{"title": {"Stale"}, "content": {"body"}, "version": {"1"}})
+	if !strings.Contains(body, "Someone else changed this post") || !strings.Contains(body, `value="Stale"`) {
+		t.Fatalf("expected a conflict: %s", body)
+	}
+	updated, _ := s.db.GetPost(context.Background(), post.ID.Hex())
+	if updated.Title != "Edited" || updated.Author != "will" || updated.Version != 2 {
+		t.Fatalf("unexpected post: %+v", updated)
+	}
+
+	// Writers may only edit their own posts.
+	other := &models.Post{Title: "Theirs", Content: "body", Author: "erin", AuthorID: userID(t, s, "erin")}
+	publish(t, s, other)
+	if rr := getPage(h, "/web/posts/"+other.ID.Hex()+"/edit", cookie); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another's post, got %d", rr.Code)
+	}
+
+	// And only while they are drafts, so published posts change through a
+	// review.
+	live := &models.Post{Title: "Out now", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	publish(t, s, live)
+	liveURL := "/web/posts/" + live.ID.Hex() + "/edit"
+	if rr := getPage(h, liveURL, cookie); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "Writers may only edit drafts") {
+		t.Fatalf("expected 403 for a published post, got %d: %s", rr.Code, rr.Body.String())
+	}
+	postForm(h, liveURL, url.Values{"csrf_token": {token}, "title": {"Sneaked in"}, "content": {"body"}, "version": {"2"}}, cookie)
+	if current, _ := s.db.GetPost(context.Background(), live.ID.Hex()); current.Title != "Out now" {
+		t.Fatalf("expected the published post to be left alone, got %+v", current)
+	}
+}
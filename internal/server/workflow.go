@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"test-news/internal/policy"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transitionRequest is the body of POST /api/posts/:id/status.
+type transitionRequest struct {
+	Status      models.PostStatus `json:"status" binding:"required"`
+	Comment     string            `json:"comment"`
+	PublishAt   *time.Time        `json:"publish_at"`
+	UnpublishAt *time.Time        `json:"unpublish_at"`
+}
+
+// restrictToVisible limits a listing to the posts the caller may see, see
+// policy.Visible. Asking for any other status than published without signing
+// in is refused rather than quietly answered with published posts.
+func restrictToVisible(c *gin.Context, filter *database.PostFilter) bool {
+	p := principalFrom(c)
+	if p == nil {
+		for _, status := range filter.Status {
+			if status != models.StatusPublished {
+				abortWithProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Unauthorized", "Sign in to see unpublished posts"))
+				return false
+			}
+		}
+	}
+
+	policy.RestrictToVisible(p, filter)
+	return true
+}
+
+// TransitionPostHandler moves a post to another status of the workflow.
+// Transitions marked ReviewerOnly are refused for writers, see
+// policy.DecideTransition.
+func (s *Server) TransitionPostHandler(c *gin.Context) {
+	var req transitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	post, ok := s.postFromParam(c, "Failed to change post status")
+	if !ok {
+		return
+	}
+
+	transition, err := database.FindTransition(post.Status, req.Status)
+	if err != nil {
+		abortWithError(c, "Failed to change post status", err)
+		return
+	}
+
+	if !enforce(c, "Failed to change post status", policy.DecideTransition(principalFrom(c), post, transition)) {
+		return
+	}
+
+	updated, err := s.db.TransitionPost(c.Request.Context(), post.ID.Hex(), database.StatusUpdate{
+		From:        post.Status,
+		To:          req.Status,
+		Comment:     req.Comment,
+		PublishAt:   req.PublishAt,
+		UnpublishAt: req.UnpublishAt,
+	})
+	if err != nil {
+		abortWithError(c, "Failed to change post status", err)
+		return
+	}
+
+	c.Header("ETag", postETag(updated))
+	c.JSON(http.StatusOK, updated)
+}
+
+// ListTransitionsHandler returns the log of status changes of a post, newest
+// first.
+func (s *Server) ListTransitionsHandler(c *gin.Context) {
+	if _, ok := s.authorizePost(c, "Failed to list status changes", policy.ReadHistory); !ok {
+		return
+	}
+
+	changes, err := s.db.ListStatusChanges(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		abortWithError(c, "Failed to list status changes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  changes,
+		"count": len(changes),
+	})
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-news/internal/database/models"
+	"testing"
+)
+
+func TestWorkflowHandlers(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	post := &models.Post{Title: "Budget leak", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	url := "/api/posts/" + post.ID.Hex()
+
+	move := func(token string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url+"/status", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			withToken(req, token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(target string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			withToken(req, token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	count := func(rr *httptest.ResponseRecorder) int {
+		var list struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		return list.Count
+	}
+
+	// Drafts are hidden from the public but not from the newsroom.
+	if rr := get(url, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an anonymous draft, got %d", rr.Code)
+	}
+	if rr := get(url, tk.writer); rr.Code != http.StatusOK {
+		t.Fatalf("expected the draft for a writer, got %d", rr.Code)
+	}
+	if n := count(get("/api/posts", "")); n != 0 {
+		t.Fatalf("expected no public posts, got %d", n)
+	}
+	if n := count(get("/api/posts?status=draft", tk.writer)); n != 1 {
+		t.Fatalf("expected one draft, got %d", n)
+	}
+	if rr := get("/api/posts?status=draft", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for anonymous drafts, got %d", rr.Code)
+	}
+	if rr := get(url, "stolen-token"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown token, got %d", rr.Code)
+	}
+
+	if rr := move("", `{"status":"in_review"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+	if rr := move(tk.writer, `{"status":"in_review","comment":"ready"}`); rr.Code != http.StatusOK {
+		t.Fatalf("submit returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := move(tk.writer, `{"status":"published"}`)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when a writer publishes, got %d", rr.Code)
+	}
+	var p Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeForbidden || !strings.Contains(p.Detail, "in_review to published") {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	if rr := move(tk.editor, `{"status":"archived"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a move the workflow lacks, got %d", rr.Code)
+	}
+	if rr := move(tk.editor, `{"status":"live"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unknown status, got %d", rr.Code)
+	}
+
+	rr = move(tk.editor, `{"status":"published"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("publish returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var published models.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.Status != models.StatusPublished || rr.Header().Get("ETag") != `"3"` {
+		t.Fatalf("unexpected published post: %+v", published)
+	}
+
+	if rr := get(url, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected the published post for the public, got %d", rr.Code)
+	}
+	if n := count(get("/api/posts", "")); n != 1 {
+		t.Fatalf("expected one public post, got %d", n)
+	}
+
+	// Status only changes through transitions.
+	req := withToken(httptest.NewRequest(http.MethodPatch, url, strings.NewReader(`{"status":"draft"}`)), tk.editor)
+	req.Header.Set("Content-Type", mergePatchContentType)
+	req.Header.Set("If-Match", `"3"`)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 when patching the status, got %d", rr.Code)
+	}
+
+	if rr := get(url+"/transitions", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an anonymous log, got %d", rr.Code)
+	}
+	rr = get(url+"/transitions", tk.editor)
+	var log struct {
+		Data []models.StatusChange `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Data) != 2 ||
+		log.Data[0].To != models.StatusPublished || log.Data[0].Actor != "erin" ||
+		log.Data[1].To != models.StatusInReview || log.Data[1].Actor != "will" || log.Data[1].Comment != "ready" {
+		t.Fatalf("unexpected log: %+v", log.Data)
+	}
+}
+
+func TestScheduleHandler(t *testing.T) {
+	s, h, tk := newTestServer()
+
+	post := &models.Post{Title: "Embargoed", Content: "body", Author: "will", AuthorID: userID(t, s, "will")}
+	if err := s.db.CreatePost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	url := "/api/posts/" + post.ID.Hex()
+
+	move := func(token string, body string) *httptest.ResponseRecorder {
+		req := withToken(httptest.NewRequest(http.MethodPost, url+"/status", strings.NewReader(body)), token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := move(tk.writer, `{"status":"scheduled","publish_at":"2030-01-01T09:00:00Z"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when a writer schedules, got %d", rr.Code)
+	}
+	if rr := move(tk.editor, `{"status":"scheduled"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 without publish_at, got %d", rr.Code)
+	}
+	if rr := move(tk.editor, `{"status":"in_review","publish_at":"2030-01-01T09:00:00Z"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for publish_at outside scheduling, got %d", rr.Code)
+	}
+
+	rr := move(tk.editor, `{"status":"scheduled","publish_at":"2030-01-01T09:00:00Z","unpublish_at":"2030-02-01T09:00:00Z"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("schedule returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var scheduled models.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &scheduled); err != nil {
+		t.Fatal(err)
+	}
+	if scheduled.Status != models.StatusScheduled || scheduled.PublishAt == nil || scheduled.PublishAt.Year() != 2030 {
+		t.Fatalf("unexpected scheduled post: %+v", scheduled)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected a scheduled post to stay hidden, got %d", rr.Code)
+	}
+}
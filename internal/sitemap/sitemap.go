@@ -0,0 +1,237 @@
+// Package sitemap lists the public pages of the site for search engines, as
+// described at https://www.sitemaps.org/protocol.html.
+package sitemap
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"test-news/internal/database"
+	"test-news/internal/database/models"
+	"time"
+)
+
+// MaxURLs is the most URLs a single sitemap may list. Past it the site is
+// described by a sitemap index pointing at several sitemaps.
+const MaxURLs = 50_000
+
+// ContentType is the media type of sitemaps and sitemap indexes.
+const ContentType = "application/xml; charset=utf-8"
+
+const namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// order lists posts by when they were created, oldest first. Posts become
+// public when they are published rather than created, so a draft published
+// late lands in an earlier sitemap and moves where the later ones start.
+// Sitemaps are therefore only cached briefly, see the server.
+var order = database.Sort{Field: database.SortCreatedAt, Asc: true}
+
+// Generator writes the sitemaps of the posts in db. It reads posts a page
+// at a time through cursors, so a sitemap never needs the whole collection
+// in memory.
+type Generator struct {
+	db      database.Service
+	perFile int
+}
+
+// New returns a generator listing up to perFile URLs in each sitemap, or
+// MaxURLs when perFile is zero.
+func New(db database.Service, perFile int) *Generator {
+	if perFile <= 0 || perFile > MaxURLs {
+		perFile = MaxURLs
+	}
+	return &Generator{db: db, perFile: perFile}
+}
+
+// entry is a <url> of a sitemap or a <sitemap> of an index.
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Write writes the sitemap of the site at baseURL to w: a single sitemap
+// while every URL fits in one, a sitemap index otherwise.
+func (g *Generator) Write(ctx context.Context, w io.Writer, baseURL string) error {
+	page, err := g.db.ListPosts(ctx, database.ListOptions{
+		Limit:     1,
+		WithTotal: true,
+		Filter:    publicFilter(),
+		Sort:      order,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The first sitemap also lists the home page.
+	if page.Total == nil || *page.Total+1 <= int64(g.perFile) {
+		return g.WritePart(ctx, w, baseURL, "")
+	}
+	return g.writeIndex(ctx, w, baseURL)
+}
+
+// WritePart writes the sitemap of the posts that follow the cursor from, or
+// of the first posts and the home page when from is empty. These are the
+// sitemaps a sitemap index points at.
+func (g *Generator) WritePart(ctx context.Context, w io.Writer, baseURL string, from string) error {
+	first, err := g.firstPage(ctx, from)
+	if err != nil {
+		return err
+	}
+	enc, err := begin(w, "urlset")
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	if from == "" {
+		if err := enc.EncodeElement(entry{Loc: baseURL + "/web/posts"}, start("url")); err != nil {
+			return err
+		}
+		n++
+	}
+
+	err = g.walk(ctx, first, func(post *models.Post) (bool, error) {
+		if n == g.perFile {
+			return false, nil
+		}
+		n++
+		return true, enc.EncodeElement(entry{
+			Loc:     baseURL + "/web/posts/" + post.ID.Hex(),
+			LastMod: lastMod(post.UpdatedAt),
+		}, start("url"))
+	})
+	if err != nil {
+		return err
+	}
+
+	return end(w, enc, "urlset")
+}
+
+// writeIndex walks every public post once to find where each sitemap starts
+// and when its newest change was made.
+func (g *Generator) writeIndex(ctx context.Context, w io.Writer, baseURL string) error {
+	first, err := g.firstPage(ctx, "")
+	if err != nil {
+		return err
+	}
+	enc, err := begin(w, "sitemapindex")
+	if err != nil {
+		return err
+	}
+
+	from, n := "", 1 // the home page opens the first sitemap
+	var updated time.Time
+	flush := func() error {
+		loc := baseURL + "/sitemap-posts.xml"
+		if from != "" {
+			loc += "?from=" + url.QueryEscape(from)
+		}
+		return enc.EncodeElement(entry{Loc: loc, LastMod: lastMod(updated)}, start("sitemap"))
+	}
+
+	err = g.walk(ctx, first, func(post *models.Post) (bool, error) {
+		if post.UpdatedAt.After(updated) {
+			updated = post.UpdatedAt
+		}
+		n++
+		if n < g.perFile {
+			return true, nil
+		}
+
+		if err := flush(); err != nil {
+			return false, err
+		}
+		from, n, updated = database.CursorAfter(post, order), 0, time.Time{}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	return end(w, enc, "sitemapindex")
+}
+
+// listOptions reads the public posts after the cursor from in sitemap order,
+// as many at a time as a page holds.
+func listOptions(from string) database.ListOptions {
+	return database.ListOptions{
+		Limit:  database.MaxPageLimit,
+		Cursor: from,
+		Filter: publicFilter(),
+		Sort:   order,
+	}
+}
+
+// firstPage reads the first page of a walk before anything is written, so
+// that a bad cursor or a failing database is reported as an error rather
+// than as a truncated document.
+func (g *Generator) firstPage(ctx context.Context, from string) (*database.PostPage, error) {
+	return g.db.ListPosts(ctx, listOptions(from))
+}
+
+// walk calls fn with every post of page and of the pages that follow it,
+// reading them one at a time. fn returns false to stop early.
+func (g *Generator) walk(ctx context.Context, page *database.PostPage, fn func(*models.Post) (bool, error)) error {
+	for {
+		for _, post := range page.Posts {
+			more, err := fn(post)
+			if err != nil || !more {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+
+		var err error
+		if page, err = g.db.ListPosts(ctx, listOptions(page.NextCursor)); err != nil {
+			return err
+		}
+	}
+}
+
+// publicFilter matches the posts anyone may read.
+func publicFilter() database.PostFilter {
+	return database.PostFilter{Status: []models.PostStatus{models.StatusPublished}}
+}
+
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func start(name string) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: name}}
+}
+
+// begin writes the XML declaration and opens the root element. Entries are
+// encoded one at a time as the posts are read.
+func begin(w io.Writer, root string) (*xml.Encoder, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	el := start(root)
+	el.Attr = []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: namespace}}
+	return enc, enc.EncodeToken(el)
+}
+
+func end(w io.Writer, enc *xml.Encoder, root string) error {
+	if err := enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: root}}); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,162 @@
+package sitemap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"test-news/internal/database"
+	"test-news/internal/database/memory"
+	"test-news/internal/database/models"
+	"testing"
+	"time"
+)
+
+// countingService records how posts are read, to check that sitemaps page
+// through them rather than loading them all.
+type countingService struct {
+	database.Service
+	lists int
+}
+
+func (s *countingService) ListPosts(ctx context.Context, opts database.ListOptions) (*database.PostPage, error) {
+	s.lists++
+	return s.Service.ListPosts(ctx, opts)
+}
+
+func (s *countingService) GetPosts(ctx context.Context) ([]*models.Post, error) {
+	panic("sitemaps must not load every post at once")
+}
+
+// newService returns a backend holding published posts and a draft.
+func newService(t *testing.T, published int) *countingService {
+	t.Helper()
+	ctx := context.Background()
+	db := memory.New()
+
+	for i := 0; i <= published; i++ {
+		post := &models.Post{Title: "Post", Content: "body", Author: "jane"}
+		if err := db.CreatePost(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+		if i == published {
+			break // the last one stays a draft
+		}
+		if _, err := db.TransitionPost(ctx, post.ID.Hex(), database.StatusUpdate{From: models.StatusDraft, To: models.StatusPublished}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &countingService{Service: db}
+}
+
+type urlset struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+func TestWriteSingleSitemap(t *testing.T) {
+	db := newService(t, 3)
+
+	var buf bytes.Buffer
+	if err := New(db, 4).Write(context.Background(), &buf, "https://news.example"); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc urlset
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("expected a urlset: %v\n%s", err, buf.String())
+	}
+	if len(doc.URLs) != 4 || doc.URLs[0].Loc != "https://news.example/web/posts" {
+		t.Fatalf("expected the home page and 3 posts: %s", buf.String())
+	}
+	for _, u := range doc.URLs[1:] {
+		if !strings.HasPrefix(u.Loc, "https://news.example/web/posts/") {
+			t.Fatalf("unexpected URL %q", u.Loc)
+		}
+		if _, err := time.Parse(time.RFC3339, u.LastMod); err != nil {
+			t.Fatalf("expected lastmod in W3C format, got %q", u.LastMod)
+		}
+	}
+}
+
+func TestWriteSitemapIndex(t *testing.T) {
+	ctx := context.Background()
+	db := newService(t, 8)
+	g := New(db, 4)
+
+	var buf bytes.Buffer
+	if err := g.Write(ctx, &buf, "https://news.example"); err != nil {
+		t.Fatal(err)
+	}
+	var index sitemapIndex
+	if err := xml.Unmarshal(buf.Bytes(), &index); err != nil {
+		t.Fatalf("expected a sitemap index: %v\n%s", err, buf.String())
+	}
+	// The home page and 8 posts make 9 URLs, which take 3 sitemaps of 4.
+	if len(index.Sitemaps) != 3 {
+		t.Fatalf("expected 3 sitemaps: %s", buf.String())
+	}
+
+	seen := make(map[string]bool)
+	for i, entry := range index.Sitemaps {
+		loc, err := url.Parse(entry.Loc)
+		if err != nil || loc.Path != "/sitemap-posts.xml" {
+			t.Fatalf("unexpected sitemap location %q", entry.Loc)
+		}
+		if (i == 0) != (loc.Query().Get("from") == "") {
+			t.Fatalf("expected only the first sitemap to start without a cursor: %q", entry.Loc)
+		}
+
+		var part bytes.Buffer
+		if err := g.WritePart(ctx, &part, "https://news.example", loc.Query().Get("from")); err != nil {
+			t.Fatal(err)
+		}
+		var doc urlset
+		if err := xml.Unmarshal(part.Bytes(), &doc); err != nil {
+			t.Fatalf("expected a urlset: %v\n%s", err, part.String())
+		}
+		if want := []int{4, 4, 1}[i]; len(doc.URLs) != want {
+			t.Fatalf("expected sitemap %d to list %d URLs, got %d", i, want, len(doc.URLs))
+		}
+
+		var newest string
+		for _, u := range doc.URLs {
+			if seen[u.Loc] {
+				t.Fatalf("%q is listed twice", u.Loc)
+			}
+			seen[u.Loc] = true
+			newest = max(newest, u.LastMod)
+		}
+		if entry.LastMod != newest {
+			t.Fatalf("expected the index to give the newest change of sitemap %d, got %q and %q", i, entry.LastMod, newest)
+		}
+	}
+	if len(seen) != 9 {
+		t.Fatalf("expected every published post and the home page, got %d URLs", len(seen))
+	}
+
+	// Posts are read a page at a time.
+	if db.lists == 0 {
+		t.Fatal("expected the posts to be listed through pages")
+	}
+}
+
+func TestWritePartRejectsBadCursor(t *testing.T) {
+	var buf bytes.Buffer
+	err := New(newService(t, 1), 0).WritePart(context.Background(), &buf, "https://news.example", "not-a-cursor")
+	if err == nil || buf.Len() != 0 {
+		t.Fatalf("expected an error before anything is written, got %v and %q", err, buf.String())
+	}
+}